@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/alerts"
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/accursedgalaxy/insider-monitor/internal/utils"
+)
+
+// outboxDir holds the alerts waiting for delivery and the dead-letter file
+const outboxDir = "./data/outbox"
+
+// newAlerter builds the configured destinations behind a router, the config is validated
+func newAlerter(cfg *config.Config, logger *utils.Logger) *alerts.Router {
+	var destinations []alerts.Destination
+	var names []string
+	for _, destination := range cfg.AlertDestinations() {
+		var alerter alerts.Alerter
+		switch strings.ToLower(destination.Type) {
+		case "discord":
+			webhookURL, channelID := destination.WebhookURL, destination.ChannelID
+			if webhookURL == "" {
+				webhookURL, channelID = cfg.Discord.WebhookURL, cfg.Discord.ChannelID
+			}
+			alerter = alerts.NewDiscordAlerter(webhookURL, channelID)
+		case "telegram":
+			var chats []alerts.TelegramChat
+			for _, chat := range destination.Chats {
+				chats = append(chats, alerts.TelegramChat{
+					ChatID:   chat.ChatID,
+					ThreadID: chat.ThreadID,
+					Levels:   parseLevels(chat.Levels),
+					Types:    chat.Types,
+					Wallets:  groupWallets(cfg.WalletGroups, chat.Groups),
+					Mints:    chat.Mints,
+				})
+			}
+			alerter = alerts.NewTelegramAlerter(destination.BotToken, chats)
+		case "slack":
+			if destination.BotToken != "" {
+				alerter = alerts.NewSlackBotAlerter(destination.BotToken, destination.Channel, destination.ThreadByWallet, cfg.WalletLabels)
+			} else {
+				alerter = alerts.NewSlackWebhookAlerter(destination.WebhookURL, cfg.WalletLabels)
+			}
+		case "webhook":
+			webhook, err := alerts.NewWebhookAlerter(alerts.WebhookOptions{
+				URL:      destination.WebhookURL,
+				Secret:   destination.Secret,
+				Headers:  destination.Headers,
+				CertFile: destination.ClientCert,
+				KeyFile:  destination.ClientKey,
+				CAFile:   destination.CACert,
+			})
+			if err != nil {
+				logger.Fatal("Destination %s: %v\n\n"+
+					"💡 Check that client_cert, client_key and ca_cert point to readable PEM files.", destination.DestinationName(), err)
+			}
+			alerter = webhook
+		case "file":
+			alerter = alerts.NewFileAlerter(destination.Path)
+		default:
+			alerter = &alerts.ConsoleAlerter{}
+		}
+		destinations = append(destinations, alerts.Destination{Name: destination.DestinationName(), Alerter: alerter})
+		names = append(names, destination.DestinationName())
+	}
+
+	var routes []alerts.Route
+	for _, route := range cfg.Routes {
+		routes = append(routes, alerts.Route{
+			Levels:       parseLevels(route.Levels),
+			Types:        route.Types,
+			Wallets:      groupWallets(cfg.WalletGroups, route.Groups),
+			Mints:        route.Mints,
+			Destinations: route.Destinations,
+		})
+	}
+
+	logger.Config("Alert destinations: %s (%d routes)", strings.Join(names, ", "), len(routes))
+	return alerts.NewRouter(destinations, routes)
+}
+
+// newOutbox opens the outbox alerts are written to before the router delivers them
+func newOutbox(router *alerts.Router, cfg *config.Config, logger *utils.Logger) *alerts.Outbox {
+	outbox, err := alerts.NewOutbox(outboxDir, router, alerts.OutboxOptions{
+		MaxAttempts: cfg.Outbox.Attempts(),
+		MaxBackoff:  cfg.Outbox.MaxBackoffDuration(),
+	})
+	if err != nil {
+		logger.Fatal("Failed to open the alert outbox: %v\n\n"+
+			"💡 Check that %s is writable, alerts are kept there until they are delivered.", err, outboxDir)
+	}
+	return outbox
+}
+
+func parseLevels(names []string) []alerts.AlertLevel {
+	var levels []alerts.AlertLevel
+	for _, name := range names {
+		if level, ok := alerts.ParseLevel(name); ok {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// groupWallets returns the members of the groups, nil when no group is given so the route
+// matches every wallet. Empty groups match none.
+func groupWallets(groups map[string][]string, names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	wallets := []string{}
+	for _, name := range names {
+		wallets = append(wallets, groups[name]...)
+	}
+	return wallets
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+	"github.com/accursedgalaxy/insider-monitor/internal/storage"
+	"github.com/accursedgalaxy/insider-monitor/internal/utils"
+)
+
+// runBackfill fetches the past token balance movements of the configured wallets into
+// ./data/history. It can be stopped at any time and picks up where it left off.
+func runBackfill(args []string, logger *utils.Logger) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	since := flags.String("since", "", "Oldest date to backfill, e.g. 2024-01-31 or 2024-01-31T15:04:05Z")
+	sinceSlot := flags.Uint64("since-slot", 0, "Oldest slot to backfill")
+	wallet := flags.String("wallet", "", "Backfill only this wallet instead of every configured one")
+	_ = flags.Parse(args)
+
+	cfg := loadConfig(*configPath, logger)
+
+	opts := monitor.BackfillOptions{SinceSlot: *sinceSlot}
+	if *since != "" {
+		date, err := parseBackfillDate(*since)
+		if err != nil {
+			logger.Fatal("Invalid -since date %q: %v\n\n"+
+				"💡 Use a date like 2024-01-31 or a timestamp like 2024-01-31T15:04:05Z", *since, err)
+		}
+		opts.Since = date
+	}
+	if opts.Since.IsZero() && opts.SinceSlot == 0 {
+		logger.Warning("No -since or -since-slot given, backfilling the complete history")
+	}
+
+	wallets := cfg.Wallets
+	if *wallet != "" {
+		wallets = []string{*wallet}
+	}
+
+	scanner, err := monitor.NewWalletMonitorWithEndpoints(cfg.Endpoints(), wallets, &cfg.Scan)
+	if err != nil {
+		logger.Fatal("Failed to create wallet monitor: %v", err)
+	}
+	history := storage.NewHistoryStore("./data")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := 0
+	for _, addr := range wallets {
+		logger.Scan("Backfilling %s...", addr)
+		result, err := scanner.Backfill(ctx, addr, opts, history)
+		if ctx.Err() != nil {
+			logger.Info("Backfill interrupted, run it again to resume from the last checkpoint")
+			return
+		}
+		if err != nil {
+			logger.Error("Backfill of %s stopped: %v", addr, err)
+			failed++
+			continue
+		}
+		logger.Success("%s: %d transactions fetched, %d new events stored", addr, result.Transactions, result.Events)
+	}
+
+	if failed > 0 {
+		logger.Fatal("%d of %d wallets could not be backfilled, run the command again to resume them", failed, len(wallets))
+	}
+}
+
+func parseBackfillDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
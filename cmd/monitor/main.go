@@ -1,62 +1,59 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/accursedgalaxy/insider-monitor/internal/alerts"
 	"github.com/accursedgalaxy/insider-monitor/internal/config"
 	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+	"github.com/accursedgalaxy/insider-monitor/internal/rules"
 	"github.com/accursedgalaxy/insider-monitor/internal/storage"
 	"github.com/accursedgalaxy/insider-monitor/internal/utils"
 )
 
 // WalletScanner interface defines the contract for wallet monitoring
 type WalletScanner interface {
-	ScanAllWallets() (map[string]*monitor.WalletData, error)
+	ScanAllWallets(ctx context.Context) (map[string]*monitor.WalletData, *monitor.ScanReport, error)
 	DisplayWalletOverview(walletDataMap map[string]*monitor.WalletData)
+	EndpointStatus() []monitor.EndpointStatus
+	AttributeChanges(ctx context.Context, changes []monitor.Change, oldData, newData map[string]*monitor.WalletData)
+	ResolveTokenAges(ctx context.Context, changes []monitor.Change)
 }
 
 func main() {
 	// Create our custom logger
 	logger := utils.NewLogger(false)
 
-	configPath := flag.String("config", "config.json", "Path to configuration file")
-	flag.Parse()
-
 	// Print welcome message
 	fmt.Printf("\n%s%s SOLANA INSIDER MONITOR %s\n", utils.ColorBold, utils.ColorPurple, utils.ColorReset)
 	fmt.Printf("%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n\n", utils.ColorPurple, utils.ColorReset)
 
-	// Load configuration
-	cfg, err := config.LoadConfig(*configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			logger.Fatal("Configuration file not found: %v\n\n"+
-				"💡 Quick fix:\n"+
-				"   1. Copy the example: cp config.example.json config.json\n"+
-				"   2. Edit config.json with your settings\n"+
-				"   3. Get a free RPC endpoint from:\n"+
-				"      • Helius: https://helius.dev\n"+
-				"      • QuickNode: https://quicknode.com\n"+
-				"      • Triton: https://triton.one", err)
-		}
-		logger.Fatal("Failed to load config: %v\n\n"+
-			"💡 Check that your config.json file has valid JSON syntax.\n"+
-			"   You can validate it at https://jsonlint.com/", err)
+	// Subcommands come before their flags, e.g. "backfill -since 2024-01-31"
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfill(os.Args[2:], logger)
+		return
 	}
-
-	if err := cfg.Validate(); err != nil {
-		logger.Fatal("Configuration validation failed:\n%v", err)
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:], logger)
+		return
 	}
 
+	configPath := flag.String("config", "config.json", "Path to configuration file")
+	flag.Parse()
+
+	cfg := loadConfig(*configPath, logger)
+
 	// Initialize scanner
-	scanner, err := monitor.NewWalletMonitor(cfg.NetworkURL, cfg.Wallets, &cfg.Scan)
+	scanner, err := monitor.NewWalletMonitorWithEndpoints(cfg.Endpoints(), cfg.Wallets, &cfg.Scan)
 	if err != nil {
 		logger.Fatal("Failed to create wallet monitor: %v\n\n"+
 			"💡 This usually means:\n"+
@@ -66,14 +63,33 @@ func main() {
 			"   Verify your wallet addresses are valid Solana addresses.", err)
 	}
 
-	// Initialize alerter
-	var alerter alerts.Alerter
-	if cfg.Discord.Enabled {
-		alerter = alerts.NewDiscordAlerter(cfg.Discord.WebhookURL, cfg.Discord.ChannelID)
-		logger.Config("Discord alerts enabled")
-	} else {
-		alerter = &alerts.ConsoleAlerter{}
-		logger.Config("Console alerts enabled")
+	if err := scanner.EnableMetadataCache("./data"); err != nil {
+		logger.Warning("Could not load token metadata cache: %v", err)
+	}
+	// Wallets backfilled before they were added get their history in the new_wallet alert
+	scanner.EnableHistory(storage.NewHistoryStore("./data"))
+
+	// Wallets funded by monitored wallets are linked to them, and monitored as well in auto mode
+	var discovery *monitor.Discovery
+	if cfg.Discovery.Enabled {
+		graph, err := storage.New("./data").LoadFundingGraph()
+		if err != nil {
+			logger.Warning("Could not load funding graph, starting a new one: %v", err)
+			graph = monitor.NewFundingGraph()
+		}
+		discovery = monitor.NewDiscovery(scanner, cfg.Discovery, graph)
+		mode := "propose"
+		if cfg.Discovery.AutoAdd() {
+			mode = "auto"
+		}
+		logger.Config("Linked wallet discovery enabled (%s mode, up to %d hops)", mode, cfg.Discovery.MaxHops())
+	}
+
+	// Alerts fan out to every configured destination, routes decide which alerts go where.
+	// They are written to the outbox first and retried from there until they are delivered.
+	alerter := newOutbox(newAlerter(cfg, logger), cfg, logger)
+	if pending := alerter.Pending(); pending > 0 {
+		logger.Info("📬 %d alerts from the last run are waiting in the outbox", pending)
 	}
 
 	// Parse scan interval
@@ -83,16 +99,73 @@ func main() {
 		scanInterval = time.Minute
 	}
 
-	runMonitor(scanner, alerter, cfg, scanInterval, logger)
+	// In streaming mode the ticker only drives the periodic reconciliation pass
+	var stream *monitor.WalletStream
+	if cfg.Stream.Enabled {
+		stream = monitor.NewWalletStream(scanner, cfg.StreamURL())
+		logger.Config("PubSub streaming enabled (%s)", cfg.StreamURL())
+
+		reconcileInterval, err := time.ParseDuration(cfg.Stream.ReconcileInterval)
+		if err != nil {
+			logger.Warning("Invalid reconcile interval '%s', using default of 5 minutes", cfg.Stream.ReconcileInterval)
+			reconcileInterval = 5 * time.Minute
+		}
+		scanInterval = reconcileInterval
+	}
+
+	// Buys are correlated across wallets, several wallets entering one token is the signal
+	var convergence *monitor.ConvergenceDetector
+	if cfg.Alerts.Convergence.Enabled {
+		convergence = monitor.NewConvergenceDetector(cfg.Alerts.Convergence)
+		logger.Config("Convergence alerts enabled (%d wallets within %v)",
+			cfg.Alerts.Convergence.MinimumWallets(), cfg.Alerts.Convergence.WindowDuration())
+	}
+
+	// Alert rules decide the level and destinations of changes, before the default thresholds
+	var engine *rules.Engine
+	if len(cfg.Alerts.Rules) > 0 {
+		engine = rules.NewEngine(cfg.Alerts.Rules, cfg.WalletGroups)
+		logger.Config("%d alert rules loaded", len(cfg.Alerts.Rules))
+	}
+
+	runMonitor(scanner, stream, discovery, convergence, engine, alerter, cfg, scanInterval, logger)
+}
+
+// loadConfig loads and validates the configuration, exiting with hints when it is unusable
+func loadConfig(path string, logger *utils.Logger) *config.Config {
+	// Load configuration
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Fatal("Configuration file not found: %v\n\n"+
+				"💡 Quick fix:\n"+
+				"   1. Copy the example: cp config.example.json config.json\n"+
+				"   2. Edit config.json with your settings\n"+
+				"   3. Get a free RPC endpoint from:\n"+
+				"      • Helius: https://helius.dev\n"+
+				"      • QuickNode: https://quicknode.com\n"+
+				"      • Triton: https://triton.one", err)
+		}
+		logger.Fatal("Failed to load config: %v\n\n"+
+			"💡 Check that your config.json file has valid JSON syntax.\n"+
+			"   You can validate it at https://jsonlint.com/", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("Configuration validation failed:\n%v", err)
+	}
+	return cfg
 }
 
-func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Config, scanInterval time.Duration, logger *utils.Logger) {
+func runMonitor(scanner WalletScanner, stream *monitor.WalletStream, discovery *monitor.Discovery, convergence *monitor.ConvergenceDetector, engine *rules.Engine, alerter *alerts.Outbox, cfg *config.Config, scanInterval time.Duration, logger *utils.Logger) {
 	storage := storage.New("./data")
 
-	// Create buffered channels for graceful shutdown
-	interrupt := make(chan os.Signal, 1)
-	done := make(chan bool, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	// Cancelled on SIGINT/SIGTERM, which aborts in-flight RPC calls, retries and backoffs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Delivers what the loop below writes to the outbox, and what the last run left there
+	go alerter.Run(ctx)
 
 	// Track connection state
 	var lastSuccessfulScan time.Time
@@ -101,10 +174,14 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 	// Define maximum allowed time between successful scans
 	maxTimeBetweenScans := scanInterval * 3
 
-	// Initialize previousData from storage at startup
+	// Initialize previousData from storage at startup. Changes are only alerted on once a
+	// baseline exists, from a previous run or a complete scan of this one; until then every
+	// wallet would look new.
 	var previousData map[string]*monitor.WalletData
+	var baselined bool
 	if savedData, err := storage.LoadWalletData(); err == nil {
 		previousData = savedData
+		baselined = len(savedData) > 0
 		logger.Storage("Loaded previous wallet data from storage")
 	} else {
 		logger.Warning("Could not load previous data: %v. Will initialize after first scan.", err)
@@ -113,7 +190,12 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 
 	// Perform initial scan immediately
 	logger.Scan("Performing initial wallet scan...")
-	initialResults, err := scanner.ScanAllWallets()
+	initialResults, report, err := scanner.ScanAllWallets(ctx)
+	if ctx.Err() != nil {
+		logger.Info("Interrupted during the initial scan, nothing to save")
+		return
+	}
+	logEndpointStatus(scanner.EndpointStatus(), false, logger)
 	if err != nil {
 		logger.Error("Initial scan failed: %v", err)
 		logger.Error("\n💡 Common solutions:")
@@ -123,7 +205,10 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 		logger.Error("   • Try a different RPC provider if rate limited")
 		logger.Error("\nThe monitor will continue trying in the background...")
 	} else {
-		if err := storage.SaveWalletData(initialResults); err != nil {
+		reportWalletHealth(ctx, report, alerter, cfg.Alerts, logger)
+		previousData = mergeScanResults(previousData, initialResults, report)
+		baselined = true
+		if err := storage.SaveWalletData(previousData); err != nil {
 			logger.Error("Error saving initial data: %v", err)
 		}
 		lastSuccessfulScan = time.Now()
@@ -131,8 +216,22 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 		scanner.DisplayWalletOverview(initialResults)
 	}
 
+	// A nil channel never fires, so polling-only mode skips the stream case below
+	var wg sync.WaitGroup
+	var updates <-chan *monitor.WalletData
+	if stream != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream.Run(ctx)
+		}()
+		updates = stream.Updates()
+	}
+
 	// Start monitoring in a separate goroutine
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		ticker := time.NewTicker(scanInterval)
 		defer ticker.Stop()
 
@@ -141,6 +240,10 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 		for {
 			select {
 			case <-ticker.C:
+				if ctx.Err() != nil {
+					continue // Shutting down, the ctx.Done case stops the loop
+				}
+
 				// Check if we've exceeded the maximum time between scans
 				if time.Since(lastSuccessfulScan) > maxTimeBetweenScans && !connectionLost {
 					connectionLost = true
@@ -148,7 +251,12 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 					continue
 				}
 
-				newResults, err := scanner.ScanAllWallets()
+				newResults, report, err := scanner.ScanAllWallets(ctx)
+				if ctx.Err() != nil {
+					logger.Info("Scan aborted by shutdown")
+					continue
+				}
+				logEndpointStatus(scanner.EndpointStatus(), true, logger)
 				if err != nil {
 					logger.Error("Error scanning wallets: %v", err)
 					if !connectionLost {
@@ -157,6 +265,7 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 					}
 					continue
 				}
+				reportWalletHealth(ctx, report, alerter, cfg.Alerts, logger)
 
 				// Connection restored check
 				if connectionLost {
@@ -172,25 +281,79 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 				// Update last successful scan time
 				lastSuccessfulScan = time.Now()
 
-				// Process changes only if we have previous data
-				if len(previousData) > 0 {
-					changes := monitor.DetectChanges(previousData, newResults, cfg.Alerts.SignificantChange)
-					processChanges(changes, alerter, cfg.Alerts, logger)
+				// Process changes only once there is a baseline to compare against
+				if baselined {
+					changes := monitor.DetectChanges(previousData, newResults, cfg.Alerts)
+					scanner.AttributeChanges(ctx, changes, previousData, newResults)
+					discovery.Annotate(changes)
+					if cfg.Alerts.UsesTokenAge() {
+						scanner.ResolveTokenAges(ctx, changes)
+					}
+					processChanges(ctx, changes, alerter, engine, cfg.Alerts, logger)
+					reportConvergence(ctx, convergence, changes, alerter, logger)
 				} else {
 					// First scan, just store the data without generating alerts
 					logger.Info("Initial scan completed, storing baseline data")
 				}
 
+				// Wallets that failed this scan keep their last known state, otherwise
+				// they would show up as new wallets once they scan again
+				newResults = mergeScanResults(previousData, newResults, report)
+
 				// Save new results
 				if err := storage.SaveWalletData(newResults); err != nil {
 					logger.Error("Error saving data: %v", err)
 				}
 				previousData = newResults
+				baselined = true
+
+				// Wallets linked now are scanned, as new wallets, from the next scan on
+				if discovery != nil {
+					runDiscovery(ctx, discovery, alerter, storage, logger)
+				}
 
 				// Display wallet overview
 				scanner.DisplayWalletOverview(newResults)
 
-			case <-done:
+			case snapshot := <-updates:
+				// Streamed snapshots are compared against the last known state of that wallet only
+				oldData, known := previousData[snapshot.WalletAddress]
+
+				// The stream only watches token accounts, keep the SOL balance from the last poll
+				if known && snapshot.NativeSOL == nil {
+					snapshot.NativeSOL = oldData.NativeSOL
+				}
+				// A wallet without history gets a new_wallet baseline alert, unless no scan has
+				// established a baseline yet and every wallet's seed snapshot would look new
+				if baselined && !connectionLost {
+					oldWallets := map[string]*monitor.WalletData{}
+					if known {
+						oldWallets[snapshot.WalletAddress] = oldData
+					}
+					newWallets := map[string]*monitor.WalletData{snapshot.WalletAddress: snapshot}
+					changes := monitor.DetectChanges(oldWallets, newWallets, cfg.Alerts)
+					scanner.AttributeChanges(ctx, changes, oldWallets, newWallets)
+					discovery.Annotate(changes)
+					if cfg.Alerts.UsesTokenAge() {
+						scanner.ResolveTokenAges(ctx, changes)
+					}
+					processChanges(ctx, changes, alerter, engine, cfg.Alerts, logger)
+					reportConvergence(ctx, convergence, changes, alerter, logger)
+				}
+
+				if known && snapshot.OlderThan(oldData) {
+					continue
+				}
+				previousData[snapshot.WalletAddress] = snapshot
+				if err := storage.SaveWalletData(previousData); err != nil {
+					logger.Error("Error saving data: %v", err)
+				}
+
+			case <-ctx.Done():
+				// Streamed snapshots are saved as they arrive, this catches anything since
+				if err := storage.SaveWalletData(previousData); err != nil {
+					logger.Error("Error saving data: %v", err)
+				}
 				logger.Info("Monitoring loop stopped")
 				return
 			}
@@ -198,16 +361,276 @@ func runMonitor(scanner WalletScanner, alerter alerts.Alerter, cfg *config.Confi
 	}()
 
 	// Wait for interrupt signal
-	<-interrupt
+	<-ctx.Done()
+	stop() // A second Ctrl-C exits immediately
 	logger.Info("Shutting down gracefully...")
+
+	// The loop finishes alerting and saving the scan it is on, or aborts it if it is still
+	// waiting on the RPC, then flushes storage and returns
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		logger.Warning("Monitoring loop did not stop within %v, exiting anyway", shutdownTimeout)
+	}
+
+	// Alerts of the last scan get one attempt, whatever fails is retried on the next start
+	flushCtx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	alerter.Flush(flushCtx)
+	cancel()
+	if pending := alerter.Pending(); pending > 0 {
+		logger.Info("📬 %d alerts are kept in the outbox for the next start", pending)
+	}
+
 	if err := monitor.LogToFile("./data", "Monitor shutting down gracefully"); err != nil {
 		logger.Error("Failed to write shutdown log: %v", err)
 	}
-	done <- true
-	time.Sleep(time.Second) // Give a moment for final cleanup
 }
 
-func processChanges(changes []monitor.Change, alerter alerts.Alerter, alertCfg config.AlertConfig, logger *utils.Logger) {
+const (
+	alertTimeout    = 15 * time.Second // Per alert, also bounds alert delivery during shutdown
+	shutdownTimeout = 30 * time.Second
+)
+
+// sendAlert delivers an alert even once shutdown has begun, so alerts for a completed
+// scan are not lost, but never blocks for longer than alertTimeout
+func sendAlert(ctx context.Context, alerter alerts.Alerter, alert alerts.Alert, logger *utils.Logger) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), alertTimeout)
+	defer cancel()
+
+	if err := alerter.SendAlert(ctx, alert); err != nil {
+		logger.Error("Failed to send alert: %v", err)
+	}
+}
+
+// runDiscovery follows the transfers of the monitored wallets, alerts about the wallets
+// linked to them and saves the funding graph
+func runDiscovery(ctx context.Context, discovery *monitor.Discovery, alerter alerts.Alerter, store *storage.Storage, logger *utils.Logger) {
+	linked, err := discovery.Run(ctx)
+	if err != nil && ctx.Err() == nil {
+		logger.Error("Linked wallet discovery failed: %v", err)
+	}
+	for _, wallet := range linked {
+		sendAlert(ctx, alerter, linkedWalletAlert(wallet), logger)
+	}
+
+	if err := store.SaveFundingGraph(discovery.Graph()); err != nil {
+		logger.Error("Error saving funding graph: %v", err)
+	}
+}
+
+// linkedWalletAlert proposes a linked wallet, or announces that it is monitored now
+func linkedWalletAlert(wallet monitor.LinkedWallet) alerts.Alert {
+	edge := wallet.FundedBy
+	freshness := fmt.Sprintf("fresh wallet %s (%d transactions so far)", wallet.Address, wallet.Transactions)
+	if !wallet.Fresh {
+		freshness = fmt.Sprintf("wallet %s (%d+ transactions)", wallet.Address, wallet.Transactions)
+	}
+	msg := fmt.Sprintf("Tracked wallet %s funded %s with %s %s",
+		edge.From, freshness, utils.FormatTokenAmount(edge.Amount, edge.Decimals), edge.Symbol)
+	if edge.USDValue > 0 {
+		msg += fmt.Sprintf(" ($%.2f)", edge.USDValue)
+	}
+	if wallet.Depth > 1 {
+		msg += fmt.Sprintf("\n%d hops from tracked wallet %s", wallet.Depth, wallet.Root)
+	}
+	if wallet.Monitored {
+		msg += "\nNow monitoring it"
+	} else {
+		msg += "\nAdd it to the wallets in your config to monitor it"
+	}
+	msg += fmt.Sprintf("\nTransaction: %s", edge.Signature)
+
+	return alerts.Alert{
+		Timestamp:     time.Now(),
+		WalletAddress: wallet.Address,
+		TokenMint:     edge.Mint,
+		AlertType:     "linked_wallet",
+		Message:       msg,
+		Level:         alerts.Warning,
+		Data: map[string]interface{}{
+			"parent_wallet": wallet.Parent,
+			"root_wallet":   wallet.Root,
+			"depth":         wallet.Depth,
+			"amount":        edge.Amount,
+			"decimals":      edge.Decimals,
+			"symbol":        edge.Symbol,
+			"usd_value":     edge.USDValue,
+			"fresh":         wallet.Fresh,
+			"monitored":     wallet.Monitored,
+			"transactions": []alerts.Transaction{{
+				Signature:      edge.Signature,
+				Slot:           edge.Slot,
+				BlockTime:      edge.BlockTime,
+				Counterparties: []string{edge.From},
+			}},
+		},
+	}
+}
+
+// linkedFrom describes how a discovered wallet is linked to the tracked wallets
+func linkedFrom(linked *monitor.LinkedWallet) string {
+	if linked.Depth <= 1 {
+		return fmt.Sprintf("Linked wallet, funded by tracked wallet %s", linked.Parent)
+	}
+	return fmt.Sprintf("Linked wallet, funded by %s, %d hops from tracked wallet %s", linked.Parent, linked.Depth, linked.Root)
+}
+
+// reportConvergence raises a convergence alert for every token that enough wallets bought within the window
+func reportConvergence(ctx context.Context, detector *monitor.ConvergenceDetector, changes []monitor.Change, alerter alerts.Alerter, logger *utils.Logger) {
+	if detector == nil {
+		return
+	}
+	for _, convergence := range detector.Observe(changes, time.Now()) {
+		sendAlert(ctx, alerter, convergenceAlert(convergence), logger)
+	}
+}
+
+func convergenceAlert(convergence monitor.Convergence) alerts.Alert {
+	token := convergence.TokenSymbol
+	if convergence.TokenName != "" && convergence.TokenName != convergence.TokenSymbol {
+		token = fmt.Sprintf("%s [%s]", convergence.TokenSymbol, convergence.TokenName)
+	}
+
+	var lines []string
+	var wallets []string
+	entries := make([]alerts.ConvergenceEntry, 0, len(convergence.Entries))
+	for i, entry := range convergence.Entries {
+		line := fmt.Sprintf("%d. %s bought %s", i+1, entry.WalletAddress,
+			utils.FormatTokenAmount(entry.Amount, convergence.TokenDecimals))
+		if entry.USDValue > 0 {
+			line += fmt.Sprintf(" ($%.2f)", entry.USDValue)
+		}
+		line += " at " + entry.Time.Format("15:04:05")
+		lines = append(lines, line)
+		wallets = append(wallets, entry.WalletAddress)
+		entries = append(entries, alerts.ConvergenceEntry{
+			WalletAddress: entry.WalletAddress,
+			Amount:        entry.Amount,
+			USDValue:      entry.USDValue,
+			Time:          entry.Time,
+		})
+	}
+
+	first := convergence.Entries[0]
+	return alerts.Alert{
+		Timestamp:     time.Now(),
+		WalletAddress: first.WalletAddress,
+		TokenMint:     convergence.TokenMint,
+		AlertType:     "convergence",
+		Message: fmt.Sprintf("CONVERGENCE: %d tracked wallets bought %s (%s) within %v:\n%s",
+			len(convergence.Entries), token, convergence.TokenMint,
+			convergence.Span().Round(time.Second), strings.Join(lines, "\n")),
+		Level: alerts.Critical,
+		Data: map[string]interface{}{
+			"wallets":  wallets,
+			"entries":  entries,
+			"decimals": convergence.TokenDecimals,
+			"symbol":   convergence.TokenSymbol,
+			"name":     convergence.TokenName,
+			"window":   convergence.Window,
+			"span":     convergence.Span(),
+		},
+	}
+}
+
+// logEndpointStatus prints the RPC endpoint pool. With onlyUnhealthy set, endpoints
+// in rotation are skipped so regular scans only mention the ones that were ejected.
+func logEndpointStatus(statuses []monitor.EndpointStatus, onlyUnhealthy bool, logger *utils.Logger) {
+	for _, status := range statuses {
+		if status.State == monitor.EndpointHealthy {
+			if !onlyUnhealthy {
+				logger.Network("RPC %s (weight %d): healthy, slot %d, %v",
+					status.Name, status.Weight, status.Slot, status.Latency.Round(time.Millisecond))
+			}
+			continue
+		}
+		logger.Warning("RPC %s (weight %d): %s for another %v (%s), %d/%d requests failed",
+			status.Name, status.Weight, status.State, status.AvailableIn.Round(time.Second),
+			status.Reason, status.Failures, status.Requests)
+	}
+}
+
+// mergeScanResults adds the previous state of wallets that failed to scan to the new results,
+// and keeps the previous state of wallets whose new snapshot was read at an older slot
+func mergeScanResults(previous, results map[string]*monitor.WalletData, report *monitor.ScanReport) map[string]*monitor.WalletData {
+	for addr, data := range results {
+		if old, ok := previous[addr]; ok && data.OlderThan(old) {
+			results[addr] = old
+		}
+	}
+	if report == nil {
+		return results
+	}
+	for _, failure := range report.Failures {
+		if data, ok := previous[failure.WalletAddress]; ok {
+			results[failure.WalletAddress] = data
+		}
+	}
+	return results
+}
+
+// reportWalletHealth raises a wallet_health alert once a wallet has failed the configured
+// number of scans in a row, and again when it recovers
+func reportWalletHealth(ctx context.Context, report *monitor.ScanReport, alerter alerts.Alerter, alertCfg config.AlertConfig, logger *utils.Logger) {
+	if report == nil {
+		return
+	}
+	threshold := alertCfg.WalletFailureThreshold()
+
+	for _, failure := range report.Failures {
+		if failure.ConsecutiveFailures != threshold {
+			continue
+		}
+		alert := alerts.Alert{
+			Timestamp:     time.Now(),
+			WalletAddress: failure.WalletAddress,
+			AlertType:     "wallet_health",
+			Message: fmt.Sprintf("Wallet %s failed %d scans in a row since %s: %s",
+				failure.WalletAddress,
+				failure.ConsecutiveFailures,
+				failure.FailingSince.Format("15:04:05"),
+				failure.Error),
+			Level: alerts.Warning,
+			Data: map[string]interface{}{
+				"consecutive_failures": failure.ConsecutiveFailures,
+				"failing_since":        failure.FailingSince,
+				"error":                failure.Error,
+			},
+		}
+		sendAlert(ctx, alerter, alert, logger)
+	}
+
+	for _, failure := range report.Recovered {
+		if failure.ConsecutiveFailures < threshold {
+			continue
+		}
+		alert := alerts.Alert{
+			Timestamp:     time.Now(),
+			WalletAddress: failure.WalletAddress,
+			AlertType:     "wallet_health",
+			Message: fmt.Sprintf("Wallet %s is scanning again after %d failed scans",
+				failure.WalletAddress,
+				failure.ConsecutiveFailures),
+			Level: alerts.Info,
+			Data: map[string]interface{}{
+				"recovered":            true,
+				"consecutive_failures": failure.ConsecutiveFailures,
+				"failing_since":        failure.FailingSince,
+			},
+		}
+		sendAlert(ctx, alerter, alert, logger)
+	}
+}
+
+// maxNewWalletHoldings caps how many holdings a new_wallet alert lists
+const maxNewWalletHoldings = 10
+
+func processChanges(ctx context.Context, changes []monitor.Change, alerter alerts.Alerter, engine *rules.Engine, alertCfg config.AlertConfig, logger *utils.Logger) {
 	for _, change := range changes {
 		var msg string
 		var level alerts.AlertLevel
@@ -215,39 +638,166 @@ func processChanges(changes []monitor.Change, alerter alerts.Alerter, alertCfg c
 
 		switch change.ChangeType {
 		case "new_wallet":
-			// Create a consolidated message for all tokens
+			// Create a consolidated message for all tokens, most valuable first
+			mints := make([]string, 0, len(change.Holdings))
+			for mint := range change.Holdings {
+				mints = append(mints, mint)
+			}
+			sort.Slice(mints, func(i, j int) bool {
+				a, b := change.Holdings[mints[i]], change.Holdings[mints[j]]
+				if a.USDValue != b.USDValue {
+					return a.USDValue > b.USDValue
+				}
+				return mints[i] < mints[j]
+			})
+
+			// Native SOL leads, it is what the wallet pays for everything else with
 			var tokenDetails []string
+			holdings := len(change.Holdings)
+			if sol := change.NativeSOL; sol != nil {
+				detail := "SOL: " + utils.FormatTokenAmount(sol.Balance, sol.Decimals)
+				if sol.USDValue > 0 {
+					detail += fmt.Sprintf(" ($%.2f)", sol.USDValue)
+				}
+				tokenDetails = append(tokenDetails, detail)
+				holdings++
+			}
 			tokenData := make(map[string]uint64)
 			tokenDecimals := make(map[string]uint8)
-			for mint, balance := range change.TokenBalances {
-				tokenDetails = append(tokenDetails, fmt.Sprintf("%s: %d", mint, balance))
-				tokenData[mint] = balance
-				tokenDecimals[mint] = 9 // Default decimals, adjust if you have actual decimals
+			tokenSymbols := make(map[string]string)
+			tokenValues := make(map[string]float64)
+			for i, mint := range mints {
+				info := change.Holdings[mint]
+				tokenData[mint] = info.Balance
+				tokenDecimals[mint] = info.Decimals
+				tokenSymbols[mint] = info.Symbol
+				tokenValues[mint] = info.USDValue
+
+				if i < maxNewWalletHoldings {
+					detail := fmt.Sprintf("%s: %s", info.Symbol, utils.FormatTokenAmount(info.Balance, info.Decimals))
+					if info.USDValue > 0 {
+						detail += fmt.Sprintf(" ($%.2f)", info.USDValue)
+					}
+					tokenDetails = append(tokenDetails, detail)
+				}
 			}
-			msg = fmt.Sprintf("New wallet %s detected with %d tokens:\n%s",
+			if remaining := len(mints) - maxNewWalletHoldings; remaining > 0 {
+				tokenDetails = append(tokenDetails, fmt.Sprintf("... and %d more", remaining))
+			}
+
+			msg = fmt.Sprintf("New wallet %s detected with %d holdings worth $%.2f:\n%s",
 				change.WalletAddress,
-				len(change.TokenBalances),
+				holdings,
+				change.USDValue,
 				strings.Join(tokenDetails, "\n"))
 			level = alerts.Warning
 			alertData = map[string]interface{}{
 				"token_balances": tokenData,
 				"token_decimals": tokenDecimals,
+				"token_symbols":  tokenSymbols,
+				"token_values":   tokenValues,
+				"holdings":       tokenDetails,
+				"usd_value":      change.USDValue,
+			}
+			if sol := change.NativeSOL; sol != nil {
+				alertData["sol_balance"] = sol.Balance
+				alertData["sol_usd_value"] = sol.USDValue
+			}
+
+			// A backfilled wallet is not new to us, say what it has been doing
+			if history := change.History; history != nil {
+				summary := fmt.Sprintf("%d transactions in %d tokens since %s: %d buys, %d sells, %d swaps",
+					history.Transactions, history.Tokens, history.FirstSeen.Format("2006-01-02"),
+					history.Buys, history.Sells, history.Swaps)
+				msg += "\nHistory: " + summary
+				alertData["history"] = summary
 			}
 
 		case "new_token":
-			msg = fmt.Sprintf("New token %s (%s) detected in wallet with initial balance %d",
-				change.TokenSymbol, change.TokenMint, change.NewBalance)
+			msg = fmt.Sprintf("New token %s (%s) detected in wallet with initial balance %s",
+				tokenLabel(change), change.TokenMint,
+				utils.FormatTokenAmount(change.NewBalance, change.TokenDecimals))
+			if change.USDValue > 0 {
+				msg += fmt.Sprintf(" ($%.2f)", change.USDValue)
+			}
 			level = alerts.Warning
 			alertData = map[string]interface{}{
-				"balance":  change.NewBalance,
+				"balance":   change.NewBalance,
+				"decimals":  change.TokenDecimals,
+				"symbol":    change.TokenSymbol,
+				"name":      change.TokenName,
+				"usd_price": change.USDPrice,
+				"usd_value": change.USDValue,
+			}
+
+		case "sol_balance_change":
+			msg = fmt.Sprintf("SOL balance change: from %s to %s SOL (%.2f%%)",
+				utils.FormatTokenAmount(change.OldBalance, change.TokenDecimals),
+				utils.FormatTokenAmount(change.NewBalance, change.TokenDecimals),
+				change.ChangePercent)
+
+			absChange := abs(change.ChangePercent)
+			switch {
+			case absChange >= (alertCfg.SOLSignificantChange() * 5):
+				level = alerts.Critical
+			case absChange >= (alertCfg.SOLSignificantChange() * 2):
+				level = alerts.Warning
+			default:
+				level = alerts.Info
+			}
+
+			alertData = map[string]interface{}{
+				"old_balance":    change.OldBalance,
+				"new_balance":    change.NewBalance,
+				"decimals":       change.TokenDecimals,
+				"symbol":         change.TokenSymbol,
+				"change_percent": change.ChangePercent,
+				"usd_price":      change.USDPrice,
+				"usd_value":      change.USDValue,
+			}
+
+		case "token_removed":
+			// A full exit is the strongest signal we have, always escalate it
+			msg = fmt.Sprintf("FULL EXIT: entire %s (%s) position of %s removed from wallet",
+				tokenLabel(change), change.TokenMint,
+				utils.FormatTokenAmount(change.OldBalance, change.TokenDecimals))
+			if change.USDValue > 0 {
+				msg += fmt.Sprintf(" (last known value $%.2f)", change.USDValue)
+			}
+			level = alerts.Critical
+			alertData = map[string]interface{}{
+				"old_balance":    change.OldBalance,
+				"new_balance":    uint64(0),
+				"decimals":       change.TokenDecimals,
+				"symbol":         change.TokenSymbol,
+				"name":           change.TokenName,
+				"change_percent": change.ChangePercent,
+				"usd_price":      change.USDPrice,
+				"usd_value":      change.USDValue,
+			}
+
+		case "internal_transfer":
+			// Moving tokens between a wallet's own accounts is not a trade, keep it informational
+			msg = fmt.Sprintf("Internal transfer of %s %s between %d token accounts of the same wallet",
+				utils.FormatTokenAmount(change.TransferAmount, change.TokenDecimals),
+				tokenLabel(change), len(change.AccountChanges))
+			level = alerts.Info
+			alertData = map[string]interface{}{
+				"amount":   change.TransferAmount,
 				"decimals": change.TokenDecimals,
 				"symbol":   change.TokenSymbol,
+				"name":     change.TokenName,
 			}
 
 		case "balance_change":
-			msg = fmt.Sprintf("Balance change for %s (%s): from %d to %d (%.2f%%)",
-				change.TokenSymbol, change.TokenMint,
-				change.OldBalance, change.NewBalance, change.ChangePercent)
+			msg = fmt.Sprintf("Balance change for %s (%s): from %s to %s (%.2f%%)",
+				tokenLabel(change), change.TokenMint,
+				utils.FormatTokenAmount(change.OldBalance, change.TokenDecimals),
+				utils.FormatTokenAmount(change.NewBalance, change.TokenDecimals),
+				change.ChangePercent)
+			if change.USDChange != 0 {
+				msg += fmt.Sprintf(", %s$%.2f (now worth $%.2f)", sign(change.USDChange), abs(change.USDChange), change.USDValue)
+			}
 
 			absChange := abs(change.ChangePercent)
 			switch {
@@ -264,11 +814,70 @@ func processChanges(changes []monitor.Change, alerter alerts.Alerter, alertCfg c
 				"new_balance":    change.NewBalance,
 				"decimals":       change.TokenDecimals,
 				"symbol":         change.TokenSymbol,
+				"name":           change.TokenName,
 				"change_percent": change.ChangePercent,
+				"usd_price":      change.USDPrice,
+				"usd_value":      change.USDValue,
+				"usd_change":     change.USDChange,
 			}
 		}
 
-		if level >= alerts.Warning {
+		// Token-2022 extensions like transfer fees or a permanent delegate change what a holding is worth
+		if flags := change.Extensions.Flags(); len(flags) > 0 {
+			msg += fmt.Sprintf("\n⚠️ Token-2022: %s", strings.Join(flags, ", "))
+			alertData["token_flags"] = flags
+		}
+
+		// Alerts on discovered wallets say which tracked wallet they came from
+		if linked := change.LinkedFrom; linked != nil {
+			msg += "\n🔗 " + linkedFrom(linked)
+			alertData["linked_from"] = linkedFrom(linked)
+			alertData["parent_wallet"] = linked.Parent
+			alertData["root_wallet"] = linked.Root
+		}
+
+		// The transactions behind the change, rendered as explorer links where supported
+		if len(change.Transactions) > 0 {
+			txs := make([]alerts.Transaction, 0, len(change.Transactions))
+			for _, tx := range change.Transactions {
+				programs := make([]string, 0, len(tx.Programs))
+				for _, program := range tx.Programs {
+					programs = append(programs, monitor.ProgramName(program))
+				}
+				alertTx := alerts.Transaction{
+					Signature:      tx.Signature,
+					Slot:           tx.Slot,
+					BlockTime:      tx.BlockTime,
+					Programs:       programs,
+					Counterparties: tx.Counterparties,
+				}
+				// Say what was traded rather than just how the balance moved
+				if tx.Swap != nil {
+					alertTx.Swap = tx.Swap.String()
+					msg += "\n" + alertTx.Swap
+				}
+				txs = append(txs, alertTx)
+			}
+			latest := change.Transactions[len(change.Transactions)-1]
+			msg += fmt.Sprintf("\nTransaction: %s", latest.Signature)
+			alertData["transactions"] = txs
+		}
+
+		// The first matching rule overrides the default level and picks the destinations
+		var destinations []string
+		if decision, ok := engine.Evaluate(change, time.Now()); ok {
+			if decision.Suppressed {
+				logger.Info("🔇 Suppressed by rule %s: %s", decision.Rule, msg)
+				continue
+			}
+			if decision.Level != "" {
+				level = decision.Level
+			}
+			destinations = decision.Destinations
+			alertData["rule"] = decision.Rule
+		}
+
+		if level.AtLeast(alerts.Warning) {
 			alert := alerts.Alert{
 				Timestamp:     time.Now(),
 				WalletAddress: change.WalletAddress,
@@ -277,17 +886,31 @@ func processChanges(changes []monitor.Change, alerter alerts.Alerter, alertCfg c
 				Message:       msg,
 				Level:         level,
 				Data:          alertData,
+				Destinations:  destinations,
 			}
 
-			if err := alerter.SendAlert(alert); err != nil {
-				logger.Error("Failed to send alert: %v", err)
-			}
+			sendAlert(ctx, alerter, alert, logger)
 		} else {
 			logger.Info(msg)
 		}
 	}
 }
 
+// tokenLabel shows the token name next to its symbol when the mint has metadata
+func tokenLabel(change monitor.Change) string {
+	if change.TokenName != "" && change.TokenName != change.TokenSymbol {
+		return fmt.Sprintf("%s [%s]", change.TokenSymbol, change.TokenName)
+	}
+	return change.TokenSymbol
+}
+
+func sign(x float64) string {
+	if x < 0 {
+		return "-"
+	}
+	return "+"
+}
+
 func abs(x float64) float64 {
 	if x < 0 {
 		return -x
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/utils"
+)
+
+// runReplay puts dead-lettered alerts back into the outbox and delivers them, retrying like the
+// monitor does. Alerts that fail again go back to the dead-letter file. It should run while the
+// monitor is stopped, both write the outbox.
+func runReplay(args []string, logger *utils.Logger) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	destination := flags.String("destination", "", "Replay only the alerts of this destination instead of all of them")
+	_ = flags.Parse(args)
+
+	cfg := loadConfig(*configPath, logger)
+	outbox := newOutbox(newAlerter(cfg, logger), cfg, logger)
+
+	replayed, err := outbox.Replay(*destination)
+	if err != nil {
+		logger.Fatal("Failed to replay dead-lettered alerts: %v", err)
+	}
+	if replayed == 0 {
+		logger.Info("No dead-lettered alerts to replay")
+	} else {
+		logger.Info("📬 Replaying %d dead-lettered alerts", replayed)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Alerts pending from the last run of the monitor are delivered as well
+	if err := outbox.Drain(ctx); err != nil {
+		logger.Info("Replay interrupted, %d alerts stay in the outbox for the next start", outbox.Pending())
+		return
+	}
+	logger.Success("Outbox is empty, every alert was delivered or dead-lettered again")
+}
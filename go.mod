@@ -5,8 +5,9 @@ go 1.23.2
 require (
 	github.com/gagliardetto/binary v0.8.0
 	github.com/gagliardetto/solana-go v1.12.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/stretchr/testify v1.10.0
-	golang.org/x/time v0.8.0 // indirect
+	golang.org/x/time v0.8.0
 )
 
 require (
@@ -1,6 +1,12 @@
 package alerts
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +18,29 @@ const (
 	Critical AlertLevel = "CRITICAL"
 )
 
+// AtLeast reports whether l is as severe as other. Unknown levels rank below Info.
+func (l AlertLevel) AtLeast(other AlertLevel) bool {
+	return l.rank() >= other.rank()
+}
+
+func (l AlertLevel) rank() int {
+	switch l {
+	case Info:
+		return 1
+	case Warning:
+		return 2
+	case Critical:
+		return 3
+	}
+	return 0
+}
+
+// ParseLevel parses a level name as written in the config, case-insensitively
+func ParseLevel(name string) (AlertLevel, bool) {
+	level := AlertLevel(strings.ToUpper(name))
+	return level, level.rank() > 0
+}
+
 type Alert struct {
 	Timestamp     time.Time
 	WalletAddress string
@@ -20,10 +49,74 @@ type Alert struct {
 	Message       string
 	Level         AlertLevel
 	Data          map[string]interface{} // Additional data for formatting
+	Destinations  []string               // Destinations chosen by an alert rule, empty when no rule picked any
 }
 
+// Key identifies an alert, the same alert delivered twice has the same key
+func (a Alert) Key() string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		a.AlertType, a.WalletAddress, a.TokenMint, strconv.FormatInt(a.Timestamp.UnixNano(), 10), a.Message,
+	}, "\x00")))
+	return hex.EncodeToString(hash[:16])
+}
+
+// Transaction is an on-chain transaction behind an alert, listed oldest first under Data["transactions"]
+type Transaction struct {
+	Signature      string
+	Slot           uint64
+	BlockTime      time.Time
+	Programs       []string // Program names, or addresses when unknown
+	Counterparties []string
+	Swap           string // Decoded trade, e.g. "BOUGHT 2.10M BONK for 14.0000 SOL via Jupiter"
+}
+
+// ConvergenceEntry is one wallet's buy in a convergence alert, listed in the order the wallets
+// entered under Data["entries"]
+type ConvergenceEntry struct {
+	WalletAddress string
+	Amount        uint64
+	USDValue      float64
+	Time          time.Time
+}
+
+// Alerter delivers alerts. Implementations should give up once ctx is done.
 type Alerter interface {
-	SendAlert(alert Alert) error
+	SendAlert(ctx context.Context, alert Alert) error
+}
+
+// RateLimitError is returned by alerters whose destination asked them to slow down. The
+// outbox waits RetryAfter before trying the destination again, instead of backing off.
+type RateLimitError struct {
+	RetryAfter time.Duration // Zero when the destination did not say
+	Err        error
+}
+
+func (e *RateLimitError) Error() string { return e.Err.Error() }
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// PartialDeliveryError is returned by an alerter with several recipients, such as the chats
+// of a Telegram bot, when only some of them got the alert. The outbox keeps Delivered and
+// leaves those recipients out of the retries.
+type PartialDeliveryError struct {
+	Delivered []string // Recipients that have the alert
+	Err       error
+}
+
+func (e *PartialDeliveryError) Error() string { return e.Err.Error() }
+func (e *PartialDeliveryError) Unwrap() error { return e.Err }
+
+// recipientAlerter is an Alerter that can leave out the recipients that already have an alert
+type recipientAlerter interface {
+	Alerter
+	sendAlertExcept(ctx context.Context, alert Alert, delivered []string) error
+}
+
+// retryAfterHeader reads the seconds a Retry-After header asks to wait, zero when there is none
+func retryAfterHeader(header http.Header) time.Duration {
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
 }
 
 // ConsoleAlerter implementation moved to console.go
@@ -1,6 +1,7 @@
 package alerts
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -10,7 +11,7 @@ import (
 // ConsoleAlerter implements basic console logging
 type ConsoleAlerter struct{}
 
-func (a *ConsoleAlerter) SendAlert(alert Alert) error {
+func (a *ConsoleAlerter) SendAlert(_ context.Context, alert Alert) error {
 	// Use colors based on alert level
 	var color, symbol string
 	switch alert.Level {
@@ -36,6 +37,14 @@ func (a *ConsoleAlerter) SendAlert(alert Alert) error {
 		alertType = "NEW TOKEN"
 	} else if alertType == "NEW_WALLET" {
 		alertType = "NEW WALLET"
+	} else if alertType == "SOL_BALANCE_CHANGE" {
+		alertType = "SOL BALANCE CHANGE"
+	} else if alertType == "TOKEN_REMOVED" {
+		alertType = "FULL EXIT"
+	} else if alertType == "WALLET_HEALTH" {
+		alertType = "WALLET HEALTH"
+	} else if alertType == "LINKED_WALLET" {
+		alertType = "LINKED WALLET"
 	}
 
 	// Draw a box around the alert
@@ -84,6 +93,19 @@ func (a *ConsoleAlerter) SendAlert(alert Alert) error {
 		}
 	}
 
+	if data, ok := alert.Data["usd_value"]; ok {
+		if value, ok := data.(float64); ok && value > 0 {
+			label := "Value"
+			switch alert.AlertType {
+			case "token_removed":
+				label = "Last known value"
+			case "new_wallet":
+				label = "Total value"
+			}
+			fmt.Printf("%s: %s\n", label, formatUSD(value))
+		}
+	}
+
 	fmt.Println(bottomBorder)
 
 	return nil
@@ -2,16 +2,27 @@ package alerts
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/accursedgalaxy/insider-monitor/internal/utils"
 )
 
+const (
+	sendTimeout = 10 * time.Second
+
+	explorerTxURL      = "https://solscan.io/tx/"
+	explorerAccountURL = "https://solscan.io/account/"
+	maxFieldLength     = 1024 // Discord's limit for an embed field value
+)
+
 type DiscordAlerter struct {
 	WebhookURL string
 	ChannelID  string
@@ -44,7 +55,7 @@ func NewDiscordAlerter(webhookURL, channelID string) *DiscordAlerter {
 	}
 }
 
-func (d *DiscordAlerter) SendAlert(alert Alert) error {
+func (d *DiscordAlerter) SendAlert(ctx context.Context, alert Alert) error {
 	color := 0x7289DA // Default Discord blue
 	switch alert.Level {
 	case Critical:
@@ -71,7 +82,6 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 				if decimals, ok := safeGet("decimals").(uint8); ok {
 					oldFormatted := utils.FormatTokenAmount(oldBal, decimals)
 					newFormatted := utils.FormatTokenAmount(newBal, decimals)
-					symbol := safeGet("symbol").(string)
 					changePercent := safeGet("change_percent").(float64)
 
 					description = fmt.Sprintf("```diff\n- Old: %s\n+ New: %s\nChange: %+.2f%%```",
@@ -83,11 +93,177 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 					fields = append(fields, field{
 						Name: "Token",
 						Value: fmt.Sprintf("%s\n`%s`",
-							symbol,
+							tokenLabel(safeGet),
 							alert.TokenMint),
 						Inline: false,
 					})
+
+					if delta, ok := safeGet("usd_change").(float64); ok && delta != 0 {
+						usdValue, _ := safeGet("usd_value").(float64)
+						fields = append(fields, field{
+							Name:   "USD Value",
+							Value:  fmt.Sprintf("%s (%s%s)", formatUSD(usdValue), signOf(delta), formatUSD(math.Abs(delta))),
+							Inline: false,
+						})
+					}
+				}
+			}
+		}
+
+	case "sol_balance_change":
+		if oldBal, ok := safeGet("old_balance").(uint64); ok {
+			if newBal, ok := safeGet("new_balance").(uint64); ok {
+				if decimals, ok := safeGet("decimals").(uint8); ok {
+					changePercent, _ := safeGet("change_percent").(float64)
+					description = fmt.Sprintf("```diff\n- Old: %s SOL\n+ New: %s SOL\nChange: %+.2f%%```",
+						utils.FormatTokenAmount(oldBal, decimals),
+						utils.FormatTokenAmount(newBal, decimals),
+						changePercent)
+
+					// Show what the move is worth, not just the new balance
+					if price, ok := safeGet("usd_price").(float64); ok && price > 0 {
+						divisor := math.Pow(10, float64(decimals))
+						delta := (float64(newBal) - float64(oldBal)) / divisor * price
+						usdValue, _ := safeGet("usd_value").(float64)
+						fields = append(fields, field{
+							Name:   "USD Value",
+							Value:  fmt.Sprintf("%s (%s%s)", formatUSD(usdValue), signOf(delta), formatUSD(math.Abs(delta))),
+							Inline: false,
+						})
+					}
+				}
+			}
+		}
+
+	case "new_wallet":
+		if holdings, ok := safeGet("holdings").([]string); ok {
+			if len(holdings) == 0 {
+				description = "```No holdings```"
+			} else {
+				description = fmt.Sprintf("```ini\n[Holdings]\n%s```", strings.Join(holdings, "\n"))
+			}
+
+			if usdValue, ok := safeGet("usd_value").(float64); ok && usdValue > 0 {
+				fields = append(fields, field{
+					Name:   "Total Value",
+					Value:  formatUSD(usdValue),
+					Inline: true,
+				})
+			}
+			if history, ok := safeGet("history").(string); ok {
+				fields = append(fields, field{
+					Name:   "History",
+					Value:  history,
+					Inline: false,
+				})
+			}
+		}
+
+	case "token_removed":
+		if oldBal, ok := safeGet("old_balance").(uint64); ok {
+			if decimals, ok := safeGet("decimals").(uint8); ok {
+				description = fmt.Sprintf("```diff\n- Sold/Moved: %s\n+ Remaining: 0\nChange: -100.00%%```",
+					utils.FormatTokenAmount(oldBal, decimals))
+
+				fields = append(fields, field{
+					Name: "Token",
+					Value: fmt.Sprintf("%s\n`%s`",
+						tokenLabel(safeGet),
+						alert.TokenMint),
+					Inline: false,
+				})
+
+				if usdValue, ok := safeGet("usd_value").(float64); ok && usdValue > 0 {
+					fields = append(fields, field{
+						Name:   "Last Known Value",
+						Value:  formatUSD(usdValue),
+						Inline: true,
+					})
+				}
+			}
+		}
+
+	case "wallet_health":
+		failures, _ := safeGet("consecutive_failures").(int)
+		if recovered, _ := safeGet("recovered").(bool); recovered {
+			description = fmt.Sprintf("```Scanning again after %d failed scans```", failures)
+		} else if errMsg, ok := safeGet("error").(string); ok {
+			description = fmt.Sprintf("```%s```", errMsg)
+			fields = append(fields, field{
+				Name:   "Failed Scans",
+				Value:  fmt.Sprintf("%d in a row", failures),
+				Inline: true,
+			})
+			if since, ok := safeGet("failing_since").(time.Time); ok {
+				fields = append(fields, field{
+					Name:   "Failing Since",
+					Value:  since.Format("2006-01-02 15:04:05 MST"),
+					Inline: true,
+				})
+			}
+		}
+
+	case "linked_wallet":
+		if amount, ok := safeGet("amount").(uint64); ok {
+			if decimals, ok := safeGet("decimals").(uint8); ok {
+				symbol, _ := safeGet("symbol").(string)
+				description = fmt.Sprintf("```ini\n[Funded With]\n%s %s```", utils.FormatTokenAmount(amount, decimals), symbol)
+			}
+		}
+		if parent, ok := safeGet("parent_wallet").(string); ok {
+			fields = append(fields, field{
+				Name:   "Funded By",
+				Value:  fmt.Sprintf("[%s](%s%s)", parent, explorerAccountURL, parent),
+				Inline: false,
+			})
+		}
+		if depth, _ := safeGet("depth").(int); depth > 1 {
+			root, _ := safeGet("root_wallet").(string)
+			fields = append(fields, field{
+				Name:   "Tracked Wallet",
+				Value:  fmt.Sprintf("`%s` (%d hops)", root, depth),
+				Inline: false,
+			})
+		}
+		status := "Proposed, add it to the config to monitor it"
+		if monitored, _ := safeGet("monitored").(bool); monitored {
+			status = "Monitoring"
+		}
+		fields = append(fields, field{
+			Name:   "Status",
+			Value:  status,
+			Inline: true,
+		})
+
+	case "convergence":
+		if entries, ok := safeGet("entries").([]ConvergenceEntry); ok {
+			decimals, _ := safeGet("decimals").(uint8)
+			symbol, _ := safeGet("symbol").(string)
+			var lines []string
+			for i, entry := range entries {
+				line := fmt.Sprintf("%d. [%s](%s%s) · %s %s", i+1, shortAddress(entry.WalletAddress),
+					explorerAccountURL, entry.WalletAddress, utils.FormatTokenAmount(entry.Amount, decimals), symbol)
+				if entry.USDValue > 0 {
+					line += " (" + formatUSD(entry.USDValue) + ")"
 				}
+				line += " · " + entry.Time.UTC().Format("15:04:05")
+				lines = append(lines, line)
+			}
+			description = strings.Join(lines, "\n")
+
+			fields = append(fields, field{
+				Name: "Token",
+				Value: fmt.Sprintf("%s\n`%s`",
+					tokenLabel(safeGet),
+					alert.TokenMint),
+				Inline: false,
+			})
+			if span, ok := safeGet("span").(time.Duration); ok {
+				fields = append(fields, field{
+					Name:   "Within",
+					Value:  span.Round(time.Second).String(),
+					Inline: true,
+				})
 			}
 		}
 
@@ -95,7 +271,6 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 		if balance, ok := safeGet("balance").(uint64); ok {
 			if decimals, ok := safeGet("decimals").(uint8); ok {
 				formatted := utils.FormatTokenAmount(balance, decimals)
-				symbol := safeGet("symbol").(string)
 				description = fmt.Sprintf("```ini\n[Initial Balance]\n%s```",
 					formatted)
 
@@ -103,7 +278,7 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 				fields = append(fields, field{
 					Name: "Token",
 					Value: fmt.Sprintf("%s\n`%s`",
-						symbol,
+						tokenLabel(safeGet),
 						alert.TokenMint),
 					Inline: false,
 				})
@@ -111,11 +286,49 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 		}
 	}
 
+	// Flag Token-2022 extensions that affect how the token can be moved
+	if flags, ok := safeGet("token_flags").([]string); ok && len(flags) > 0 {
+		fields = append(fields, field{
+			Name:   "⚠️ Token-2022",
+			Value:  strings.Join(flags, "\n"),
+			Inline: false,
+		})
+	}
+
+	// Alerts on discovered wallets say which tracked wallet they came from
+	if linked, ok := safeGet("linked_from").(string); ok {
+		fields = append(fields, field{
+			Name:   "🔗 Linked Wallet",
+			Value:  linked,
+			Inline: false,
+		})
+	}
+
 	// If we failed to generate a description, use a fallback
 	if description == "" {
 		description = fmt.Sprintf("```%s```", alert.Message)
 	}
 
+	// Link the transactions behind the change so they don't have to be looked up by hand
+	if txs, ok := safeGet("transactions").([]Transaction); ok && len(txs) > 0 {
+		// Decoded trades say more than a percentage, lead with them
+		var trades []string
+		for _, tx := range txs {
+			if tx.Swap != "" {
+				trades = append(trades, "**"+tx.Swap+"**")
+			}
+		}
+		if len(trades) > 0 {
+			description = strings.Join(trades, "\n") + "\n" + description
+		}
+
+		fields = append(fields, field{
+			Name:   "Transactions",
+			Value:  transactionLinks(txs),
+			Inline: false,
+		})
+	}
+
 	// Add wallet address as a field
 	fields = append(fields, field{
 		Name:   "Wallet",
@@ -133,7 +346,7 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 	msg := discordMessage{
 		Username: "Solana Wallet Monitor",
 		Embeds: []embed{{
-			Title:       fmt.Sprintf("%s Alert", strings.ToUpper(alert.AlertType)),
+			Title:       alertTitle(alert.AlertType),
 			Description: description,
 			Color:       color,
 			Fields:      fields,
@@ -147,17 +360,126 @@ func (d *DiscordAlerter) SendAlert(alert Alert) error {
 
 	log.Printf("Sending Discord alert: %s", string(payload))
 
-	resp, err := http.Post(d.WebhookURL, "application/json", bytes.NewBuffer(payload))
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewBuffer(payload))
 	if err != nil {
-		return fmt.Errorf("failed to send discord message: %w", err)
+		return fmt.Errorf("failed to create discord request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Webhook URLs are secrets and errors end up in the outbox, keep them out
+		return fmt.Errorf("failed to send discord message: %w", unwrapURLError(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("discord API returned error status: %d, body: %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("discord API returned error status: %d, body: %s", resp.StatusCode, string(body))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &RateLimitError{RetryAfter: discordRetryAfter(resp.Header, body), Err: err}
+		}
+		return err
 	}
 
 	log.Printf("Successfully sent Discord alert (status: %d)", resp.StatusCode)
 	return nil
 }
+
+// discordRetryAfter reads how long a rate limited webhook has to wait, from the retry_after
+// seconds in the body or the Retry-After header
+func discordRetryAfter(header http.Header, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &limited); err == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+	return retryAfterHeader(header)
+}
+
+// alertTitle is the headline of an alert in chat destinations
+func alertTitle(alertType string) string {
+	switch alertType {
+	case "token_removed":
+		return "🚨 FULL EXIT Alert"
+	case "wallet_health":
+		return "🩺 Wallet Health Alert"
+	case "linked_wallet":
+		return "🔗 Linked Wallet Alert"
+	case "convergence":
+		return "🎯 CONVERGENCE Alert"
+	}
+	return fmt.Sprintf("%s Alert", strings.ToUpper(alertType))
+}
+
+// tokenLabel renders "**Name** (SYMBOL)" when the mint has metadata, otherwise just the symbol
+func tokenLabel(get func(string) interface{}) string {
+	symbol, _ := get("symbol").(string)
+	name, _ := get("name").(string)
+	if name != "" && name != symbol {
+		return fmt.Sprintf("**%s** (%s)", name, symbol)
+	}
+	return symbol
+}
+
+// transactionLinks renders one line per transaction, newest first, with explorer links for the
+// signature and the main counterparty, and the decoded trade when it was a swap. Lines that would overflow the field are dropped.
+func transactionLinks(txs []Transaction) string {
+	var lines []string
+	length := 0
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+		line := fmt.Sprintf("[%s](%s%s)", shortAddress(tx.Signature), explorerTxURL, tx.Signature)
+		if !tx.BlockTime.IsZero() {
+			line += " " + tx.BlockTime.UTC().Format("15:04:05")
+		}
+		switch {
+		case tx.Swap != "":
+			line += " · **" + tx.Swap + "**"
+		case len(tx.Programs) > 0:
+			line += " · " + strings.Join(tx.Programs, ", ")
+		}
+		if len(tx.Counterparties) > 0 {
+			counterparty := tx.Counterparties[0]
+			line += fmt.Sprintf(" · [%s](%s%s)", shortAddress(counterparty), explorerAccountURL, counterparty)
+		}
+
+		if length+len(line)+1 > maxFieldLength {
+			break
+		}
+		lines = append(lines, line)
+		length += len(line) + 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// shortAddress abbreviates a signature or address to its first and last four characters
+func shortAddress(value string) string {
+	if len(value) <= 12 {
+		return value
+	}
+	return value[:4] + "…" + value[len(value)-4:]
+}
+
+// formatUSD renders a dollar amount with K/M suffixes
+func formatUSD(value float64) string {
+	switch {
+	case value >= 1000000:
+		return fmt.Sprintf("$%.2fM", value/1000000)
+	case value >= 1000:
+		return fmt.Sprintf("$%.2fK", value/1000)
+	default:
+		return fmt.Sprintf("$%.2f", value)
+	}
+}
+
+func signOf(value float64) string {
+	if value < 0 {
+		return "-"
+	}
+	return "+"
+}
@@ -0,0 +1,63 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileAlerter appends every alert to a file as a line of JSON
+type FileAlerter struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// fileRecord is the JSON line written per alert
+type fileRecord struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	Level         AlertLevel             `json:"level"`
+	AlertType     string                 `json:"alert_type"`
+	WalletAddress string                 `json:"wallet_address,omitempty"`
+	TokenMint     string                 `json:"token_mint,omitempty"`
+	Message       string                 `json:"message"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+}
+
+func NewFileAlerter(path string) *FileAlerter {
+	return &FileAlerter{Path: path}
+}
+
+func (f *FileAlerter) SendAlert(_ context.Context, alert Alert) error {
+	line, err := json.Marshal(fileRecord{
+		Timestamp:     alert.Timestamp,
+		Level:         alert.Level,
+		AlertType:     alert.AlertType,
+		WalletAddress: alert.WalletAddress,
+		TokenMint:     alert.TokenMint,
+		Message:       alert.Message,
+		Data:          alert.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create alert log directory: %w", err)
+	}
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open alert log: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write alert log: %w", err)
+	}
+	return file.Close()
+}
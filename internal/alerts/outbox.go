@@ -0,0 +1,583 @@
+package alerts
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	outboxFile     = "outbox.jsonl"
+	deadLetterFile = "dead_letter.jsonl"
+
+	defaultOutboxAttempts   = 8
+	defaultOutboxBackoff    = 5 * time.Second
+	defaultOutboxMaxBackoff = 10 * time.Minute
+	outboxSendTimeout       = 30 * time.Second // Per delivery pass of one alert
+)
+
+// OutboxOptions configures how an Outbox retries
+type OutboxOptions struct {
+	MaxAttempts int           // Failed attempts per destination before the alert is dead-lettered, default 8
+	Backoff     time.Duration // Wait after the first failure, doubled after each further one, default 5s
+	MaxBackoff  time.Duration // Longest wait between attempts, default 10m
+}
+
+// Outbox is an Alerter that writes alerts to disk before they are delivered through a Router.
+// Run delivers each alert to each of its destinations and retries the ones that failed with
+// exponential backoff, or after the wait a rate limited destination asked for. An alert that
+// runs out of attempts on a destination moves to the dead-letter file, Replay puts it back.
+// Alerts that are still pending are delivered after a restart.
+type Outbox struct {
+	dir     string
+	router  *Router
+	options OutboxOptions
+
+	mu      sync.Mutex
+	entries []*outboxEntry
+	held    map[string]time.Time // Failing or rate limited destination -> when it can be tried again
+	wake    chan struct{}
+
+	deliverMu sync.Mutex // One delivery pass at a time
+}
+
+// outboxEntry is an alert and the destinations it has not reached yet, a line of the outbox file
+type outboxEntry struct {
+	Alert      storedAlert       `json:"alert"`
+	Deliveries []*outboxDelivery `json:"deliveries"`
+
+	alert Alert
+}
+
+type outboxDelivery struct {
+	Destination string    `json:"destination"`
+	Attempts    int       `json:"attempts"` // Failed attempts, rate limited ones are not counted
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	Delivered   []string  `json:"delivered,omitempty"` // Recipients of the destination that have the alert
+}
+
+// deadLetter is an alert a destination kept failing, a line of the dead-letter file
+type deadLetter struct {
+	Alert       storedAlert `json:"alert"`
+	Destination string      `json:"destination"`
+	Attempts    int         `json:"attempts"`
+	LastError   string      `json:"last_error"`
+	FailedAt    time.Time   `json:"failed_at"`
+	Delivered   []string    `json:"delivered,omitempty"`
+}
+
+// NewOutbox opens the outbox in dir, loading the alerts a previous run left pending
+func NewOutbox(dir string, router *Router, options OutboxOptions) (*Outbox, error) {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultOutboxAttempts
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = defaultOutboxBackoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultOutboxMaxBackoff
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	o := &Outbox{
+		dir:     dir,
+		router:  router,
+		options: options,
+		held:    make(map[string]time.Time),
+		wake:    make(chan struct{}, 1),
+	}
+	lines, err := readLines(filepath.Join(dir, outboxFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	for _, line := range lines {
+		var entry outboxEntry
+		if err := json.Unmarshal(line, &entry); err != nil || len(entry.Deliveries) == 0 {
+			continue
+		}
+		entry.alert = entry.Alert.restore()
+		o.entries = append(o.entries, &entry)
+	}
+	return o, nil
+}
+
+// SendAlert writes the alert to the outbox and leaves its delivery to Run. When the outbox
+// cannot be written, the alert is delivered right away instead.
+func (o *Outbox) SendAlert(ctx context.Context, alert Alert) error {
+	names := o.router.Destinations(alert)
+	if len(names) == 0 {
+		log.Printf("⚠️ No destination for %s alert on %s, it is only logged: %s", alert.AlertType, alert.WalletAddress, alert.Message)
+		return nil
+	}
+
+	stored, err := storeAlert(alert)
+	if err == nil {
+		entry := &outboxEntry{Alert: stored, alert: alert}
+		now := time.Now()
+		for _, name := range names {
+			entry.Deliveries = append(entry.Deliveries, &outboxDelivery{Destination: name, NextAttempt: now})
+		}
+
+		o.mu.Lock()
+		o.entries = append(o.entries, entry)
+		err = o.save()
+		if err != nil {
+			o.entries = o.entries[:len(o.entries)-1]
+		}
+		o.mu.Unlock()
+	}
+	if err != nil {
+		log.Printf("⚠️ Could not write alert to the outbox, sending it without retries: %v", err)
+		return o.router.SendAlert(ctx, alert)
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the number of alerts waiting for at least one destination
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Run delivers alerts as they are written and retries failed deliveries when they are due,
+// until ctx is done
+func (o *Outbox) Run(ctx context.Context) {
+	for {
+		wait := time.Hour
+		if next := o.Flush(ctx); !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Drain delivers until no alert is pending anymore, each one delivered or dead-lettered
+func (o *Outbox) Drain(ctx context.Context) error {
+	for {
+		next := o.Flush(ctx)
+		if next.IsZero() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// Flush makes one delivery attempt for every delivery that is due, and returns when the next
+// one will be, zero when nothing is pending
+func (o *Outbox) Flush(ctx context.Context) time.Time {
+	o.deliverMu.Lock()
+	defer o.deliverMu.Unlock()
+
+	o.mu.Lock()
+	entries := append([]*outboxEntry(nil), o.entries...)
+	o.mu.Unlock()
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		o.mu.Lock()
+		names := o.due(entry, time.Now())
+		delivered := make(map[string][]string)
+		for _, delivery := range entry.Deliveries {
+			if len(delivery.Delivered) > 0 {
+				delivered[delivery.Destination] = append([]string(nil), delivery.Delivered...)
+			}
+		}
+		o.mu.Unlock()
+		if len(names) == 0 {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+		results := o.router.deliver(sendCtx, entry.alert, names, delivered)
+		cancel()
+		var counted []DeliveryResult
+		for _, result := range results {
+			// Cut short by shutdown, that is no attempt
+			if result.Err == nil || ctx.Err() == nil {
+				counted = append(counted, result)
+			}
+		}
+		o.record(entry, counted)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.next()
+}
+
+// due returns the destinations of the entry that can be tried now
+func (o *Outbox) due(entry *outboxEntry, now time.Time) []string {
+	var names []string
+	for _, delivery := range entry.Deliveries {
+		if delivery.NextAttempt.After(now) || o.held[delivery.Destination].After(now) {
+			continue
+		}
+		names = append(names, delivery.Destination)
+	}
+	return names
+}
+
+// record applies the results of a delivery pass to the entry and saves the outbox
+func (o *Outbox) record(entry *outboxEntry, results []DeliveryResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for _, result := range results {
+		i := deliveryIndex(entry.Deliveries, result.Destination)
+		if i < 0 {
+			continue
+		}
+		delivery := entry.Deliveries[i]
+		if result.Err == nil {
+			log.Printf("✅ Alert sent to %s in %v", result.Destination, result.Duration.Round(time.Millisecond))
+			entry.Deliveries = append(entry.Deliveries[:i], entry.Deliveries[i+1:]...)
+			continue
+		}
+
+		delivery.LastError = result.Err.Error()
+		var partial *PartialDeliveryError
+		if errors.As(result.Err, &partial) {
+			delivery.Delivered = append(delivery.Delivered, partial.Delivered...)
+		}
+		var limited *RateLimitError
+		if errors.As(result.Err, &limited) && limited.RetryAfter > 0 {
+			// Honoured as asked, it says nothing about whether the alert can be delivered
+			delivery.NextAttempt = now.Add(limited.RetryAfter)
+			o.held[result.Destination] = delivery.NextAttempt
+			log.Printf("⏳ %s is rate limited, retrying in %v", result.Destination, limited.RetryAfter.Round(time.Millisecond))
+			continue
+		}
+
+		// The other alerts for a failing destination wait a moment, rather than all trying at once
+		if held := now.Add(o.options.Backoff); held.After(o.held[result.Destination]) {
+			o.held[result.Destination] = held
+		}
+		delivery.Attempts++
+		if delivery.Attempts >= o.options.MaxAttempts {
+			log.Printf("⚠️ Alert to %s failed %d times, moving it to the dead-letter file: %v", result.Destination, delivery.Attempts, result.Err)
+			if err := o.deadLetter(entry, delivery, now); err != nil {
+				// Keep it in the outbox, losing the alert is worse than trying it once more
+				log.Printf("⚠️ Could not write the dead-letter file: %v", err)
+				delivery.NextAttempt = now.Add(o.options.MaxBackoff)
+				continue
+			}
+			entry.Deliveries = append(entry.Deliveries[:i], entry.Deliveries[i+1:]...)
+			continue
+		}
+		backoff := o.backoff(delivery.Attempts)
+		delivery.NextAttempt = now.Add(backoff)
+		log.Printf("⏳ Alert to %s failed (attempt %d of %d), retrying in %v: %v",
+			result.Destination, delivery.Attempts, o.options.MaxAttempts, backoff, result.Err)
+	}
+
+	if len(entry.Deliveries) == 0 {
+		for i, e := range o.entries {
+			if e == entry {
+				o.entries = append(o.entries[:i], o.entries[i+1:]...)
+				break
+			}
+		}
+	}
+	if err := o.save(); err != nil {
+		log.Printf("⚠️ Could not save the outbox: %v", err)
+	}
+}
+
+// next returns when the earliest pending delivery is due
+func (o *Outbox) next() time.Time {
+	var next time.Time
+	for _, entry := range o.entries {
+		for _, delivery := range entry.Deliveries {
+			at := delivery.NextAttempt
+			if held := o.held[delivery.Destination]; held.After(at) {
+				at = held
+			}
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+		}
+	}
+	return next
+}
+
+// backoff is the wait after the given number of failed attempts
+func (o *Outbox) backoff(attempts int) time.Duration {
+	backoff := o.options.Backoff
+	for i := 1; i < attempts && backoff < o.options.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, o.options.MaxBackoff)
+}
+
+// Replay moves the dead-lettered alerts of a destination, or of all destinations when it is
+// empty, back into the outbox with fresh attempts. It returns how many were moved.
+func (o *Outbox) Replay(destination string) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path := filepath.Join(o.dir, deadLetterFile)
+	lines, err := readLines(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+
+	var kept bytes.Buffer
+	replayed := 0
+	now := time.Now()
+	for _, line := range lines {
+		var letter deadLetter
+		if err := json.Unmarshal(line, &letter); err != nil {
+			continue
+		}
+		if destination != "" && letter.Destination != destination {
+			kept.Write(line)
+			kept.WriteByte('\n')
+			continue
+		}
+		o.entries = append(o.entries, &outboxEntry{
+			Alert:      letter.Alert,
+			Deliveries: []*outboxDelivery{{Destination: letter.Destination, NextAttempt: now, Delivered: letter.Delivered}},
+			alert:      letter.Alert.restore(),
+		})
+		replayed++
+	}
+	if replayed == 0 {
+		return 0, nil
+	}
+
+	// The outbox is saved first, a crash in between replays an alert twice rather than never
+	if err := o.save(); err != nil {
+		o.entries = o.entries[:len(o.entries)-replayed]
+		return 0, err
+	}
+	if err := writeFileSynced(path, kept.Bytes()); err != nil {
+		return replayed, fmt.Errorf("failed to rewrite dead-letter file: %w", err)
+	}
+	return replayed, nil
+}
+
+// deadLetter appends the failed delivery to the dead-letter file
+func (o *Outbox) deadLetter(entry *outboxEntry, delivery *outboxDelivery, now time.Time) error {
+	line, err := json.Marshal(deadLetter{
+		Alert:       entry.Alert,
+		Destination: delivery.Destination,
+		Attempts:    delivery.Attempts,
+		LastError:   delivery.LastError,
+		FailedAt:    now,
+		Delivered:   delivery.Delivered,
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(o.dir, deadLetterFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// save rewrites the outbox file with the pending entries
+func (o *Outbox) save() error {
+	var buf bytes.Buffer
+	for _, entry := range o.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode outbox entry: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileSynced(filepath.Join(o.dir, outboxFile), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	return nil
+}
+
+// writeFileSynced replaces the file through a rename, after syncing the new content to disk, so
+// a crash or power loss leaves either the old or the new file
+func writeFileSynced(path string, data []byte) error {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readLines returns the non-empty lines of a file, none when it does not exist
+func readLines(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func deliveryIndex(deliveries []*outboxDelivery, destination string) int {
+	for i, delivery := range deliveries {
+		if delivery.Destination == destination {
+			return i
+		}
+	}
+	return -1
+}
+
+// storedAlert is an alert as written to the outbox. Data values keep their Go type next to
+// them, so alerters get a uint64 back rather than the float64 JSON would make of it.
+type storedAlert struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	Level         AlertLevel             `json:"level"`
+	AlertType     string                 `json:"alert_type"`
+	WalletAddress string                 `json:"wallet_address,omitempty"`
+	TokenMint     string                 `json:"token_mint,omitempty"`
+	Message       string                 `json:"message"`
+	Data          map[string]storedValue `json:"data,omitempty"`
+}
+
+type storedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// dataTypes are the types alerts put in Data, by name. Values of other types come back as
+// whatever encoding/json decodes them to.
+var dataTypes = make(map[string]func() interface{})
+
+func registerDataType[T any]() {
+	dataTypes[reflect.TypeOf(new(T)).Elem().String()] = func() interface{} { return new(T) }
+}
+
+func init() {
+	registerDataType[string]()
+	registerDataType[bool]()
+	registerDataType[int]()
+	registerDataType[uint8]()
+	registerDataType[uint64]()
+	registerDataType[float64]()
+	registerDataType[time.Time]()
+	registerDataType[time.Duration]()
+	registerDataType[[]string]()
+	registerDataType[[]Transaction]()
+	registerDataType[[]ConvergenceEntry]()
+	registerDataType[map[string]string]()
+	registerDataType[map[string]uint8]()
+	registerDataType[map[string]uint64]()
+	registerDataType[map[string]float64]()
+}
+
+func storeAlert(alert Alert) (storedAlert, error) {
+	stored := storedAlert{
+		Timestamp:     alert.Timestamp,
+		Level:         alert.Level,
+		AlertType:     alert.AlertType,
+		WalletAddress: alert.WalletAddress,
+		TokenMint:     alert.TokenMint,
+		Message:       alert.Message,
+	}
+	for key, value := range alert.Data {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return storedAlert{}, fmt.Errorf("failed to encode alert data %s: %w", key, err)
+		}
+		if stored.Data == nil {
+			stored.Data = make(map[string]storedValue, len(alert.Data))
+		}
+		var typeName string
+		if value != nil {
+			typeName = reflect.TypeOf(value).String()
+		}
+		stored.Data[key] = storedValue{Type: typeName, Value: raw}
+	}
+	return stored, nil
+}
+
+func (s storedAlert) restore() Alert {
+	alert := Alert{
+		Timestamp:     s.Timestamp,
+		Level:         s.Level,
+		AlertType:     s.AlertType,
+		WalletAddress: s.WalletAddress,
+		TokenMint:     s.TokenMint,
+		Message:       s.Message,
+	}
+	if len(s.Data) > 0 {
+		alert.Data = make(map[string]interface{}, len(s.Data))
+	}
+	for key, value := range s.Data {
+		if newValue, ok := dataTypes[value.Type]; ok {
+			target := newValue()
+			if err := json.Unmarshal(value.Value, target); err == nil {
+				alert.Data[key] = reflect.ValueOf(target).Elem().Interface()
+				continue
+			}
+		}
+		var generic interface{}
+		_ = json.Unmarshal(value.Value, &generic)
+		alert.Data[key] = generic
+	}
+	return alert
+}
@@ -0,0 +1,126 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fastRetries = OutboxOptions{MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestOutboxSurvivesRestartAndDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	up, down := &recordingAlerter{}, &recordingAlerter{err: errors.New("webhook is down")}
+	router := NewRouter([]Destination{{Name: "up", Alerter: up}, {Name: "down", Alerter: down}}, nil)
+
+	outbox, err := NewOutbox(dir, router, fastRetries)
+	require.NoError(t, err)
+	alert := slackBalanceAlert(Critical, slackWallet)
+	alert.Data["transactions"] = []Transaction{{Signature: "5sig", Slot: 42, BlockTime: alert.Timestamp}}
+	alert.Data["window"] = time.Hour
+	require.NoError(t, outbox.SendAlert(context.Background(), alert))
+	assert.Zero(t, up.count(), "sending only writes the outbox")
+
+	// A restart picks the alert up again, with the Go types of its data
+	outbox, err = NewOutbox(dir, router, fastRetries)
+	require.NoError(t, err)
+	require.Equal(t, 1, outbox.Pending())
+	require.NoError(t, outbox.Drain(context.Background()))
+
+	require.Equal(t, 1, up.count())
+	delivered := up.alerts[0]
+	assert.Equal(t, alert.Key(), delivered.Key())
+	assert.Equal(t, uint64(3_000_000), delivered.Data["new_balance"])
+	assert.Equal(t, uint8(5), delivered.Data["decimals"])
+	assert.Equal(t, 100.0, delivered.Data["change_percent"])
+	assert.Equal(t, time.Hour, delivered.Data["window"])
+	assert.Equal(t, uint64(42), delivered.Data["transactions"].([]Transaction)[0].Slot)
+
+	// The failing destination ran out of attempts, its copy waits in the dead-letter file
+	assert.Zero(t, outbox.Pending())
+	letters, err := os.ReadFile(filepath.Join(dir, deadLetterFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(letters), `"destination":"down","attempts":2,"last_error":"webhook is down"`)
+
+	// Replaying only sends it to the destination that failed
+	down.err = nil
+	replayed, err := outbox.Replay("down")
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	require.NoError(t, outbox.Drain(context.Background()))
+	assert.Equal(t, 1, down.count())
+	assert.Equal(t, 1, up.count())
+	letters, err = os.ReadFile(filepath.Join(dir, deadLetterFile))
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestOutboxHonoursDiscordRateLimits(t *testing.T) {
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.05, "global": false}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	router := NewRouter([]Destination{{Name: "discord", Alerter: NewDiscordAlerter(server.URL, "")}}, nil)
+
+	// Rate limits do not use up attempts, one is all it gets here
+	outbox, err := NewOutbox(t.TempDir(), router, OutboxOptions{MaxAttempts: 1, Backoff: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, outbox.SendAlert(context.Background(), slackBalanceAlert(Warning, slackWallet)))
+	require.NoError(t, outbox.Drain(context.Background()))
+
+	require.Len(t, attempts, 2)
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 50*time.Millisecond)
+}
+
+func TestOutboxRetriesOnlyFailedTelegramChats(t *testing.T) {
+	var mu sync.Mutex
+	sent := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg telegramMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		mu.Lock()
+		defer mu.Unlock()
+		sent[msg.ChatID]++
+		if msg.ChatID == "-100flaky" && sent[msg.ChatID] == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":500,"description":"Internal Server Error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer server.Close()
+	telegram := NewTelegramAlerter("TOKEN", []TelegramChat{{ChatID: "-100team"}, {ChatID: "-100flaky", ThreadID: 3}})
+	telegram.APIURL = server.URL
+	router := NewRouter([]Destination{{Name: "telegram", Alerter: telegram}}, nil)
+
+	dir := t.TempDir()
+	outbox, err := NewOutbox(dir, router, fastRetries)
+	require.NoError(t, err)
+	require.NoError(t, outbox.SendAlert(context.Background(), slackBalanceAlert(Warning, slackWallet)))
+	outbox.Flush(context.Background())
+	assert.Equal(t, map[string]int{"-100team": 1, "-100flaky": 1}, sent)
+
+	// The chats that have the alert are remembered across a restart
+	outbox, err = NewOutbox(dir, router, fastRetries)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Drain(context.Background()))
+	assert.Equal(t, map[string]int{"-100team": 1, "-100flaky": 2}, sent)
+	assert.Zero(t, outbox.Pending())
+}
@@ -0,0 +1,187 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Destination is a named alerter that routes and alert rules refer to
+type Destination struct {
+	Name    string
+	Alerter Alerter
+}
+
+// Route sends the alerts it matches to its destinations. Every condition that is set has to
+// match, a route without conditions matches every alert.
+type Route struct {
+	Levels       []AlertLevel
+	Types        []string
+	Wallets      []string // Nil matches every wallet, alerts on wallets linked from one of these match as well
+	Mints        []string
+	Destinations []string
+}
+
+func (r Route) matches(alert Alert) bool {
+	if len(r.Levels) > 0 && !containsLevel(r.Levels, alert.Level) {
+		return false
+	}
+	if len(r.Types) > 0 && !contains(r.Types, alert.AlertType) {
+		return false
+	}
+	if r.Wallets != nil && !contains(r.Wallets, alert.WalletAddress) {
+		root, _ := alert.Data["root_wallet"].(string)
+		if root == "" || !contains(r.Wallets, root) {
+			return false
+		}
+	}
+	if len(r.Mints) > 0 && !contains(r.Mints, alert.TokenMint) {
+		return false
+	}
+	return true
+}
+
+// DeliveryResult is the outcome of sending an alert to one destination
+type DeliveryResult struct {
+	Destination string
+	Err         error
+	Duration    time.Duration
+}
+
+// Router is an Alerter that fans alerts out to several destinations at once. Destinations
+// picked by an alert rule take precedence over the routes, without routes every alert goes
+// everywhere. Destinations are sent to concurrently, a slow or failing one does not hold up
+// or prevent delivery to the others.
+type Router struct {
+	destinations []Destination
+	routes       []Route
+}
+
+func NewRouter(destinations []Destination, routes []Route) *Router {
+	return &Router{destinations: destinations, routes: routes}
+}
+
+// Destinations returns the names of the destinations an alert is sent to, in configuration order
+func (r *Router) Destinations(alert Alert) []string {
+	selected := make(map[string]bool)
+	switch {
+	case len(alert.Destinations) > 0:
+		for _, name := range alert.Destinations {
+			selected[name] = true
+		}
+	case len(r.routes) == 0:
+		for _, destination := range r.destinations {
+			selected[destination.Name] = true
+		}
+	default:
+		for _, route := range r.routes {
+			if route.matches(alert) {
+				for _, name := range route.Destinations {
+					selected[name] = true
+				}
+			}
+		}
+	}
+
+	var names []string
+	for _, destination := range r.destinations {
+		if selected[destination.Name] {
+			names = append(names, destination.Name)
+		}
+	}
+	return names
+}
+
+// Deliver sends the alert to each of its destinations and returns every destination's result
+func (r *Router) Deliver(ctx context.Context, alert Alert) []DeliveryResult {
+	return r.DeliverTo(ctx, alert, r.Destinations(alert))
+}
+
+// DeliverTo sends the alert to the named destinations, regardless of routes
+func (r *Router) DeliverTo(ctx context.Context, alert Alert, names []string) []DeliveryResult {
+	return r.deliver(ctx, alert, names, nil)
+}
+
+// deliver sends the alert to the named destinations, leaving out the recipients of each
+// destination that already have it
+func (r *Router) deliver(ctx context.Context, alert Alert, names []string, delivered map[string][]string) []DeliveryResult {
+	results := make([]DeliveryResult, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		alerter := r.alerter(name)
+		if alerter == nil {
+			// Destinations can be renamed or removed while alerts wait in the outbox
+			results[i] = DeliveryResult{Destination: name, Err: fmt.Errorf("destination %s is not configured", name)}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			start := time.Now()
+			var err error
+			if partial, ok := alerter.(recipientAlerter); ok && len(delivered[name]) > 0 {
+				err = partial.sendAlertExcept(ctx, alert, delivered[name])
+			} else {
+				err = alerter.SendAlert(ctx, alert)
+			}
+			results[i] = DeliveryResult{Destination: name, Err: err, Duration: time.Since(start)}
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// SendAlert delivers the alert and logs each destination's result. It fails when any
+// destination failed, naming them all.
+func (r *Router) SendAlert(ctx context.Context, alert Alert) error {
+	results := r.Deliver(ctx, alert)
+	if len(results) == 0 {
+		log.Printf("⚠️ No destination for %s alert on %s, it is only logged: %s", alert.AlertType, alert.WalletAddress, alert.Message)
+		return nil
+	}
+
+	var failures []string
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("⚠️ Alert to %s failed after %v: %v", result.Destination, result.Duration.Round(time.Millisecond), result.Err)
+			failures = append(failures, fmt.Sprintf("%s: %v", result.Destination, result.Err))
+		} else {
+			log.Printf("✅ Alert sent to %s in %v", result.Destination, result.Duration.Round(time.Millisecond))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d destinations failed: %s", len(failures), len(results), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (r *Router) alerter(name string) Alerter {
+	for _, destination := range r.destinations {
+		if destination.Name == name {
+			return destination.Alerter
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLevel(levels []AlertLevel, level AlertLevel) bool {
+	for _, l := range levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAlerter keeps the alerts it is sent, or fails them all with err
+type recordingAlerter struct {
+	mu     sync.Mutex
+	alerts []Alert
+	err    error
+	delay  time.Duration
+}
+
+func (r *recordingAlerter) SendAlert(ctx context.Context, alert Alert) error {
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func (r *recordingAlerter) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.alerts)
+}
+
+func TestRouterRoutesAlerts(t *testing.T) {
+	const insider, linked, bonk = "insider", "linked", "bonk"
+	pager, discord, console := &recordingAlerter{}, &recordingAlerter{}, &recordingAlerter{}
+	router := NewRouter([]Destination{
+		{Name: "console", Alerter: console},
+		{Name: "discord", Alerter: discord},
+		{Name: "pager", Alerter: pager},
+	}, []Route{
+		{Levels: []AlertLevel{Critical}, Destinations: []string{"pager", "discord"}},
+		{Types: []string{"new_token"}, Wallets: []string{insider}, Destinations: []string{"discord"}},
+		{Mints: []string{bonk}, Destinations: []string{"pager"}},
+		{Destinations: []string{"console"}},
+	})
+
+	tests := []struct {
+		name  string
+		alert Alert
+		want  []string
+	}{
+		{"critical", Alert{Level: Critical, AlertType: "token_removed"}, []string{"console", "discord", "pager"}},
+		{"warning", Alert{Level: Warning, AlertType: "new_token", WalletAddress: "someone"}, []string{"console"}},
+		{"insider buy", Alert{Level: Warning, AlertType: "new_token", WalletAddress: insider}, []string{"console", "discord"}},
+		{"linked from insider", Alert{Level: Warning, AlertType: "new_token", WalletAddress: linked,
+			Data: map[string]interface{}{"root_wallet": insider}}, []string{"console", "discord"}},
+		{"mint", Alert{Level: Info, AlertType: "balance_change", TokenMint: bonk}, []string{"console", "pager"}},
+		{"picked by a rule", Alert{Level: Critical, Destinations: []string{"console"}}, []string{"console"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, router.Destinations(tt.alert))
+		})
+	}
+
+	// Without routes everything goes everywhere
+	assert.Equal(t, []string{"console", "discord", "pager"}, NewRouter(router.destinations, nil).Destinations(Alert{Level: Info}))
+}
+
+func TestRouterIsolatesFailures(t *testing.T) {
+	failing := &recordingAlerter{err: errors.New("webhook returned 500")}
+	slow := &recordingAlerter{delay: 50 * time.Millisecond}
+	healthy := &recordingAlerter{}
+	file := NewFileAlerter(filepath.Join(t.TempDir(), "alerts", "alerts.jsonl"))
+	router := NewRouter([]Destination{
+		{Name: "failing", Alerter: failing},
+		{Name: "slow", Alerter: slow},
+		{Name: "healthy", Alerter: healthy},
+		{Name: "file", Alerter: file},
+	}, nil)
+
+	alert := Alert{Timestamp: time.Now(), Level: Critical, AlertType: "new_token", Message: "New token",
+		Data: map[string]interface{}{"balance": uint64(42)}}
+	results := router.Deliver(context.Background(), alert)
+	require.Len(t, results, 4)
+	assert.Equal(t, "failing", results[0].Destination)
+	assert.Error(t, results[0].Err)
+	for _, result := range results[1:] {
+		assert.NoError(t, result.Err, result.Destination)
+	}
+	assert.Equal(t, 1, slow.count())
+	assert.Equal(t, 1, healthy.count())
+
+	err := router.SendAlert(context.Background(), alert)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 4 destinations failed: failing: webhook returned 500")
+	assert.Equal(t, 2, healthy.count())
+
+	// The file holds one JSON line per alert
+	data, err := os.ReadFile(file.Path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var record fileRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, Critical, record.Level)
+	assert.Equal(t, float64(42), record.Data["balance"])
+}
@@ -0,0 +1,347 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/utils"
+)
+
+const (
+	slackAPIURL           = "https://slack.com/api"
+	maxSlackSectionLength = 3000 // Slack's limit for the text of a section block, in characters
+)
+
+// SlackAlerter posts alerts as Block Kit messages, through an incoming webhook or with a bot
+// token through chat.postMessage. Only the bot can thread: with ThreadByWallet, each wallet's
+// first alert starts a thread and its later alerts are posted as replies, critical ones also
+// to the channel. Threads are kept in memory, a restart starts new ones.
+type SlackAlerter struct {
+	WebhookURL     string
+	Token          string // Bot token, used instead of the webhook when set
+	Channel        string // Channel the bot posts to
+	APIURL         string // Web API base URL, Slack's unless set
+	ThreadByWallet bool
+	Labels         map[string]string // Wallet -> label shown instead of the address
+
+	mu      sync.Mutex
+	threads map[string]string // Wallet -> ts of the message that started its thread
+}
+
+type slackMessage struct {
+	Channel        string            `json:"channel,omitempty"`
+	Text           string            `json:"text"` // Notification fallback
+	ThreadTS       string            `json:"thread_ts,omitempty"`
+	ReplyBroadcast bool              `json:"reply_broadcast,omitempty"`
+	Attachments    []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+func NewSlackWebhookAlerter(webhookURL string, labels map[string]string) *SlackAlerter {
+	return &SlackAlerter{WebhookURL: webhookURL, Labels: labels}
+}
+
+func NewSlackBotAlerter(token, channel string, threadByWallet bool, labels map[string]string) *SlackAlerter {
+	return &SlackAlerter{
+		Token:          token,
+		Channel:        channel,
+		APIURL:         slackAPIURL,
+		ThreadByWallet: threadByWallet,
+		Labels:         labels,
+		threads:        make(map[string]string),
+	}
+}
+
+func (s *SlackAlerter) SendAlert(ctx context.Context, alert Alert) error {
+	msg := slackMessage{
+		Text:        fmt.Sprintf("%s %s: %s", levelSymbol(alert.Level), alertTitle(alert.AlertType), s.label(alert.WalletAddress)),
+		Attachments: []slackAttachment{{Color: slackColor(alert.Level), Blocks: s.blocks(alert)}},
+	}
+
+	if s.Token == "" {
+		return s.postWebhook(ctx, msg)
+	}
+
+	msg.Channel = s.Channel
+	threaded := s.ThreadByWallet && alert.WalletAddress != ""
+	if threaded {
+		s.mu.Lock()
+		msg.ThreadTS = s.threads[alert.WalletAddress]
+		s.mu.Unlock()
+		// Replies are easy to miss, critical ones show up in the channel as well
+		msg.ReplyBroadcast = msg.ThreadTS != "" && alert.Level == Critical
+	}
+
+	ts, err := s.postMessage(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if threaded && msg.ThreadTS == "" && ts != "" {
+		s.mu.Lock()
+		if s.threads == nil {
+			s.threads = make(map[string]string)
+		}
+		s.threads[alert.WalletAddress] = ts
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// postWebhook posts to the incoming webhook, which answers with plain text
+func (s *SlackAlerter) postWebhook(ctx context.Context, msg slackMessage) error {
+	status, body, err := s.post(ctx, s.WebhookURL, msg)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("slack webhook returned error status: %d, body: %s", status, string(body))
+	}
+	return nil
+}
+
+// postMessage calls chat.postMessage and returns the ts of the new message
+func (s *SlackAlerter) postMessage(ctx context.Context, msg slackMessage) (string, error) {
+	apiURL := s.APIURL
+	if apiURL == "" {
+		apiURL = slackAPIURL
+	}
+	status, body, err := s.post(ctx, strings.TrimRight(apiURL, "/")+"/chat.postMessage", msg)
+	if err != nil {
+		return "", err
+	}
+	var result slackResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("slack API returned status %d: %s", status, string(body))
+	}
+	if !result.OK {
+		return "", fmt.Errorf("slack API returned error: %s", result.Error)
+	}
+	return result.TS, nil
+}
+
+// post sends the message and returns the response status and body. A 429 is a
+// RateLimitError with the Retry-After Slack asked for.
+func (s *SlackAlerter) post(ctx context.Context, url string, msg slackMessage) (int, []byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Webhook URLs are secrets, keep them out of the logs
+		return 0, nil, fmt.Errorf("failed to send slack message: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read slack response: %w", err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return 0, nil, &RateLimitError{
+			RetryAfter: retryAfterHeader(resp.Header),
+			Err:        fmt.Errorf("slack rate limited: %s", string(body)),
+		}
+	}
+	return resp.StatusCode, body, nil
+}
+
+// blocks renders the alert: a headline, the balance diff, then the token, wallet and value
+func (s *SlackAlerter) blocks(alert Alert) []slackBlock {
+	get := func(key string) interface{} {
+		if alert.Data == nil {
+			return nil
+		}
+		return alert.Data[key]
+	}
+
+	headline := "*" + escapeSlack(levelSymbol(alert.Level)+" "+alertTitle(alert.AlertType)) + "*"
+	txs, _ := get("transactions").([]Transaction)
+	// Decoded trades say more than a percentage, lead with them
+	for _, tx := range txs {
+		if tx.Swap != "" {
+			headline += "\n*" + escapeSlack(tx.Swap) + "*"
+		}
+	}
+	blocks := []slackBlock{{Type: "section", Text: mrkdwn(truncateSlack(headline, maxSlackSectionLength))}}
+
+	var diff string
+	var fields []slackText
+	switch alert.AlertType {
+	case "balance_change", "sol_balance_change":
+		oldBal, ok1 := get("old_balance").(uint64)
+		newBal, ok2 := get("new_balance").(uint64)
+		decimals, ok3 := get("decimals").(uint8)
+		if ok1 && ok2 && ok3 {
+			changePercent, _ := get("change_percent").(float64)
+			diff = fmt.Sprintf("- Old: %s\n+ New: %s\nChange: %+.2f%%",
+				utils.FormatTokenAmount(oldBal, decimals), utils.FormatTokenAmount(newBal, decimals), changePercent)
+
+			delta, _ := get("usd_change").(float64)
+			if price, ok := get("usd_price").(float64); ok && price > 0 && alert.AlertType == "sol_balance_change" {
+				delta = (float64(newBal) - float64(oldBal)) / math.Pow(10, float64(decimals)) * price
+			}
+			if delta != 0 {
+				usdValue, _ := get("usd_value").(float64)
+				fields = append(fields, mrkdwnField("USD Value",
+					fmt.Sprintf("%s (%s%s)", formatUSD(usdValue), signOf(delta), formatUSD(math.Abs(delta)))))
+			}
+		}
+
+	case "new_token":
+		balance, ok1 := get("balance").(uint64)
+		decimals, ok2 := get("decimals").(uint8)
+		if ok1 && ok2 {
+			diff = "+ Initial Balance: " + utils.FormatTokenAmount(balance, decimals)
+			if usdValue, ok := get("usd_value").(float64); ok && usdValue > 0 {
+				fields = append(fields, mrkdwnField("USD Value", formatUSD(usdValue)))
+			}
+		}
+
+	case "token_removed":
+		oldBal, ok1 := get("old_balance").(uint64)
+		decimals, ok2 := get("decimals").(uint8)
+		if ok1 && ok2 {
+			diff = fmt.Sprintf("- Sold/Moved: %s\n+ Remaining: 0\nChange: -100.00%%", utils.FormatTokenAmount(oldBal, decimals))
+			if usdValue, ok := get("usd_value").(float64); ok && usdValue > 0 {
+				fields = append(fields, mrkdwnField("Last Known Value", formatUSD(usdValue)))
+			}
+		}
+	}
+	// Other alert types, and alerts without the details, carry everything in the message
+	if diff == "" {
+		diff = alert.Message
+	}
+	// The code fence stays intact, only its content is cut
+	diff = truncateSlack(escapeSlack(diff), maxSlackSectionLength-len("``````"))
+	blocks = append(blocks, slackBlock{Type: "section", Text: mrkdwn("```" + diff + "```")})
+
+	if alert.TokenMint != "" && alert.AlertType != "sol_balance_change" {
+		symbol, _ := get("symbol").(string)
+		name, _ := get("name").(string)
+		label := symbol
+		if name != "" && name != symbol {
+			label = fmt.Sprintf("%s (%s)", name, symbol)
+		}
+		fields = append([]slackText{{Type: "mrkdwn",
+			Text: fmt.Sprintf("*Token*\n%s\n`%s`", escapeSlack(label), alert.TokenMint)}}, fields...)
+	}
+	if alert.WalletAddress != "" {
+		fields = append(fields, slackText{Type: "mrkdwn",
+			Text: fmt.Sprintf("*Wallet*\n<%s%s|%s>", explorerAccountURL, alert.WalletAddress, escapeSlack(s.label(alert.WalletAddress)))})
+	}
+	if flags, ok := get("token_flags").([]string); ok && len(flags) > 0 {
+		fields = append(fields, mrkdwnField("⚠️ Token-2022", strings.Join(flags, ", ")))
+	}
+	if linked, ok := get("linked_from").(string); ok {
+		fields = append(fields, mrkdwnField("🔗 Linked Wallet", linked))
+	}
+	// A section holds at most 10 fields
+	for len(fields) > 0 {
+		n := min(len(fields), 10)
+		blocks = append(blocks, slackBlock{Type: "section", Fields: fields[:n]})
+		fields = fields[n:]
+	}
+
+	elements := []slackText{{Type: "mrkdwn", Text: escapeSlack(alert.Timestamp.Format("2006-01-02 15:04:05 MST"))}}
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+		elements = append(elements, slackText{Type: "mrkdwn",
+			Text: fmt.Sprintf("<%s%s|%s>", explorerTxURL, tx.Signature, shortAddress(tx.Signature))})
+	}
+	// A context block holds at most 10 elements
+	if len(elements) > 10 {
+		elements = elements[:10]
+	}
+	blocks = append(blocks, slackBlock{Type: "context", Elements: elements})
+	return blocks
+}
+
+// label is the configured label of a wallet, or its abbreviated address
+func (s *SlackAlerter) label(wallet string) string {
+	if label, ok := s.Labels[wallet]; ok && label != "" {
+		return label
+	}
+	return shortAddress(wallet)
+}
+
+func slackColor(level AlertLevel) string {
+	switch level {
+	case Critical:
+		return "#FF0000"
+	case Warning:
+		return "#FFA500"
+	default:
+		return "#36A64F"
+	}
+}
+
+func mrkdwn(text string) *slackText {
+	return &slackText{Type: "mrkdwn", Text: text}
+}
+
+func mrkdwnField(name, value string) slackText {
+	return slackText{Type: "mrkdwn", Text: "*" + escapeSlack(name) + "*\n" + escapeSlack(value)}
+}
+
+// truncateSlack cuts escaped mrkdwn to at most max characters, the last one an ellipsis. It
+// does not split the escape of a control character.
+func truncateSlack(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	cut := string([]rune(text)[:max-1])
+	// Escaping leaves no bare "&", one without its ";" is a cut escape
+	if amp := strings.LastIndexByte(cut, '&'); amp >= 0 && !strings.Contains(cut[amp:], ";") {
+		cut = cut[:amp]
+	}
+	return cut + "…"
+}
+
+// escapeSlack escapes the characters Slack treats as control characters in mrkdwn
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,148 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slackWallet = "CvQk2xkXtiMj2JqqVx1YZkeSqQ7jyQkNqqjeNE1jPTfc"
+
+func slackBalanceAlert(level AlertLevel, wallet string) Alert {
+	return Alert{
+		Timestamp:     time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		WalletAddress: wallet,
+		TokenMint:     "DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263",
+		AlertType:     "balance_change",
+		Level:         level,
+		Data: map[string]interface{}{
+			"old_balance":    uint64(1_500_000),
+			"new_balance":    uint64(3_000_000),
+			"decimals":       uint8(5),
+			"symbol":         "Bonk",
+			"name":           "Bonk <Official>",
+			"change_percent": 100.0,
+			"usd_value":      0.75,
+			"usd_change":     0.375,
+		},
+	}
+}
+
+func TestSlackWebhookBlocks(t *testing.T) {
+	var received slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	alerter := NewSlackWebhookAlerter(server.URL, map[string]string{slackWallet: "Insider #1"})
+	require.NoError(t, alerter.SendAlert(context.Background(), slackBalanceAlert(Critical, slackWallet)))
+
+	assert.Equal(t, "🔴 BALANCE_CHANGE Alert: Insider #1", received.Text)
+	require.Len(t, received.Attachments, 1)
+	attachment := received.Attachments[0]
+	assert.Equal(t, "#FF0000", attachment.Color)
+	require.Len(t, attachment.Blocks, 4)
+	assert.Equal(t, "*🔴 BALANCE_CHANGE Alert*", attachment.Blocks[0].Text.Text)
+	assert.Equal(t, "```- Old: 15.0000\n+ New: 30.0000\nChange: +100.00%```", attachment.Blocks[1].Text.Text)
+
+	fields := attachment.Blocks[2].Fields
+	require.Len(t, fields, 3)
+	assert.Equal(t, "*Token*\nBonk &lt;Official&gt; (Bonk)\n`DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263`", fields[0].Text)
+	assert.Equal(t, "*USD Value*\n$0.75 (+$0.38)", fields[1].Text)
+	assert.Equal(t, "*Wallet*\n<https://solscan.io/account/"+slackWallet+"|Insider #1>", fields[2].Text)
+	assert.Equal(t, "context", attachment.Blocks[3].Type)
+
+	// Failures surface the status and body
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("no_service"))
+	}))
+	defer failing.Close()
+	err := NewSlackWebhookAlerter(failing.URL, nil).SendAlert(context.Background(), slackBalanceAlert(Warning, slackWallet))
+	assert.EqualError(t, err, "slack webhook returned error status: 404, body: no_service")
+}
+
+func TestSlackBotThreadsByWallet(t *testing.T) {
+	var received []slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat.postMessage", r.URL.Path)
+		assert.Equal(t, "Bearer xoxb-test", r.Header.Get("Authorization"))
+		var msg slackMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		received = append(received, msg)
+		_, _ = fmt.Fprintf(w, `{"ok":true,"ts":"1717243200.%06d"}`, len(received))
+	}))
+	defer server.Close()
+
+	alerter := NewSlackBotAlerter("xoxb-test", "C123", true, nil)
+	alerter.APIURL = server.URL
+	other := "FjmRj8y9xfDaj5Aygq88t5jAFbpxrbZ16JNPPG1sx9FQ"
+	for _, alert := range []Alert{
+		slackBalanceAlert(Warning, slackWallet),
+		slackBalanceAlert(Warning, other),
+		slackBalanceAlert(Warning, slackWallet),
+		slackBalanceAlert(Critical, slackWallet),
+	} {
+		require.NoError(t, alerter.SendAlert(context.Background(), alert))
+	}
+
+	require.Len(t, received, 4)
+	assert.Equal(t, "C123", received[0].Channel)
+	assert.Empty(t, received[0].ThreadTS, "the first alert of a wallet starts its thread")
+	assert.Empty(t, received[1].ThreadTS)
+	assert.Equal(t, "1717243200.000001", received[2].ThreadTS)
+	assert.False(t, received[2].ReplyBroadcast)
+	assert.Equal(t, "1717243200.000001", received[3].ThreadTS)
+	assert.True(t, received[3].ReplyBroadcast, "critical replies are broadcast to the channel")
+
+	// API errors come back with ok set to false
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer failing.Close()
+	alerter.APIURL = failing.URL
+	assert.EqualError(t, alerter.SendAlert(context.Background(), slackBalanceAlert(Warning, other)),
+		"slack API returned error: channel_not_found")
+
+	// Rate limits are left to the outbox, with the Retry-After Slack asked for
+	limiting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"ok":false,"error":"ratelimited"}`))
+	}))
+	defer limiting.Close()
+	alerter.APIURL = limiting.URL
+	var limited *RateLimitError
+	require.ErrorAs(t, alerter.SendAlert(context.Background(), slackBalanceAlert(Warning, other)), &limited)
+	assert.Equal(t, 30*time.Second, limited.RetryAfter)
+}
+
+func TestSlackSectionsAreCapped(t *testing.T) {
+	alert := Alert{
+		Timestamp: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		AlertType: "convergence",
+		Level:     Warning,
+		Message:   strings.Repeat("a<b ", 1000),
+	}
+	blocks := NewSlackWebhookAlerter("", nil).blocks(alert)
+	text := blocks[1].Text.Text
+	assert.LessOrEqual(t, utf8.RuneCountInString(text), maxSlackSectionLength)
+	assert.True(t, strings.HasPrefix(text, "```a&lt;b "))
+	assert.True(t, strings.HasSuffix(text, "…```"), "the code fence is kept")
+	assert.NotContains(t, text, "&l…", "escapes are not split")
+
+	assert.Equal(t, "ab…", truncateSlack("ab&amp;c", 4))
+	assert.Equal(t, "é", truncateSlack("é", 1))
+}
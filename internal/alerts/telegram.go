@@ -0,0 +1,376 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/utils"
+)
+
+const (
+	telegramAPIURL    = "https://api.telegram.org"
+	maxTelegramLength = 4096 // Telegram's limit for a message text
+)
+
+// TelegramChat is a chat, or a topic of a forum chat, that receives the alerts it matches.
+// Every condition that is set has to match, a chat without conditions receives every alert.
+type TelegramChat struct {
+	ChatID   string // Numeric ID, or @username for public channels
+	ThreadID int    // Forum topic, 0 for the main chat
+	Levels   []AlertLevel
+	Types    []string
+	Wallets  []string // Nil matches every wallet
+	Mints    []string
+}
+
+func (c TelegramChat) matches(alert Alert) bool {
+	return Route{Levels: c.Levels, Types: c.Types, Wallets: c.Wallets, Mints: c.Mints}.matches(alert)
+}
+
+// recipient names the chat, and its topic, in a PartialDeliveryError
+func (c TelegramChat) recipient() string {
+	if c.ThreadID == 0 {
+		return c.ChatID
+	}
+	return fmt.Sprintf("%s/%d", c.ChatID, c.ThreadID)
+}
+
+// TelegramAlerter sends alerts through the Bot API's sendMessage, formatted as MarkdownV2
+type TelegramAlerter struct {
+	BotToken string
+	APIURL   string // Bot API server, the public one unless set
+	Chats    []TelegramChat
+}
+
+type telegramMessage struct {
+	ChatID             string                     `json:"chat_id"`
+	MessageThreadID    int                        `json:"message_thread_id,omitempty"`
+	Text               string                     `json:"text"`
+	ParseMode          string                     `json:"parse_mode"`
+	LinkPreviewOptions telegramLinkPreviewOptions `json:"link_preview_options"`
+}
+
+type telegramLinkPreviewOptions struct {
+	IsDisabled bool `json:"is_disabled"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func NewTelegramAlerter(botToken string, chats []TelegramChat) *TelegramAlerter {
+	return &TelegramAlerter{
+		BotToken: botToken,
+		APIURL:   telegramAPIURL,
+		Chats:    chats,
+	}
+}
+
+// SendAlert sends the alert to every chat it matches. A chat that fails does not keep the
+// alert from the others, the error names every chat that failed. When every failure was a
+// 429 it is a RateLimitError with the longest retry_after. When some chats got the alert it
+// is a PartialDeliveryError as well, so retries only go to the chats that failed.
+func (t *TelegramAlerter) SendAlert(ctx context.Context, alert Alert) error {
+	return t.sendAlertExcept(ctx, alert, nil)
+}
+
+func (t *TelegramAlerter) sendAlertExcept(ctx context.Context, alert Alert, delivered []string) error {
+	text := telegramText(alert)
+
+	var sent, failures []string
+	var retryAfter time.Duration
+	limited := true
+	for _, chat := range t.Chats {
+		if !chat.matches(alert) || contains(delivered, chat.recipient()) {
+			continue
+		}
+		msg := telegramMessage{
+			ChatID:             chat.ChatID,
+			MessageThreadID:    chat.ThreadID,
+			Text:               text,
+			ParseMode:          "MarkdownV2",
+			LinkPreviewOptions: telegramLinkPreviewOptions{IsDisabled: true},
+		}
+		if err := t.send(ctx, msg); err != nil {
+			failures = append(failures, fmt.Sprintf("chat %s: %v", chat.ChatID, err))
+			var rateLimited *RateLimitError
+			if errors.As(err, &rateLimited) {
+				retryAfter = max(retryAfter, rateLimited.RetryAfter)
+			} else {
+				limited = false
+			}
+			continue
+		}
+		sent = append(sent, chat.recipient())
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("telegram: %s", strings.Join(failures, "; "))
+	if limited {
+		err = &RateLimitError{RetryAfter: retryAfter, Err: err}
+	}
+	if len(sent) > 0 {
+		return &PartialDeliveryError{Delivered: sent, Err: err}
+	}
+	return err
+}
+
+// send makes a single sendMessage call, a 429 is a RateLimitError with Telegram's retry_after
+func (t *TelegramAlerter) send(ctx context.Context, msg telegramMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	apiURL := t.APIURL
+	if apiURL == "" {
+		apiURL = telegramAPIURL
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(apiURL, "/"), t.BotToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create telegram request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL carries the bot token, keep it out of the logs
+		return fmt.Errorf("failed to send telegram message: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	var result telegramResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("telegram API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	if result.OK {
+		return nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || result.ErrorCode == http.StatusTooManyRequests {
+		return &RateLimitError{
+			RetryAfter: time.Duration(result.Parameters.RetryAfter) * time.Second,
+			Err:        fmt.Errorf("telegram API rate limited: %s", result.Description),
+		}
+	}
+	return fmt.Errorf("telegram API returned error %d: %s", result.ErrorCode, result.Description)
+}
+
+// unwrapURLError drops the request URL from an HTTP client error
+func unwrapURLError(err error) error {
+	if inner := errors.Unwrap(err); inner != nil {
+		return inner
+	}
+	return err
+}
+
+// telegramText renders the same details as the Discord embed as MarkdownV2
+func telegramText(alert Alert) string {
+	get := func(key string) interface{} {
+		if alert.Data == nil {
+			return nil
+		}
+		return alert.Data[key]
+	}
+
+	var lines []string
+	lines = append(lines, "*"+escapeMarkdownV2(levelSymbol(alert.Level)+" "+alertTitle(alert.AlertType))+"*")
+
+	// Decoded trades say more than a percentage, lead with them
+	txs, _ := get("transactions").([]Transaction)
+	for _, tx := range txs {
+		if tx.Swap != "" {
+			lines = append(lines, "*"+escapeMarkdownV2(tx.Swap)+"*")
+		}
+	}
+
+	var body string
+	var details []string
+	switch alert.AlertType {
+	case "balance_change", "sol_balance_change":
+		oldBal, ok1 := get("old_balance").(uint64)
+		newBal, ok2 := get("new_balance").(uint64)
+		decimals, ok3 := get("decimals").(uint8)
+		if ok1 && ok2 && ok3 {
+			changePercent, _ := get("change_percent").(float64)
+			body = telegramPre(fmt.Sprintf("- Old: %s\n+ New: %s\nChange: %+.2f%%",
+				utils.FormatTokenAmount(oldBal, decimals), utils.FormatTokenAmount(newBal, decimals), changePercent))
+
+			delta, _ := get("usd_change").(float64)
+			if price, ok := get("usd_price").(float64); ok && price > 0 && alert.AlertType == "sol_balance_change" {
+				delta = (float64(newBal) - float64(oldBal)) / math.Pow(10, float64(decimals)) * price
+			}
+			if delta != 0 {
+				usdValue, _ := get("usd_value").(float64)
+				details = append(details, telegramField("USD Value",
+					escapeMarkdownV2(fmt.Sprintf("%s (%s%s)", formatUSD(usdValue), signOf(delta), formatUSD(math.Abs(delta))))))
+			}
+		}
+
+	case "new_token":
+		balance, ok1 := get("balance").(uint64)
+		decimals, ok2 := get("decimals").(uint8)
+		if ok1 && ok2 {
+			body = telegramPre("Initial Balance: " + utils.FormatTokenAmount(balance, decimals))
+			if usdValue, ok := get("usd_value").(float64); ok && usdValue > 0 {
+				details = append(details, telegramField("USD Value", escapeMarkdownV2(formatUSD(usdValue))))
+			}
+		}
+
+	case "token_removed":
+		oldBal, ok1 := get("old_balance").(uint64)
+		decimals, ok2 := get("decimals").(uint8)
+		if ok1 && ok2 {
+			body = telegramPre(fmt.Sprintf("- Sold/Moved: %s\n+ Remaining: 0\nChange: -100.00%%",
+				utils.FormatTokenAmount(oldBal, decimals)))
+			if usdValue, ok := get("usd_value").(float64); ok && usdValue > 0 {
+				details = append(details, telegramField("Last Known Value", escapeMarkdownV2(formatUSD(usdValue))))
+			}
+		}
+	}
+
+	// Other alert types, and alerts without the details, carry everything in the message
+	if body == "" {
+		body = telegramPre(alert.Message)
+	}
+	lines = append(lines, body)
+
+	if alert.TokenMint != "" && alert.AlertType != "sol_balance_change" {
+		symbol, _ := get("symbol").(string)
+		name, _ := get("name").(string)
+		label := escapeMarkdownV2(symbol)
+		if name != "" && name != symbol {
+			label = fmt.Sprintf("*%s* \\(%s\\)", escapeMarkdownV2(name), escapeMarkdownV2(symbol))
+		}
+		if label != "" {
+			label += "\n"
+		}
+		details = append([]string{telegramField("Token", label+telegramCode(alert.TokenMint))}, details...)
+	}
+
+	// Flag Token-2022 extensions that affect how the token can be moved
+	if flags, ok := get("token_flags").([]string); ok && len(flags) > 0 {
+		details = append(details, telegramField("⚠️ Token-2022", escapeMarkdownV2(strings.Join(flags, ", "))))
+	}
+	// Alerts on discovered wallets say which tracked wallet they came from
+	if linked, ok := get("linked_from").(string); ok {
+		details = append(details, telegramField("🔗 Linked Wallet", escapeMarkdownV2(linked)))
+	}
+	if len(txs) > 0 {
+		details = append(details, telegramField("Transactions", telegramTransactionLinks(txs)))
+	}
+	if alert.WalletAddress != "" {
+		details = append(details, telegramField("Wallet", telegramLink(alert.WalletAddress, explorerAccountURL+alert.WalletAddress)))
+	}
+	details = append(details, telegramField("Time", escapeMarkdownV2(alert.Timestamp.Format("2006-01-02 15:04:05 MST"))))
+
+	text := strings.Join(append(lines, details...), "\n")
+	if len(text) > maxTelegramLength {
+		// Cutting MarkdownV2 apart could leave an entity open, fall back to the plain message
+		text = telegramPre(truncate(alert.Message, maxTelegramLength-16))
+	}
+	return text
+}
+
+// telegramTransactionLinks renders one line per transaction, newest first, like the Discord field
+func telegramTransactionLinks(txs []Transaction) string {
+	var lines []string
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+		line := telegramLink(shortAddress(tx.Signature), explorerTxURL+tx.Signature)
+		if !tx.BlockTime.IsZero() {
+			line += " " + escapeMarkdownV2(tx.BlockTime.UTC().Format("15:04:05"))
+		}
+		switch {
+		case tx.Swap != "":
+			line += " · *" + escapeMarkdownV2(tx.Swap) + "*"
+		case len(tx.Programs) > 0:
+			line += " · " + escapeMarkdownV2(strings.Join(tx.Programs, ", "))
+		}
+		if len(tx.Counterparties) > 0 {
+			counterparty := tx.Counterparties[0]
+			line += " · " + telegramLink(shortAddress(counterparty), explorerAccountURL+counterparty)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownV2Special are the characters MarkdownV2 requires to be escaped in plain text
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// escapeMarkdownV2 escapes text outside of entities
+func escapeMarkdownV2(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(markdownV2Special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// telegramPre renders a preformatted block, in which only ` and \ are escaped
+func telegramPre(text string) string {
+	return "```\n" + escapeCode(text) + "\n```"
+}
+
+func telegramCode(text string) string {
+	return "`" + escapeCode(text) + "`"
+}
+
+func escapeCode(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(text)
+}
+
+// telegramLink renders an inline link, in whose URL only ) and \ are escaped
+func telegramLink(text, url string) string {
+	return "[" + escapeMarkdownV2(text) + "](" + strings.NewReplacer("\\", "\\\\", ")", "\\)").Replace(url) + ")"
+}
+
+func telegramField(name, value string) string {
+	return "*" + escapeMarkdownV2(name) + ":* " + value
+}
+
+// truncate cuts text to at most max bytes, without splitting a character
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return text[:max] + "…"
+}
+
+// levelSymbol is the coloured dot used for a level across destinations
+func levelSymbol(level AlertLevel) string {
+	switch level {
+	case Critical:
+		return "🔴"
+	case Warning:
+		return "🟡"
+	default:
+		return "🟢"
+	}
+}
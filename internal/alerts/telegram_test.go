@@ -0,0 +1,110 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	assert.Equal(t, `BONK \(\+12\.5%\) \[x\]\_y\*z\!`, escapeMarkdownV2("BONK (+12.5%) [x]_y*z!"))
+	assert.Equal(t, "```\n- Old: 1.5 \\` \\\\\n```", telegramPre("- Old: 1.5 ` \\"))
+	assert.Equal(t, `[a\.b](https://x.io/(a\)b)`, telegramLink("a.b", "https://x.io/(a)b"))
+}
+
+func TestTelegramAlerterRoutesChats(t *testing.T) {
+	var mu sync.Mutex
+	var received []telegramMessage
+	limited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/botTOKEN/sendMessage", r.URL.Path)
+		var msg telegramMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case msg.ChatID == "-100broken":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+		case msg.ChatID == "-100critical" && !limited:
+			// The first message to the critical chat is rate limited
+			limited = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 2","parameters":{"retry_after":2}}`))
+		default:
+			received = append(received, msg)
+			_, _ = w.Write([]byte(`{"ok":true,"result":{}}`))
+		}
+	}))
+	defer server.Close()
+
+	alerter := NewTelegramAlerter("TOKEN", []TelegramChat{
+		{ChatID: "-100team"},
+		{ChatID: "-100critical", ThreadID: 7, Levels: []AlertLevel{Critical}},
+		{ChatID: "-100broken", Types: []string{"token_removed"}},
+	})
+	alerter.APIURL = server.URL
+
+	alert := Alert{
+		Timestamp:     time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		WalletAddress: "CvQk2xkXtiMj2JqqVx1YZkeSqQ7jyQkNqqjeNE1jPTfc",
+		TokenMint:     "DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263",
+		AlertType:     "balance_change",
+		Level:         Warning,
+		Data: map[string]interface{}{
+			"old_balance":    uint64(1_500_000),
+			"new_balance":    uint64(3_000_000),
+			"decimals":       uint8(5),
+			"symbol":         "Bonk",
+			"name":           "Bonk (Official)",
+			"change_percent": 100.0,
+			"usd_value":      0.75,
+			"usd_change":     0.375,
+			"transactions":   []Transaction{{Signature: "5sig1111111111111111111111111111", Swap: "BOUGHT 15.00 Bonk for 0.0100 SOL via Jupiter"}},
+		},
+	}
+	require.NoError(t, alerter.SendAlert(context.Background(), alert))
+	require.Len(t, received, 1)
+	msg := received[0]
+	assert.Equal(t, "-100team", msg.ChatID)
+	assert.Zero(t, msg.MessageThreadID)
+	assert.Equal(t, "MarkdownV2", msg.ParseMode)
+	assert.Equal(t, "*🟡 BALANCE\\_CHANGE Alert*\n"+
+		"*BOUGHT 15\\.00 Bonk for 0\\.0100 SOL via Jupiter*\n"+
+		"```\n- Old: 15.0000\n+ New: 30.0000\nChange: +100.00%\n```\n"+
+		"*Token:* *Bonk \\(Official\\)* \\(Bonk\\)\n`DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263`\n"+
+		"*USD Value:* $0\\.75 \\(\\+$0\\.38\\)\n"+
+		"*Transactions:* [5sig…1111](https://solscan.io/tx/5sig1111111111111111111111111111) · *BOUGHT 15\\.00 Bonk for 0\\.0100 SOL via Jupiter*\n"+
+		"*Wallet:* [CvQk2xkXtiMj2JqqVx1YZkeSqQ7jyQkNqqjeNE1jPTfc](https://solscan.io/account/CvQk2xkXtiMj2JqqVx1YZkeSqQ7jyQkNqqjeNE1jPTfc)\n"+
+		"*Time:* 2024\\-06\\-01 12:00:00 UTC", msg.Text)
+
+	// A 429 is not waited out, the outbox retries after Telegram's retry_after
+	received = nil
+	alert.Level = Critical
+	var rateLimited *RateLimitError
+	require.ErrorAs(t, alerter.SendAlert(context.Background(), alert), &rateLimited)
+	assert.Equal(t, 2*time.Second, rateLimited.RetryAfter)
+	assert.Contains(t, rateLimited.Error(), "chat -100critical")
+	require.Len(t, received, 1)
+
+	// A critical exit also goes to the critical topic, even though the third chat fails
+	received = nil
+	alert.AlertType = "token_removed"
+	err := alerter.SendAlert(context.Background(), alert)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chat -100broken")
+	assert.False(t, errors.As(err, &rateLimited), "a chat that failed outright is not a rate limit")
+	require.Len(t, received, 2)
+	assert.Equal(t, "-100critical", received[1].ChatID)
+	assert.Equal(t, 7, received[1].MessageThreadID)
+	assert.Contains(t, received[1].Text, "*🔴 🚨 FULL EXIT Alert*")
+}
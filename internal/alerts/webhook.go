@@ -0,0 +1,129 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Headers of webhook requests, see docs/webhook.md for how receivers verify them
+	WebhookSignatureHeader   = "X-Insider-Signature" // "sha256=" and the hex HMAC of "<timestamp>.<body>"
+	WebhookTimestampHeader   = "X-Insider-Timestamp" // Unix seconds the request was signed at
+	WebhookIdempotencyHeader = "Idempotency-Key"     // Same as the payload's idempotency_key
+)
+
+// WebhookOptions configures a WebhookAlerter
+type WebhookOptions struct {
+	URL     string
+	Secret  string            // Signs every request when set
+	Headers map[string]string // Sent with every request, e.g. an API key
+
+	// Client certificate for mutual TLS, and the CA that signed the receiver's certificate
+	// when it is not in the system pool
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// WebhookAlerter posts alerts as versioned JSON (see WebhookPayload), signed with an
+// HMAC-SHA256 of the timestamp and body. It makes one attempt per SendAlert, the outbox
+// retries failed ones. Every attempt carries the same idempotency key, so receivers can
+// drop duplicates.
+type WebhookAlerter struct {
+	options WebhookOptions
+	client  *http.Client
+}
+
+func NewWebhookAlerter(options WebhookOptions) (*WebhookAlerter, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.CertFile != "" || options.CAFile != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if options.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load webhook client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		if options.CAFile != "" {
+			pem, err := os.ReadFile(options.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read webhook CA: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in webhook CA %s", options.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &WebhookAlerter{
+		options: options,
+		client:  &http.Client{Transport: transport, Timeout: sendTimeout},
+	}, nil
+}
+
+func (w *WebhookAlerter) SendAlert(ctx context.Context, alert Alert) error {
+	payload := NewWebhookPayload(alert)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	for name, value := range w.options.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "insider-monitor-webhook/"+strconv.Itoa(WebhookSchemaVersion))
+	req.Header.Set(WebhookIdempotencyHeader, payload.IdempotencyKey)
+	if w.options.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(w.options.Secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// Webhook URLs can carry tokens, keep them out of the logs
+		return fmt.Errorf("failed to send webhook: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("webhook returned error status: %d, body: %s", resp.StatusCode, string(respBody))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &RateLimitError{RetryAfter: retryAfterHeader(resp.Header), Err: err}
+	}
+	return err
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>", what receivers compare the
+// signature header against
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,267 @@
+package alerts
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// WebhookSchemaVersion is bumped whenever a field of the webhook payload changes meaning or
+// is removed. Adding fields does not bump it, receivers should ignore fields they don't know.
+const WebhookSchemaVersion = 1
+
+// WebhookPayload is the JSON body the webhook alerter posts, documented in docs/webhook.md.
+// The common fields are always set, of the type-specific objects only the one for Type is.
+// Raw token amounts are strings, they overflow the integers JSON parsers commonly use.
+type WebhookPayload struct {
+	Version        int                  `json:"version"`
+	IdempotencyKey string               `json:"idempotency_key"` // Same for every delivery of one alert
+	Type           string               `json:"type"`
+	Level          AlertLevel           `json:"level"`
+	Timestamp      time.Time            `json:"timestamp"`
+	Wallet         string               `json:"wallet,omitempty"`
+	Message        string               `json:"message"`
+	Rule           string               `json:"rule,omitempty"` // Alert rule that matched
+	Token          *WebhookToken        `json:"token,omitempty"`
+	LinkedFrom     *WebhookLink         `json:"linked_from,omitempty"` // Set for alerts on discovered wallets
+	Transactions   []WebhookTransaction `json:"transactions,omitempty"`
+
+	BalanceChange    *WebhookBalanceChange    `json:"balance_change,omitempty"` // balance_change, sol_balance_change and token_removed
+	NewToken         *WebhookNewToken         `json:"new_token,omitempty"`
+	NewWallet        *WebhookNewWallet        `json:"new_wallet,omitempty"`
+	InternalTransfer *WebhookInternalTransfer `json:"internal_transfer,omitempty"`
+	LinkedWallet     *WebhookLinkedWallet     `json:"linked_wallet,omitempty"`
+	Convergence      *WebhookConvergence      `json:"convergence,omitempty"`
+	WalletHealth     *WebhookWalletHealth     `json:"wallet_health,omitempty"`
+}
+
+type WebhookToken struct {
+	Mint     string   `json:"mint"`
+	Symbol   string   `json:"symbol,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Decimals uint8    `json:"decimals"`
+	Flags    []string `json:"flags,omitempty"` // Token-2022 extensions that affect transfers
+}
+
+type WebhookLink struct {
+	Parent string `json:"parent"` // Wallet that funded it
+	Root   string `json:"root"`   // Configured wallet the funding chain started at
+}
+
+type WebhookTransaction struct {
+	Signature      string     `json:"signature"`
+	Slot           uint64     `json:"slot"`
+	BlockTime      *time.Time `json:"block_time,omitempty"` // Left out when the node returned none
+	Programs       []string   `json:"programs,omitempty"`
+	Counterparties []string   `json:"counterparties,omitempty"`
+	Swap           string     `json:"swap,omitempty"`
+}
+
+type WebhookBalanceChange struct {
+	OldBalance    string  `json:"old_balance"`
+	NewBalance    string  `json:"new_balance"`
+	ChangePercent float64 `json:"change_percent"`
+	USDPrice      float64 `json:"usd_price,omitempty"`
+	USDValue      float64 `json:"usd_value,omitempty"` // Of the new balance, the last known value for token_removed
+	USDChange     float64 `json:"usd_change,omitempty"`
+}
+
+type WebhookNewToken struct {
+	Balance  string  `json:"balance"`
+	USDPrice float64 `json:"usd_price,omitempty"`
+	USDValue float64 `json:"usd_value,omitempty"`
+}
+
+type WebhookNewWallet struct {
+	Holdings    []WebhookHolding `json:"holdings"`              // Token holdings, most valuable first
+	SOLBalance  string           `json:"sol_balance,omitempty"` // Native SOL in lamports, apart from wrapped SOL in holdings
+	SOLUSDValue float64          `json:"sol_usd_value,omitempty"`
+	USDValue    float64          `json:"usd_value,omitempty"` // Of the holdings and native SOL
+	History     string           `json:"history,omitempty"`   // Summary of the backfilled history
+}
+
+type WebhookHolding struct {
+	Mint     string  `json:"mint"`
+	Symbol   string  `json:"symbol,omitempty"`
+	Balance  string  `json:"balance"`
+	Decimals uint8   `json:"decimals"`
+	USDValue float64 `json:"usd_value,omitempty"`
+}
+
+type WebhookInternalTransfer struct {
+	Amount string `json:"amount"`
+}
+
+type WebhookLinkedWallet struct {
+	Parent    string  `json:"parent"`
+	Root      string  `json:"root"`
+	Depth     int     `json:"depth"`
+	Amount    string  `json:"amount"` // Funding transfer, in the token's raw units
+	USDValue  float64 `json:"usd_value,omitempty"`
+	Fresh     bool    `json:"fresh"`
+	Monitored bool    `json:"monitored"`
+}
+
+type WebhookConvergence struct {
+	Entries       []WebhookConvergenceEntry `json:"entries"` // In the order the wallets entered
+	WindowSeconds float64                   `json:"window_seconds"`
+	SpanSeconds   float64                   `json:"span_seconds"`
+}
+
+type WebhookConvergenceEntry struct {
+	Wallet   string    `json:"wallet"`
+	Amount   string    `json:"amount"`
+	USDValue float64   `json:"usd_value,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type WebhookWalletHealth struct {
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailingSince        *time.Time `json:"failing_since,omitempty"`
+	Error               string     `json:"error,omitempty"`
+	Recovered           bool       `json:"recovered"`
+}
+
+// NewWebhookPayload maps an alert and its Data onto the typed schema
+func NewWebhookPayload(alert Alert) WebhookPayload {
+	data := alert.Data
+	text := func(key string) string {
+		value, _ := data[key].(string)
+		return value
+	}
+	amount := func(key string) string {
+		value, _ := data[key].(uint64)
+		return strconv.FormatUint(value, 10)
+	}
+	number := func(key string) float64 {
+		value, _ := data[key].(float64)
+		return value
+	}
+	integer := func(key string) int {
+		value, _ := data[key].(int)
+		return value
+	}
+	flag := func(key string) bool {
+		value, _ := data[key].(bool)
+		return value
+	}
+
+	payload := WebhookPayload{
+		Version:        WebhookSchemaVersion,
+		IdempotencyKey: alert.Key(),
+		Type:           alert.AlertType,
+		Level:          alert.Level,
+		Timestamp:      alert.Timestamp,
+		Wallet:         alert.WalletAddress,
+		Message:        alert.Message,
+		Rule:           text("rule"),
+	}
+
+	if alert.TokenMint != "" {
+		decimals, _ := data["decimals"].(uint8)
+		flags, _ := data["token_flags"].([]string)
+		payload.Token = &WebhookToken{Mint: alert.TokenMint, Symbol: text("symbol"), Name: text("name"), Decimals: decimals, Flags: flags}
+	}
+	if parent := text("parent_wallet"); parent != "" && alert.AlertType != "linked_wallet" {
+		payload.LinkedFrom = &WebhookLink{Parent: parent, Root: text("root_wallet")}
+	}
+	if txs, ok := data["transactions"].([]Transaction); ok {
+		for _, tx := range txs {
+			payload.Transactions = append(payload.Transactions, WebhookTransaction{
+				Signature:      tx.Signature,
+				Slot:           tx.Slot,
+				BlockTime:      optionalTime(tx.BlockTime),
+				Programs:       tx.Programs,
+				Counterparties: tx.Counterparties,
+				Swap:           tx.Swap,
+			})
+		}
+	}
+
+	switch alert.AlertType {
+	case "balance_change", "sol_balance_change", "token_removed":
+		payload.BalanceChange = &WebhookBalanceChange{
+			OldBalance:    amount("old_balance"),
+			NewBalance:    amount("new_balance"),
+			ChangePercent: number("change_percent"),
+			USDPrice:      number("usd_price"),
+			USDValue:      number("usd_value"),
+			USDChange:     number("usd_change"),
+		}
+	case "new_token":
+		payload.NewToken = &WebhookNewToken{Balance: amount("balance"), USDPrice: number("usd_price"), USDValue: number("usd_value")}
+	case "new_wallet":
+		balances, _ := data["token_balances"].(map[string]uint64)
+		decimals, _ := data["token_decimals"].(map[string]uint8)
+		symbols, _ := data["token_symbols"].(map[string]string)
+		values, _ := data["token_values"].(map[string]float64)
+		holdings := make([]WebhookHolding, 0, len(balances))
+		for mint, balance := range balances {
+			holdings = append(holdings, WebhookHolding{
+				Mint:     mint,
+				Symbol:   symbols[mint],
+				Balance:  strconv.FormatUint(balance, 10),
+				Decimals: decimals[mint],
+				USDValue: values[mint],
+			})
+		}
+		sort.Slice(holdings, func(i, j int) bool {
+			if holdings[i].USDValue != holdings[j].USDValue {
+				return holdings[i].USDValue > holdings[j].USDValue
+			}
+			return holdings[i].Mint < holdings[j].Mint
+		})
+		payload.NewWallet = &WebhookNewWallet{Holdings: holdings, SOLUSDValue: number("sol_usd_value"), USDValue: number("usd_value"), History: text("history")}
+		if _, ok := data["sol_balance"].(uint64); ok {
+			payload.NewWallet.SOLBalance = amount("sol_balance")
+		}
+	case "internal_transfer":
+		payload.InternalTransfer = &WebhookInternalTransfer{Amount: amount("amount")}
+	case "linked_wallet":
+		payload.LinkedWallet = &WebhookLinkedWallet{
+			Parent:    text("parent_wallet"),
+			Root:      text("root_wallet"),
+			Depth:     integer("depth"),
+			Amount:    amount("amount"),
+			USDValue:  number("usd_value"),
+			Fresh:     flag("fresh"),
+			Monitored: flag("monitored"),
+		}
+	case "convergence":
+		convergence := &WebhookConvergence{}
+		if entries, ok := data["entries"].([]ConvergenceEntry); ok {
+			for _, entry := range entries {
+				convergence.Entries = append(convergence.Entries, WebhookConvergenceEntry{
+					Wallet:   entry.WalletAddress,
+					Amount:   strconv.FormatUint(entry.Amount, 10),
+					USDValue: entry.USDValue,
+					Time:     entry.Time,
+				})
+			}
+		}
+		if window, ok := data["window"].(time.Duration); ok {
+			convergence.WindowSeconds = window.Seconds()
+		}
+		if span, ok := data["span"].(time.Duration); ok {
+			convergence.SpanSeconds = span.Seconds()
+		}
+		payload.Convergence = convergence
+	case "wallet_health":
+		since, _ := data["failing_since"].(time.Time)
+		payload.WalletHealth = &WebhookWalletHealth{
+			ConsecutiveFailures: integer("consecutive_failures"),
+			FailingSince:        optionalTime(since),
+			Error:               text("error"),
+			Recovered:           flag("recovered"),
+		}
+	}
+	return payload
+}
+
+// optionalTime leaves zero times out of the payload, omitempty never treats a time.Time as empty
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
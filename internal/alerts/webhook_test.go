@@ -0,0 +1,102 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookAlerterSigns(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	var payload WebhookPayload
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		keys = append(keys, r.Header.Get(WebhookIdempotencyHeader))
+		assert.Equal(t, "secret-key", r.Header.Get("X-Api-Key"))
+
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		signed, err := strconv.ParseInt(timestamp, 10, 64)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), time.Unix(signed, 0), time.Minute)
+		assert.Equal(t, "sha256="+SignWebhook("s3cret", timestamp, body), r.Header.Get(WebhookSignatureHeader))
+
+		// The first attempt hits an outage, the second is rate limited
+		switch attempts {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			require.NoError(t, json.Unmarshal(body, &payload))
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	alerter, err := NewWebhookAlerter(WebhookOptions{
+		URL:     server.URL,
+		Secret:  "s3cret",
+		Headers: map[string]string{"X-Api-Key": "secret-key"},
+	})
+	require.NoError(t, err)
+
+	// One attempt per call, the outbox owns retries
+	alert := slackBalanceAlert(Critical, slackWallet)
+	alert.Data["rule"] = "whales"
+	assert.EqualError(t, alerter.SendAlert(context.Background(), alert), "webhook returned error status: 502, body: ")
+	var limited *RateLimitError
+	require.ErrorAs(t, alerter.SendAlert(context.Background(), alert), &limited)
+	assert.Equal(t, 7*time.Second, limited.RetryAfter)
+	require.NoError(t, alerter.SendAlert(context.Background(), alert))
+
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []string{alert.Key(), alert.Key(), alert.Key()}, keys, "retries keep the idempotency key")
+	assert.Equal(t, WebhookSchemaVersion, payload.Version)
+	assert.Equal(t, alert.Key(), payload.IdempotencyKey)
+	assert.Equal(t, "balance_change", payload.Type)
+	assert.Equal(t, "whales", payload.Rule)
+	require.NotNil(t, payload.Token)
+	assert.Equal(t, "Bonk", payload.Token.Symbol)
+	assert.Equal(t, uint8(5), payload.Token.Decimals)
+	require.NotNil(t, payload.BalanceChange)
+	assert.Equal(t, WebhookBalanceChange{OldBalance: "1500000", NewBalance: "3000000", ChangePercent: 100, USDValue: 0.75, USDChange: 0.375}, *payload.BalanceChange)
+	assert.Nil(t, payload.NewToken)
+
+	attempts = 0
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("bad signature"))
+	}))
+	defer rejecting.Close()
+	alerter.options.URL = rejecting.URL
+	assert.EqualError(t, alerter.SendAlert(context.Background(), alert), "webhook returned error status: 401, body: bad signature")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestAlertKeyIsStable(t *testing.T) {
+	alert := slackBalanceAlert(Warning, slackWallet)
+	again := slackBalanceAlert(Critical, slackWallet)
+	assert.Equal(t, alert.Key(), again.Key(), "the level can change through rules, the key must not")
+	again.Timestamp = again.Timestamp.Add(time.Second)
+	assert.NotEqual(t, alert.Key(), again.Key())
+}
@@ -4,29 +4,321 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
 )
 
 type Config struct {
-	NetworkURL   string        `json:"network_url"`
-	Wallets      []string      `json:"wallets"`
-	ScanInterval string        `json:"scan_interval"`
-	Alerts       AlertConfig   `json:"alerts"`
-	Discord      DiscordConfig `json:"discord"`
-	Scan         ScanConfig    `json:"scan"`
+	NetworkURL   string          `json:"network_url"`
+	Wallets      []string        `json:"wallets"`
+	ScanInterval string          `json:"scan_interval"`
+	Alerts       AlertConfig     `json:"alerts"`
+	Discord      DiscordConfig   `json:"discord"`
+	Scan         ScanConfig      `json:"scan"`
+	Stream       StreamConfig    `json:"stream"`
+	Discovery    DiscoveryConfig `json:"discovery"`
+
+	WalletGroups map[string][]string `json:"wallet_groups"` // Named sets of wallets that alert rules can match on
+	WalletLabels map[string]string   `json:"wallet_labels"` // Wallet -> name shown in alerts that support it
+
+	Destinations []DestinationConfig `json:"destinations"` // Where alerts go, the discord section or the console when empty
+	Routes       []RouteConfig       `json:"routes"`       // Which alerts go where, every alert goes everywhere when empty
+	Outbox       OutboxConfig        `json:"outbox"`       // How failed deliveries are retried
+
+	RPCEndpoints []RPCEndpoint `json:"rpc_endpoints"` // Endpoint pool, network_url is used when empty
+}
+
+type RPCEndpoint struct {
+	URL               string  `json:"url"`
+	Weight            int     `json:"weight"`              // Share of the traffic relative to other endpoints, default 1
+	RequestsPerSecond float64 `json:"requests_per_second"` // Defaults to scan.requests_per_second
+}
+
+// Endpoints returns the configured RPC endpoint pool, or network_url as a pool of one
+func (c *Config) Endpoints() []RPCEndpoint {
+	if len(c.RPCEndpoints) > 0 {
+		return c.RPCEndpoints
+	}
+	return []RPCEndpoint{{URL: c.NetworkURL, Weight: 1}}
 }
 
 type AlertConfig struct {
-	MinimumBalance    uint64   `json:"minimum_balance"`    // Minimum balance to trigger alerts
-	SignificantChange float64  `json:"significant_change"` // e.g., 0.20 for 20% change
-	IgnoreTokens      []string `json:"ignore_tokens"`      // Tokens to ignore
+	MinimumBalance    float64           `json:"minimum_balance"`    // Minimum balance in whole tokens to trigger alerts
+	SignificantChange float64           `json:"significant_change"` // e.g., 0.20 for 20% change
+	IgnoreTokens      []string          `json:"ignore_tokens"`      // Mints that never raise alerts
+	SOL               SOLAlertConfig    `json:"sol"`                // Native SOL balance thresholds
+	Convergence       ConvergenceConfig `json:"convergence"`        // Several wallets buying the same token
+
+	// USD thresholds, applied to tokens with a Jupiter price
+	MinimumPositionUSD float64 `json:"minimum_position_usd"` // Ignore tokens worth less than this before and after a change
+	MinimumChangeUSD   float64 `json:"minimum_change_usd"`   // Ignore changes that move less than this
+	PercentageFloorUSD float64 `json:"percentage_floor_usd"` // significant_change only applies to positions worth at least this
+	UnpricedTokens     string  `json:"unpriced_tokens"`      // "percentage" (default) applies significant_change, "ignore" drops them
+
+	FailureThreshold int `json:"wallet_failure_threshold"` // Consecutive failed scans before a wallet_health alert, default 3
+
+	Rules []AlertRule `json:"rules"` // Evaluated in order, the first matching rule decides
+}
+
+// AlertRule assigns a level and destinations to the changes it matches. Every condition that
+// is set has to match, a rule without conditions matches everything.
+type AlertRule struct {
+	Name string `json:"name"`
+
+	// Conditions
+	Wallets          []string `json:"wallets"`            // Wallet addresses
+	Groups           []string `json:"groups"`             // wallet_groups names, linked wallets match the group of their root
+	Mints            []string `json:"mints"`              // Token mints
+	ChangeTypes      []string `json:"change_types"`       // e.g. "new_token", "balance_change", "token_removed"
+	MinChangePercent float64  `json:"min_change_percent"` // Absolute balance change in percent, e.g. 50 for 50%
+	MinUSDValue      float64  `json:"min_usd_value"`      // Value of the position after the change
+	MinUSDChange     float64  `json:"min_usd_change"`     // Absolute USD value of the movement
+	MaxTokenAge      string   `json:"max_token_age"`      // Only tokens created at most this long ago, e.g. "24h"
+	MinTokenAge      string   `json:"min_token_age"`      // Only tokens created at least this long ago
+	FirstBuy         *bool    `json:"first_buy"`          // Whether the change is a wallet's first buy of the token
+
+	// Outcome
+	Level        string   `json:"level"`        // "info", "warning" or "critical", keeps the default level when empty
+	Destinations []string `json:"destinations"` // Where the alert is sent
+	Suppress     bool     `json:"suppress"`     // Drop matching changes, they are only logged
+	SuppressFor  string   `json:"suppress_for"` // Drop repeats for the same wallet and token within this window, e.g. "30m"
+}
+
+// UsesTokenAge reports whether any rule needs to know when tokens were created
+func (a AlertConfig) UsesTokenAge() bool {
+	for _, rule := range a.Rules {
+		if rule.MaxTokenAge != "" || rule.MinTokenAge != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// NativeSOL is the ignore_tokens entry for native SOL. The wrapped SOL mint only ignores
+// wrapped SOL, which is a token like any other.
+const NativeSOL = "SOL"
+
+// Ignored reports whether a mint, or NativeSOL, is in ignore_tokens
+func (a AlertConfig) Ignored(mint string) bool {
+	for _, ignored := range a.IgnoreTokens {
+		if ignored == mint {
+			return true
+		}
+	}
+	return false
+}
+
+// BelowMinimumBalance reports whether a raw balance is less than minimum_balance, which is
+// expressed in whole tokens of the mint
+func (a AlertConfig) BelowMinimumBalance(balance uint64, decimals uint8) bool {
+	if a.MinimumBalance <= 0 {
+		return false
+	}
+	return float64(balance)/math.Pow(10, float64(decimals)) < a.MinimumBalance
+}
+
+// IgnoreUnpriced reports whether changes in tokens without a price are dropped
+func (a AlertConfig) IgnoreUnpriced() bool {
+	return strings.EqualFold(a.UnpricedTokens, "ignore")
+}
+
+// WalletFailureThreshold returns how many scans in a row a wallet may fail before it is reported
+func (a AlertConfig) WalletFailureThreshold() int {
+	if a.FailureThreshold > 0 {
+		return a.FailureThreshold
+	}
+	return 3
+}
+
+type SOLAlertConfig struct {
+	SignificantChange float64 `json:"significant_change"` // Percentage change, falls back to alerts.significant_change when 0
+	MinimumChange     float64 `json:"minimum_change"`     // Minimum absolute change in SOL to trigger alerts
+}
+
+// ConvergenceConfig raises a convergence alert when several wallets buy the same token within a window
+type ConvergenceConfig struct {
+	Enabled    bool   `json:"enabled"`
+	MinWallets int    `json:"min_wallets"` // Wallets that have to buy the token, default 3
+	Window     string `json:"window"`      // Sliding window the buys have to fall in, e.g. "1h" (default)
+}
+
+// MinimumWallets returns how many wallets have to buy a token for a convergence alert
+func (c ConvergenceConfig) MinimumWallets() int {
+	if c.MinWallets > 1 {
+		return c.MinWallets
+	}
+	return 3
+}
+
+// WindowDuration returns the sliding window, one hour unless configured
+func (c ConvergenceConfig) WindowDuration() time.Duration {
+	if window, err := time.ParseDuration(c.Window); err == nil && window > 0 {
+		return window
+	}
+	return time.Hour
+}
+
+// SOLSignificantChange returns the percentage threshold used for native SOL balances
+func (a AlertConfig) SOLSignificantChange() float64 {
+	if a.SOL.SignificantChange > 0 {
+		return a.SOL.SignificantChange
+	}
+	return a.SignificantChange
 }
 
 type ScanConfig struct {
 	IncludeTokens []string `json:"include_tokens"` // Specific tokens to include (if empty, include all)
 	ExcludeTokens []string `json:"exclude_tokens"` // Specific tokens to exclude
 	ScanMode      string   `json:"scan_mode"`      // "all", "whitelist", or "blacklist"
+
+	Workers           int     `json:"workers"`             // Wallets scanned concurrently, default 4
+	RequestsPerSecond float64 `json:"requests_per_second"` // RPC request budget shared by all workers, default 10
+	Commitment        string  `json:"commitment"`          // "processed", "confirmed" or "finalized" (default)
+}
+
+type StreamConfig struct {
+	Enabled           bool   `json:"enabled"`            // Use PubSub notifications instead of relying on polling alone
+	WebsocketURL      string `json:"websocket_url"`      // Defaults to network_url with a ws(s):// scheme
+	ReconcileInterval string `json:"reconcile_interval"` // Full polling pass while streaming, e.g. "5m"
+}
+
+// DiscoveryConfig controls how wallets funded by monitored wallets are linked to them
+type DiscoveryConfig struct {
+	Enabled              bool     `json:"enabled"`
+	Mode                 string   `json:"mode"`                   // "propose" (default) only alerts, "auto" also monitors linked wallets
+	MinimumSOL           float64  `json:"minimum_sol"`            // Smallest SOL transfer that links a wallet, default 0.1
+	MinimumTokenUSD      float64  `json:"minimum_token_usd"`      // Smallest token transfer in USD, unpriced tokens only count when 0
+	MaxDepth             int      `json:"max_depth"`              // Funding hops from a configured wallet, default 1
+	FreshMaxTransactions int      `json:"fresh_max_transactions"` // Recipients with more transactions are not fresh, default 10
+	IncludeEstablished   bool     `json:"include_established"`    // Link recipients that are not fresh too
+	MaxWallets           int      `json:"max_wallets"`            // Linked wallets kept at most, default 50
+	IgnoreAddresses      []string `json:"ignore_addresses"`       // Exchanges and other recipients that are never linked
+}
+
+// AutoAdd reports whether linked wallets are monitored without asking
+func (d DiscoveryConfig) AutoAdd() bool {
+	return strings.EqualFold(d.Mode, "auto")
+}
+
+// MinSOL returns the smallest SOL transfer that links a wallet
+func (d DiscoveryConfig) MinSOL() float64 {
+	if d.MinimumSOL > 0 {
+		return d.MinimumSOL
+	}
+	return 0.1
+}
+
+// MaxHops returns how many funding hops away from a configured wallet a wallet may be linked
+func (d DiscoveryConfig) MaxHops() int {
+	if d.MaxDepth > 0 {
+		return d.MaxDepth
+	}
+	return 1
+}
+
+// FreshTransactions returns how many transactions a recipient may have to count as fresh
+func (d DiscoveryConfig) FreshTransactions() int {
+	if d.FreshMaxTransactions > 0 {
+		return d.FreshMaxTransactions
+	}
+	return 10
+}
+
+// WalletLimit returns how many linked wallets are kept at most
+func (d DiscoveryConfig) WalletLimit() int {
+	if d.MaxWallets > 0 {
+		return d.MaxWallets
+	}
+	return 50
+}
+
+// DestinationConfig is a named alert destination that routes and alert rules refer to
+type DestinationConfig struct {
+	Name string `json:"name"` // Defaults to the type
+	Type string `json:"type"` // "console", "discord", "telegram", "slack", "webhook" or "file"
+
+	WebhookURL     string               `json:"webhook_url"`      // discord, defaults to the discord section; slack incoming webhook; webhook
+	ChannelID      string               `json:"channel_id"`       // discord
+	BotToken       string               `json:"bot_token"`        // telegram; slack, posts with chat.postMessage instead of the webhook
+	Chats          []TelegramChatConfig `json:"chats"`            // telegram
+	Channel        string               `json:"channel"`          // slack, with bot_token
+	ThreadByWallet bool                 `json:"thread_by_wallet"` // slack, with bot_token: keep each wallet's alerts in one thread
+	Path           string               `json:"path"`             // file, one JSON line per alert
+
+	// webhook: signed JSON posts to webhook_url, see docs/webhook.md
+	Secret     string            `json:"secret"`      // HMAC-SHA256 signing key
+	Headers    map[string]string `json:"headers"`     // Sent with every request
+	ClientCert string            `json:"client_cert"` // PEM files for mutual TLS
+	ClientKey  string            `json:"client_key"`
+	CACert     string            `json:"ca_cert"` // CA of the receiver, when not in the system pool
+}
+
+// TelegramChatConfig is a Telegram chat, or a topic of a forum chat, and the alerts it gets.
+// Every condition that is set has to match, a chat without conditions gets every alert.
+type TelegramChatConfig struct {
+	ChatID   string   `json:"chat_id"`   // Numeric ID, or @username for public channels
+	ThreadID int      `json:"thread_id"` // Forum topic, the main chat when 0
+	Levels   []string `json:"levels"`
+	Types    []string `json:"types"`
+	Groups   []string `json:"groups"`
+	Mints    []string `json:"mints"`
+}
+
+// DestinationName returns the name routes and rules use for the destination
+func (d DestinationConfig) DestinationName() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return strings.ToLower(d.Type)
+}
+
+// RouteConfig sends the alerts it matches to its destinations. Every condition that is set
+// has to match, the destinations of all matching routes are combined.
+type RouteConfig struct {
+	Levels       []string `json:"levels"` // "info", "warning", "critical"
+	Types        []string `json:"types"`  // Alert types, e.g. "new_token", "convergence", "wallet_health"
+	Groups       []string `json:"groups"` // wallet_groups names
+	Mints        []string `json:"mints"`
+	Destinations []string `json:"destinations"`
+}
+
+// AlertDestinations returns the configured destinations. Without any, alerts go to Discord
+// when the discord section is enabled and to the console otherwise.
+func (c *Config) AlertDestinations() []DestinationConfig {
+	if len(c.Destinations) > 0 {
+		return c.Destinations
+	}
+	if c.Discord.Enabled {
+		return []DestinationConfig{{Name: "discord", Type: "discord"}}
+	}
+	return []DestinationConfig{{Name: "console", Type: "console"}}
+}
+
+// OutboxConfig controls the retries of alerts that could not be delivered. Alerts wait in
+// ./data/outbox until every destination has them, or has failed max_attempts times.
+type OutboxConfig struct {
+	MaxAttempts int    `json:"max_attempts"` // Failed attempts per destination before an alert is dead-lettered (default 8)
+	MaxBackoff  string `json:"max_backoff"`  // Longest wait between attempts, e.g. "10m" (default)
+}
+
+// Attempts returns how often a destination is tried before the alert is dead-lettered
+func (o OutboxConfig) Attempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+	return 8
+}
+
+// MaxBackoffDuration returns the longest wait between attempts, ten minutes unless configured
+func (o OutboxConfig) MaxBackoffDuration() time.Duration {
+	if backoff, err := time.ParseDuration(o.MaxBackoff); err == nil && backoff > 0 {
+		return backoff
+	}
+	return 10 * time.Minute
 }
 
 type DiscordConfig struct {
@@ -52,7 +344,7 @@ var recommendedRPCProviders = map[string]string{
 }
 
 func (c *Config) Validate() error {
-	if c.NetworkURL == "" {
+	if c.NetworkURL == "" && len(c.RPCEndpoints) == 0 {
 		return fmt.Errorf("network URL is required\n\n" +
 			"💡 Recommendation: Get a dedicated RPC endpoint for better performance:\n" +
 			"   • Helius: 100k requests/day free - https://helius.dev\n" +
@@ -75,14 +367,240 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	switch strings.ToLower(c.Scan.Commitment) {
+	case "", "processed", "confirmed", "finalized":
+	default:
+		return fmt.Errorf("invalid scan commitment %q\n\n"+
+			"💡 Use \"processed\", \"confirmed\" or \"finalized\" (default).\n"+
+			"   Lower commitment alerts sooner but may report transactions that are later dropped.", c.Scan.Commitment)
+	}
+
+	switch strings.ToLower(c.Alerts.UnpricedTokens) {
+	case "", "percentage", "ignore":
+	default:
+		return fmt.Errorf("invalid unpriced_tokens policy %q\n\n"+
+			"💡 Use \"percentage\" (default) to alert on unpriced tokens by significant_change,\n"+
+			"   or \"ignore\" to drop changes in tokens without a price.", c.Alerts.UnpricedTokens)
+	}
+	if c.Alerts.MinimumBalance < 0 {
+		return fmt.Errorf("alerts.minimum_balance must not be negative")
+	}
+	// An entry that is not a mint address never matches, most likely a typo
+	for _, mint := range c.Alerts.IgnoreTokens {
+		if _, err := solana.PublicKeyFromBase58(mint); err != nil && mint != NativeSOL {
+			log.Printf("⚠️  alerts.ignore_tokens entry %q is not a valid mint address and will never match", mint)
+		}
+	}
+	if c.Alerts.MinimumPositionUSD < 0 || c.Alerts.MinimumChangeUSD < 0 || c.Alerts.PercentageFloorUSD < 0 {
+		return fmt.Errorf("USD alert thresholds must not be negative")
+	}
+
+	if c.Alerts.Convergence.Window != "" {
+		if window, err := time.ParseDuration(c.Alerts.Convergence.Window); err != nil || window <= 0 {
+			return fmt.Errorf("invalid convergence window %q\n\n"+
+				"💡 Use a duration like \"30m\" or \"1h\".", c.Alerts.Convergence.Window)
+		}
+	}
+
+	if err := c.validateDestinations(); err != nil {
+		return err
+	}
+	if c.Outbox.MaxAttempts < 0 {
+		return fmt.Errorf("outbox.max_attempts cannot be negative")
+	}
+	if c.Outbox.MaxBackoff != "" {
+		if backoff, err := time.ParseDuration(c.Outbox.MaxBackoff); err != nil || backoff <= 0 {
+			return fmt.Errorf("invalid outbox max_backoff %q\n\n"+
+				"💡 Use a duration like \"5m\" or \"1h\".", c.Outbox.MaxBackoff)
+		}
+	}
+	if err := c.validateRules(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(c.Discovery.Mode) {
+	case "", "propose", "auto":
+	default:
+		return fmt.Errorf("invalid discovery mode %q\n\n"+
+			"💡 Use \"propose\" (default) to be alerted about linked wallets,\n"+
+			"   or \"auto\" to also start monitoring them.", c.Discovery.Mode)
+	}
+	if c.Discovery.MinimumSOL < 0 || c.Discovery.MinimumTokenUSD < 0 || c.Discovery.MaxDepth < 0 ||
+		c.Discovery.FreshMaxTransactions < 0 || c.Discovery.MaxWallets < 0 {
+		return fmt.Errorf("discovery settings must not be negative")
+	}
+
+	for i, endpoint := range c.RPCEndpoints {
+		if endpoint.URL == "" {
+			return fmt.Errorf("rpc_endpoints[%d] is missing a url", i)
+		}
+		if endpoint.Weight < 0 || endpoint.RequestsPerSecond < 0 {
+			return fmt.Errorf("rpc_endpoints[%d] has a negative weight or requests_per_second", i)
+		}
+	}
+
 	// Check if using public RPC endpoint
 	c.validateRPCEndpoint()
 
 	return nil
 }
 
+// validateDestinations checks the alert destinations and the routes between them
+func (c *Config) validateDestinations() error {
+	names := make(map[string]bool)
+	for i, destination := range c.AlertDestinations() {
+		name := destination.DestinationName()
+		if names[name] {
+			return fmt.Errorf("destinations[%d]: the name %q is used twice", i, name)
+		}
+		names[name] = true
+
+		switch strings.ToLower(destination.Type) {
+		case "console":
+		case "discord":
+			if destination.WebhookURL == "" && c.Discord.WebhookURL == "" {
+				return fmt.Errorf("destination %s needs a webhook_url\n\n"+
+					"💡 Set it on the destination or in the discord section.", name)
+			}
+		case "telegram":
+			if destination.BotToken == "" || len(destination.Chats) == 0 {
+				return fmt.Errorf("destination %s needs a bot_token and at least one chat\n\n"+
+					"💡 Create a bot with @BotFather, add it to the chat and use the chat's ID.", name)
+			}
+			for j, chat := range destination.Chats {
+				context := fmt.Sprintf("destination %s chats[%d]", name, j)
+				if chat.ChatID == "" {
+					return fmt.Errorf("%s is missing a chat_id", context)
+				}
+				if err := c.validateConditions(context, chat.Levels, chat.Groups); err != nil {
+					return err
+				}
+			}
+		case "slack":
+			switch {
+			case destination.BotToken != "" && destination.Channel == "":
+				return fmt.Errorf("destination %s needs the channel the bot posts to", name)
+			case destination.BotToken == "" && destination.WebhookURL == "":
+				return fmt.Errorf("destination %s needs a webhook_url, or a bot_token and channel\n\n"+
+					"💡 Threads per wallet need a bot token with the chat:write scope.", name)
+			case destination.BotToken == "" && destination.ThreadByWallet:
+				return fmt.Errorf("destination %s can only thread by wallet with a bot_token, webhooks cannot reply", name)
+			}
+		case "webhook":
+			switch {
+			case destination.WebhookURL == "":
+				return fmt.Errorf("destination %s needs a webhook_url", name)
+			case (destination.ClientCert == "") != (destination.ClientKey == ""):
+				return fmt.Errorf("destination %s needs both client_cert and client_key for mutual TLS", name)
+			case destination.Secret == "":
+				log.Printf("⚠️  Destination %s has no secret, its requests will not be signed", name)
+			}
+		case "file":
+			if destination.Path == "" {
+				return fmt.Errorf("destination %s needs a path", name)
+			}
+		default:
+			return fmt.Errorf("destination %s has an unknown type %q\n\n"+
+				"💡 Use \"console\", \"discord\", \"telegram\", \"slack\", \"webhook\" or \"file\".", name, destination.Type)
+		}
+	}
+
+	for i, route := range c.Routes {
+		context := fmt.Sprintf("routes[%d]", i)
+		if len(route.Destinations) == 0 {
+			return fmt.Errorf("%s has no destinations", context)
+		}
+		if err := c.validateDestinationNames(context, route.Destinations); err != nil {
+			return err
+		}
+		if err := c.validateConditions(context, route.Levels, route.Groups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateConditions checks the levels and wallet groups a route or chat matches on
+func (c *Config) validateConditions(context string, levels, groups []string) error {
+	for _, level := range levels {
+		switch strings.ToLower(level) {
+		case "info", "warning", "critical":
+		default:
+			return fmt.Errorf("%s has an invalid level %q\n\n"+
+				"💡 Use \"info\", \"warning\" or \"critical\".", context, level)
+		}
+	}
+	for _, group := range groups {
+		if _, ok := c.WalletGroups[group]; !ok {
+			return fmt.Errorf("%s refers to wallet group %q, which is not in wallet_groups", context, group)
+		}
+	}
+	return nil
+}
+
+// validateDestinationNames checks that every name refers to a configured destination
+func (c *Config) validateDestinationNames(context string, names []string) error {
+	for _, name := range names {
+		found := false
+		for _, destination := range c.AlertDestinations() {
+			if destination.DestinationName() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s sends to destination %q, which is not configured\n\n"+
+				"💡 Add it to destinations, or use one of the configured names.", context, name)
+		}
+	}
+	return nil
+}
+
+// validateRules checks the alert rules, naming a rule by its position when it has no name
+func (c *Config) validateRules() error {
+	for i, rule := range c.Alerts.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		switch strings.ToLower(rule.Level) {
+		case "", "info", "warning", "critical":
+		default:
+			return fmt.Errorf("alert rule %s has an invalid level %q\n\n"+
+				"💡 Use \"info\", \"warning\" or \"critical\", or leave it out to keep the default level.", name, rule.Level)
+		}
+		for _, duration := range []string{rule.MaxTokenAge, rule.MinTokenAge, rule.SuppressFor} {
+			if duration == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(duration); err != nil || d <= 0 {
+				return fmt.Errorf("alert rule %s has an invalid duration %q\n\n"+
+					"💡 Use a duration like \"30m\" or \"24h\".", name, duration)
+			}
+		}
+		for _, group := range rule.Groups {
+			if _, ok := c.WalletGroups[group]; !ok {
+				return fmt.Errorf("alert rule %s refers to wallet group %q, which is not in wallet_groups", name, group)
+			}
+		}
+		if rule.MinChangePercent < 0 || rule.MinUSDValue < 0 || rule.MinUSDChange < 0 {
+			return fmt.Errorf("alert rule %s has a negative threshold", name)
+		}
+		if err := c.validateDestinationNames("alert rule "+name, rule.Destinations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // validateRPCEndpoint checks if user is using a public RPC and warns them
 func (c *Config) validateRPCEndpoint() {
+	if len(c.RPCEndpoints) > 0 {
+		log.Printf("✅ Using a pool of %d RPC endpoints", len(c.RPCEndpoints))
+		return
+	}
+
 	isPublicRPC := false
 	for _, publicURL := range publicRPCEndpoints {
 		if strings.EqualFold(c.NetworkURL, publicURL) {
@@ -104,6 +622,23 @@ func (c *Config) validateRPCEndpoint() {
 	}
 }
 
+// StreamURL returns the PubSub endpoint, derived from the first RPC endpoint when not set explicitly
+func (c *Config) StreamURL() string {
+	if c.Stream.WebsocketURL != "" {
+		return c.Stream.WebsocketURL
+	}
+
+	networkURL := c.Endpoints()[0].URL
+	switch {
+	case strings.HasPrefix(networkURL, "https://"):
+		return "wss://" + strings.TrimPrefix(networkURL, "https://")
+	case strings.HasPrefix(networkURL, "http://"):
+		return "ws://" + strings.TrimPrefix(networkURL, "http://")
+	default:
+		return networkURL
+	}
+}
+
 // LoadConfig loads configuration from a JSON file
 func LoadConfig(path string) (*Config, error) {
 	file, err := os.ReadFile(path)
@@ -0,0 +1,434 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	signaturePageSize        = 50 // Signatures requested per token account and page
+	maxSignaturePages        = 5  // Pages walked back per token account to reach the previous snapshot
+	maxTransactionsPerChange = 5  // Most recent transactions kept per change
+	maxCounterparties        = 3
+)
+
+// Transaction is an on-chain transaction that moved the balance behind a change
+type Transaction struct {
+	Signature      string    `json:"signature"`
+	Slot           uint64    `json:"slot"`
+	BlockTime      time.Time `json:"block_time"`               // Zero when the node returned none
+	Programs       []string  `json:"programs,omitempty"`       // Programs invoked by the top-level instructions
+	Counterparties []string  `json:"counterparties,omitempty"` // Owners whose balance moved the other way, largest first
+	Swap           *Swap     `json:"swap,omitempty"`           // Set when the transaction is a DEX trade by the wallet
+}
+
+var programNames = map[string]string{
+	solana.SystemProgramID.String():                    "System",
+	solana.TokenProgramID.String():                     "Token",
+	solana.Token2022ProgramID.String():                 "Token-2022",
+	solana.SPLAssociatedTokenAccountProgramID.String(): "Associated Token",
+	solana.MemoProgramID.String():                      "Memo",
+}
+
+// ProgramName returns a readable name for well-known programs, otherwise the address itself
+func ProgramName(programID string) string {
+	if name, ok := programNames[programID]; ok {
+		return name
+	}
+	if name, ok := swapPrograms[programID]; ok {
+		return name
+	}
+	return programID
+}
+
+// AttributeChanges attaches to each change the transactions that touched its accounts after
+// the previous snapshot slot, up to the slot of the new snapshot. Attribution is best effort:
+// a change whose transactions cannot be fetched is reported without them.
+func (w *WalletMonitor) AttributeChanges(ctx context.Context, changes []Change, oldData, newData map[string]*WalletData) {
+	fetched := make(map[solana.Signature]*rpc.GetTransactionResult)
+
+	for i := range changes {
+		change := &changes[i]
+		if change.ChangeType == "new_wallet" {
+			// A baseline has no previous snapshot to start from, but may have been backfilled
+			if w.history != nil {
+				if events, err := w.history.Events(change.WalletAddress); err != nil {
+					log.Printf("⚠️ Could not read history of wallet %s: %v", change.WalletAddress, err)
+				} else {
+					change.History = SummarizeHistory(events)
+				}
+			}
+			continue
+		}
+
+		// A token the wallet held and sold before is a re-entry, not a first buy
+		if change.ChangeType == "new_token" && w.history != nil {
+			if held, err := w.history.HeldMint(change.WalletAddress, change.TokenMint); err != nil {
+				log.Printf("⚠️ Could not read history of wallet %s: %v", change.WalletAddress, err)
+			} else if held {
+				change.FirstBuy = false
+			}
+		}
+
+		oldWallet, newWallet := oldData[change.WalletAddress], newData[change.WalletAddress]
+		accounts := changeAccounts(*change, oldWallet, newWallet)
+		if len(accounts) == 0 {
+			continue
+		}
+
+		var fromSlot, toSlot uint64
+		if oldWallet != nil {
+			fromSlot = oldWallet.Slot
+		}
+		if newWallet != nil {
+			toSlot = newWallet.Slot
+		}
+
+		signatures, err := w.signaturesBetween(ctx, accounts, fromSlot, toSlot)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("⚠️ Could not fetch transactions for %s in wallet %s: %v", change.TokenSymbol, change.WalletAddress, err)
+			continue
+		}
+
+		for _, sig := range signatures {
+			result, ok := fetched[sig.Signature]
+			if !ok {
+				result, err = w.getTransaction(ctx, sig.Signature)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Printf("⚠️ Could not fetch transaction %s: %v", sig.Signature, err)
+					continue
+				}
+				fetched[sig.Signature] = result
+			}
+			change.Transactions = append(change.Transactions, summarizeTransaction(sig, result, *change))
+		}
+	}
+
+	w.labelSwaps(ctx, changes)
+}
+
+// labelSwaps fills in the symbols of traded tokens, from the change itself where possible
+func (w *WalletMonitor) labelSwaps(ctx context.Context, changes []Change) {
+	var missing []solana.PublicKey
+	for _, change := range changes {
+		for _, tx := range change.Transactions {
+			if tx.Swap == nil {
+				continue
+			}
+			for _, side := range []struct{ mint, symbol *string }{
+				{&tx.Swap.InputMint, &tx.Swap.InputSymbol},
+				{&tx.Swap.OutputMint, &tx.Swap.OutputSymbol},
+			} {
+				switch {
+				case *side.symbol != "":
+				case *side.mint == change.TokenMint && change.TokenSymbol != "":
+					*side.symbol = change.TokenSymbol
+				default:
+					if mint, err := solana.PublicKeyFromBase58(*side.mint); err == nil {
+						missing = append(missing, mint)
+					}
+				}
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	metadata := w.metadata.Resolve(ctx, missing)
+	for _, change := range changes {
+		for _, tx := range change.Transactions {
+			if tx.Swap == nil {
+				continue
+			}
+			if meta, ok := metadata[tx.Swap.InputMint]; ok && tx.Swap.InputSymbol == "" {
+				tx.Swap.InputSymbol = meta.DisplaySymbol()
+			}
+			if meta, ok := metadata[tx.Swap.OutputMint]; ok && tx.Swap.OutputSymbol == "" {
+				tx.Swap.OutputSymbol = meta.DisplaySymbol()
+			}
+		}
+	}
+}
+
+// changeAccounts lists the accounts whose signatures explain a change: the wallet itself for
+// native SOL, otherwise every token account of the mint in either snapshot
+func changeAccounts(change Change, oldWallet, newWallet *WalletData) []solana.PublicKey {
+	if change.ChangeType == "sol_balance_change" {
+		wallet, err := solana.PublicKeyFromBase58(change.WalletAddress)
+		if err != nil {
+			return nil
+		}
+		return []solana.PublicKey{wallet}
+	}
+
+	seen := make(map[string]bool)
+	for _, data := range []*WalletData{oldWallet, newWallet} {
+		if data == nil {
+			continue
+		}
+		for account := range data.TokenAccounts[change.TokenMint].Accounts {
+			seen[account] = true
+		}
+	}
+
+	accounts := make([]solana.PublicKey, 0, len(seen))
+	for account := range seen {
+		if key, err := solana.PublicKeyFromBase58(account); err == nil {
+			accounts = append(accounts, key)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].String() < accounts[j].String() })
+	return accounts
+}
+
+// signaturesBetween returns the successful transactions that touched any of the accounts in
+// (fromSlot, toSlot], oldest first and capped to the most recent maxTransactionsPerChange.
+// A zero fromSlot (snapshot from before slots were recorded) leaves the range open. Each
+// account is paged back from its newest signature until fromSlot, or until it has given
+// enough transactions, at most maxSignaturePages pages.
+func (w *WalletMonitor) signaturesBetween(ctx context.Context, accounts []solana.PublicKey, fromSlot, toSlot uint64) ([]*rpc.TransactionSignature, error) {
+	seen := make(map[solana.Signature]bool)
+	var signatures []*rpc.TransactionSignature
+	for _, account := range accounts {
+		var before solana.Signature
+		found := 0
+		for pages := 0; pages < maxSignaturePages; pages++ {
+			limit := signaturePageSize
+			opts := &rpc.GetSignaturesForAddressOpts{
+				Limit:      &limit,
+				Before:     before,
+				Commitment: w.historyCommitment(),
+			}
+			if toSlot > 0 {
+				opts.MinContextSlot = &toSlot
+			}
+			callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+			page, err := w.client.GetSignaturesForAddressWithOpts(callCtx, account, opts)
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("getSignaturesForAddress %s: %w", account, err)
+			}
+
+			// Pages are newest first, past fromSlot everything is older
+			done := len(page) < signaturePageSize
+			for _, sig := range page {
+				if sig.Slot <= fromSlot {
+					done = true
+					break
+				}
+				// Failed transactions leave balances untouched
+				if sig.Err != nil || (toSlot > 0 && sig.Slot > toSlot) {
+					continue
+				}
+				found++
+				if !seen[sig.Signature] {
+					seen[sig.Signature] = true
+					signatures = append(signatures, sig)
+				}
+			}
+			if done || found >= maxTransactionsPerChange {
+				break
+			}
+			before = page[len(page)-1].Signature
+		}
+	}
+
+	sort.SliceStable(signatures, func(i, j int) bool { return signatures[i].Slot < signatures[j].Slot })
+	if len(signatures) > maxTransactionsPerChange {
+		signatures = signatures[len(signatures)-maxTransactionsPerChange:]
+	}
+	return signatures, nil
+}
+
+// errTransactionUnavailable is returned for transactions the node does not have (yet)
+var errTransactionUnavailable = errors.New("transaction not available")
+
+func (w *WalletMonitor) getTransaction(ctx context.Context, signature solana.Signature) (*rpc.GetTransactionResult, error) {
+	callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+	defer cancel()
+
+	maxVersion := uint64(0)
+	result, err := w.client.GetTransaction(callCtx, signature, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     w.historyCommitment(),
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || result.Transaction == nil || result.Meta == nil {
+		return nil, errTransactionUnavailable
+	}
+	return result, nil
+}
+
+// historyCommitment is the configured commitment, except processed, which
+// getSignaturesForAddress and getTransaction do not support
+func (w *WalletMonitor) historyCommitment() rpc.CommitmentType {
+	if w.commitment == rpc.CommitmentProcessed {
+		return rpc.CommitmentConfirmed
+	}
+	return w.commitment
+}
+
+// summarizeTransaction extracts the programs invoked and the counterparties of the change's owner
+func summarizeTransaction(sig *rpc.TransactionSignature, result *rpc.GetTransactionResult, change Change) Transaction {
+	summary := Transaction{
+		Signature: sig.Signature.String(),
+		Slot:      sig.Slot,
+	}
+	if sig.BlockTime != nil {
+		summary.BlockTime = sig.BlockTime.Time().UTC()
+	}
+
+	tx, err := result.Transaction.GetTransaction()
+	if err != nil {
+		return summary
+	}
+	keys := transactionAccountKeys(tx, result.Meta)
+
+	seen := make(map[string]bool)
+	for _, inst := range tx.Message.Instructions {
+		if int(inst.ProgramIDIndex) >= len(keys) {
+			continue
+		}
+		program := keys[inst.ProgramIDIndex]
+		if program.Equals(solana.ComputeBudget) || seen[program.String()] {
+			continue
+		}
+		seen[program.String()] = true
+		summary.Programs = append(summary.Programs, program.String())
+	}
+
+	var deltas map[string]float64
+	if change.ChangeType == "sol_balance_change" {
+		deltas = lamportDeltas(keys, result.Meta)
+	} else {
+		deltas = make(map[string]float64)
+		for _, delta := range tokenBalanceDeltas(result.Meta) {
+			if delta.Mint == change.TokenMint {
+				deltas[delta.Owner] += delta.Amount()
+			}
+		}
+	}
+	summary.Counterparties = counterparties(deltas, change.WalletAddress)
+	summary.Swap, _ = decodeSwap(tx, result.Meta, change.WalletAddress)
+	return summary
+}
+
+// transactionAccountKeys returns the static account keys followed by the ones loaded from
+// address lookup tables, the order instruction and balance indexes refer to
+func transactionAccountKeys(tx *solana.Transaction, meta *rpc.TransactionMeta) []solana.PublicKey {
+	keys := append([]solana.PublicKey{}, tx.Message.AccountKeys...)
+	if meta != nil {
+		keys = append(keys, meta.LoadedAddresses.Writable...)
+		keys = append(keys, meta.LoadedAddresses.ReadOnly...)
+	}
+	return keys
+}
+
+func lamportDeltas(keys []solana.PublicKey, meta *rpc.TransactionMeta) map[string]float64 {
+	deltas := make(map[string]float64)
+	for i := 0; i < len(keys) && i < len(meta.PreBalances) && i < len(meta.PostBalances); i++ {
+		deltas[keys[i].String()] += float64(meta.PostBalances[i]) - float64(meta.PreBalances[i])
+	}
+	return deltas
+}
+
+// tokenBalanceDelta is how much of a mint one token account gained or lost in a transaction
+type tokenBalanceDelta struct {
+	Owner    string
+	Mint     string
+	Decimals uint8
+	Pre      uint64
+	Post     uint64
+}
+
+// Amount is the signed change in raw token units
+func (d tokenBalanceDelta) Amount() float64 {
+	return float64(d.Post) - float64(d.Pre)
+}
+
+// tokenBalanceDeltas pairs pre and post token balances by account. Accounts created or
+// closed in the transaction only appear on one side and count as zero on the other.
+func tokenBalanceDeltas(meta *rpc.TransactionMeta) []tokenBalanceDelta {
+	byAccount := make(map[uint16]*tokenBalanceDelta)
+	var order []uint16
+
+	add := func(balances []rpc.TokenBalance, post bool) {
+		for _, balance := range balances {
+			delta, ok := byAccount[balance.AccountIndex]
+			if !ok {
+				delta = &tokenBalanceDelta{Mint: balance.Mint.String()}
+				if balance.Owner != nil {
+					delta.Owner = balance.Owner.String()
+				}
+				byAccount[balance.AccountIndex] = delta
+				order = append(order, balance.AccountIndex)
+			}
+
+			var amount uint64
+			if balance.UiTokenAmount != nil {
+				amount, _ = strconv.ParseUint(balance.UiTokenAmount.Amount, 10, 64)
+				delta.Decimals = balance.UiTokenAmount.Decimals
+			}
+			if post {
+				delta.Post = amount
+			} else {
+				delta.Pre = amount
+			}
+		}
+	}
+	add(meta.PreTokenBalances, false)
+	add(meta.PostTokenBalances, true)
+
+	deltas := make([]tokenBalanceDelta, 0, len(order))
+	for _, index := range order {
+		if delta := byAccount[index]; delta.Pre != delta.Post {
+			deltas = append(deltas, *delta)
+		}
+	}
+	return deltas
+}
+
+// counterparties returns the addresses whose balance moved opposite to the wallet's, largest first
+func counterparties(deltas map[string]float64, wallet string) []string {
+	own := deltas[wallet]
+	if own == 0 {
+		return nil
+	}
+
+	var addresses []string
+	for address, delta := range deltas {
+		if address != wallet && address != "" && delta != 0 && (delta > 0) != (own > 0) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		a, b := math.Abs(deltas[addresses[i]]), math.Abs(deltas[addresses[j]])
+		if a != b {
+			return a > b
+		}
+		return addresses[i] < addresses[j]
+	})
+	if len(addresses) > maxCounterparties {
+		addresses = addresses[:maxCounterparties]
+	}
+	return addresses
+}
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeChanges(t *testing.T) {
+	wallet := solana.MustPublicKeyFromBase58(testWallet)
+	account := solana.NewWallet().PublicKey()
+	seller := solana.NewWallet().PublicKey()
+	sellerAccount := solana.NewWallet().PublicKey()
+	mint := solana.NewWallet().PublicKey()
+
+	// A token transfer from the seller, preceded by a compute budget instruction
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		solana.NewInstruction(solana.ComputeBudget, solana.AccountMetaSlice{}, []byte{2}),
+		solana.NewInstruction(solana.TokenProgramID, solana.AccountMetaSlice{
+			solana.Meta(sellerAccount).WRITE(),
+			solana.Meta(account).WRITE(),
+			solana.Meta(seller).SIGNER(),
+		}, []byte{3}),
+	}, solana.Hash{}, solana.TransactionPayer(seller))
+	require.NoError(t, err)
+	tx.Signatures = []solana.Signature{{}}
+	raw, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	index := func(key solana.PublicKey) int {
+		for i, k := range tx.Message.AccountKeys {
+			if k.Equals(key) {
+				return i
+			}
+		}
+		return -1
+	}
+	balance := func(key, owner solana.PublicKey, amount string) map[string]interface{} {
+		return map[string]interface{}{
+			"accountIndex":  index(key),
+			"mint":          mint.String(),
+			"owner":         owner.String(),
+			"uiTokenAmount": map[string]interface{}{"amount": amount, "decimals": 6},
+		}
+	}
+
+	inRange := solana.Signature{1}
+	signatures := []map[string]interface{}{
+		{"signature": inRange.String(), "slot": 150, "blockTime": 1700000000}, // The transfer
+		{"signature": solana.Signature{2}.String(), "slot": 140, "err": map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}},
+		{"signature": solana.Signature{3}.String(), "slot": 90}, // Before the old snapshot
+	}
+	// More transactions after the new snapshot than fit a page
+	for i := 0; i < signaturePageSize+10; i++ {
+		signatures = append([]map[string]interface{}{{"signature": solana.Signature{4, byte(i)}.String(), "slot": 250}}, signatures...)
+	}
+	var transactionRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     interface{}     `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		var params []interface{}
+		_ = json.Unmarshal(req.Params, &params)
+
+		var result interface{}
+		switch req.Method {
+		case "getSignaturesForAddress":
+			opts, _ := params[len(params)-1].(map[string]interface{})
+			before, _ := opts["before"].(string)
+			page := signatures
+			for i, sig := range signatures {
+				if sig["signature"] == before {
+					page = signatures[i+1:]
+				}
+			}
+			result = page[:min(len(page), signaturePageSize)]
+		case "getTransaction":
+			atomic.AddInt32(&transactionRequests, 1)
+			result = map[string]interface{}{
+				"slot":        150,
+				"blockTime":   1700000000,
+				"transaction": []string{base64.StdEncoding.EncodeToString(raw), "base64"},
+				"meta": map[string]interface{}{
+					"err":               nil,
+					"preTokenBalances":  []interface{}{balance(account, wallet, "1000"), balance(sellerAccount, seller, "9000")},
+					"postTokenBalances": []interface{}{balance(account, wallet, "5000"), balance(sellerAccount, seller, "5000")},
+				},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	defer server.Close()
+
+	w, err := NewWalletMonitor(server.URL, []string{testWallet}, nil)
+	require.NoError(t, err)
+
+	snapshot := func(slot, balance uint64) map[string]*WalletData {
+		return map[string]*WalletData{testWallet: {
+			WalletAddress: testWallet,
+			Slot:          slot,
+			TokenAccounts: map[string]TokenAccountInfo{mint.String(): {
+				Balance:  balance,
+				Accounts: map[string]uint64{account.String(): balance},
+			}},
+		}}
+	}
+	changes := []Change{
+		{WalletAddress: testWallet, TokenMint: mint.String(), ChangeType: "balance_change", OldBalance: 1000, NewBalance: 5000},
+		{WalletAddress: testWallet, TokenMint: mint.String(), ChangeType: "balance_change", OldBalance: 1000, NewBalance: 5000},
+	}
+	w.AttributeChanges(context.Background(), changes, snapshot(100, 1000), snapshot(200, 5000))
+
+	for _, change := range changes {
+		require.Len(t, change.Transactions, 1)
+		attributed := change.Transactions[0]
+		assert.Equal(t, inRange.String(), attributed.Signature)
+		assert.Equal(t, uint64(150), attributed.Slot)
+		assert.Equal(t, int64(1700000000), attributed.BlockTime.Unix())
+		assert.Equal(t, []string{solana.TokenProgramID.String()}, attributed.Programs)
+		assert.Equal(t, []string{seller.String()}, attributed.Counterparties)
+	}
+	// A transaction shared by several changes is fetched once
+	assert.Equal(t, int32(1), atomic.LoadInt32(&transactionRequests))
+}
@@ -0,0 +1,405 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// backfillPageSize is the largest page getSignaturesForAddress returns
+const backfillPageSize = 1000
+
+// HistoryEvent is a wallet's net movement of one mint in a past transaction
+type HistoryEvent struct {
+	Signature     string    `json:"signature"`
+	Slot          uint64    `json:"slot"`
+	BlockTime     time.Time `json:"block_time"` // Zero when the node returned none
+	WalletAddress string    `json:"wallet_address"`
+	Mint          string    `json:"mint"`
+	Decimals      uint8     `json:"decimals"`
+	PreBalance    uint64    `json:"pre_balance"`  // Summed over the wallet's accounts of the mint
+	PostBalance   uint64    `json:"post_balance"` // Summed over the wallet's accounts of the mint
+	Swap          *Swap     `json:"swap,omitempty"`
+}
+
+// Key identifies an event, storing the same key twice is a no-op
+func (e HistoryEvent) Key() string {
+	return e.Signature + ":" + e.Mint
+}
+
+// Held reports whether the wallet had a balance of the mint before or after the event
+func (e HistoryEvent) Held() bool {
+	return e.PreBalance > 0 || e.PostBalance > 0
+}
+
+// HistorySource gives scans access to backfilled history
+type HistorySource interface {
+	Events(wallet string) ([]HistoryEvent, error)
+	// HeldMint reports whether the wallet had a balance of mint at any point of its history
+	HeldMint(wallet, mint string) (bool, error)
+}
+
+// HistorySummary condenses a wallet's backfilled history for alerts
+type HistorySummary struct {
+	Transactions int       `json:"transactions"`
+	Buys         int       `json:"buys"`
+	Sells        int       `json:"sells"`
+	Swaps        int       `json:"swaps"` // Token-to-token
+	Tokens       int       `json:"tokens"`
+	FirstSeen    time.Time `json:"first_seen"` // Zero without block times
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// SummarizeHistory counts the transactions, trades and tokens in a wallet's history
+func SummarizeHistory(events []HistoryEvent) *HistorySummary {
+	if len(events) == 0 {
+		return nil
+	}
+
+	summary := &HistorySummary{}
+	signatures := make(map[string]bool)
+	mints := make(map[string]bool)
+	for _, event := range events {
+		mints[event.Mint] = true
+		if !event.BlockTime.IsZero() {
+			if summary.FirstSeen.IsZero() || event.BlockTime.Before(summary.FirstSeen) {
+				summary.FirstSeen = event.BlockTime
+			}
+			if event.BlockTime.After(summary.LastSeen) {
+				summary.LastSeen = event.BlockTime
+			}
+		}
+		if signatures[event.Signature] {
+			continue // Events of the same transaction share its swap
+		}
+		signatures[event.Signature] = true
+
+		if event.Swap != nil {
+			switch event.Swap.Side {
+			case SwapBuy:
+				summary.Buys++
+			case SwapSell:
+				summary.Sells++
+			default:
+				summary.Swaps++
+			}
+		}
+	}
+	summary.Transactions = len(signatures)
+	summary.Tokens = len(mints)
+	return summary
+}
+
+// BackfillCheckpoint records how much of a wallet's history has been covered, so an
+// interrupted backfill resumes where it stopped and a later one only fetches what is new.
+// The history between Oldest and Newest is complete.
+type BackfillCheckpoint struct {
+	Newest     string    `json:"newest,omitempty"` // Newest signature covered
+	NewestSlot uint64    `json:"newest_slot,omitempty"`
+	Oldest     string    `json:"oldest,omitempty"` // Oldest signature covered, deeper pages start before it
+	OldestSlot uint64    `json:"oldest_slot,omitempty"`
+	OldestTime time.Time `json:"oldest_time"` // Zero until a page with block times was read
+	ReachedEnd bool      `json:"reached_end"` // The wallet has no older transactions
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HistorySink persists backfilled events and checkpoints as the backfill goes
+type HistorySink interface {
+	// AddEvents stores the events whose keys are not stored yet and returns how many were new
+	AddEvents(wallet string, events []HistoryEvent) (int, error)
+	// Checkpoint returns nil when the wallet was never backfilled
+	Checkpoint(wallet string) (*BackfillCheckpoint, error)
+	SaveCheckpoint(wallet string, checkpoint *BackfillCheckpoint) error
+}
+
+// BackfillOptions bounds how far back a backfill goes. With neither set it goes back to
+// the wallet's first transaction.
+type BackfillOptions struct {
+	Since     time.Time // Oldest block time to include
+	SinceSlot uint64    // Oldest slot to include
+}
+
+// reached reports whether a transaction is older than the requested start
+func (o BackfillOptions) reached(slot uint64, blockTime time.Time) bool {
+	if o.SinceSlot > 0 && slot < o.SinceSlot {
+		return true
+	}
+	return !o.Since.IsZero() && !blockTime.IsZero() && blockTime.Before(o.Since)
+}
+
+// BackfillResult summarizes one backfill run of a wallet
+type BackfillResult struct {
+	Transactions int // Transactions fetched in this run
+	Events       int // Events that were not stored yet
+	Complete     bool
+}
+
+// Backfill pages through the wallet's signatures back to the requested start and stores the
+// token balance movements of every successful transaction. Transactions newer than the
+// checkpoint are fetched first, then the backfill continues below the oldest covered one.
+// Every page is stored before the checkpoint moves, so stopping at any point loses nothing
+// and running it again only repeats work that is deduplicated on storage.
+func (w *WalletMonitor) Backfill(ctx context.Context, addr string, opts BackfillOptions, sink HistorySink) (*BackfillResult, error) {
+	wallet, err := solana.PublicKeyFromBase58(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wallet address %s: %v", addr, err)
+	}
+	checkpoint, err := sink.Checkpoint(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backfill checkpoint: %w", err)
+	}
+	if checkpoint == nil {
+		checkpoint = &BackfillCheckpoint{}
+	}
+	result := &BackfillResult{}
+
+	// Newer than the checkpoint: from the top down to the newest covered signature. The
+	// checkpoint only moves up once the gap is closed, a partial catch-up is redone.
+	if checkpoint.Newest != "" {
+		until := solana.MustSignatureFromBase58(checkpoint.Newest)
+		var before solana.Signature
+		var top *rpc.TransactionSignature
+		for {
+			page, err := w.signaturePage(ctx, wallet, before, until)
+			if err != nil {
+				return result, err
+			}
+			if top == nil && len(page) > 0 {
+				top = page[0]
+			}
+			if err := w.storeHistoryPage(ctx, wallet, page, sink, result); err != nil {
+				return result, err
+			}
+			if len(page) < backfillPageSize {
+				break
+			}
+			before = page[len(page)-1].Signature
+		}
+		if top != nil {
+			checkpoint.Newest, checkpoint.NewestSlot = top.Signature.String(), top.Slot
+			if err := w.saveCheckpoint(sink, addr, checkpoint); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// Older than the checkpoint: down from the oldest covered signature to the requested start
+	reachedStart := false
+	for !checkpoint.ReachedEnd && !reachedStart {
+		var before solana.Signature
+		if checkpoint.Oldest != "" {
+			before = solana.MustSignatureFromBase58(checkpoint.Oldest)
+		}
+		page, err := w.signaturePage(ctx, wallet, before, solana.Signature{})
+		if err != nil {
+			return result, err
+		}
+
+		inRange := page
+		for i, sig := range page {
+			if opts.reached(sig.Slot, blockTime(sig)) {
+				inRange, reachedStart = page[:i], true
+				break
+			}
+		}
+		if err := w.storeHistoryPage(ctx, wallet, inRange, sink, result); err != nil {
+			return result, err
+		}
+
+		if len(inRange) > 0 {
+			if checkpoint.Newest == "" {
+				checkpoint.Newest, checkpoint.NewestSlot = inRange[0].Signature.String(), inRange[0].Slot
+			}
+			oldest := inRange[len(inRange)-1]
+			checkpoint.Oldest, checkpoint.OldestSlot, checkpoint.OldestTime = oldest.Signature.String(), oldest.Slot, blockTime(oldest)
+		}
+		checkpoint.ReachedEnd = !reachedStart && len(page) < backfillPageSize
+		if err := w.saveCheckpoint(sink, addr, checkpoint); err != nil {
+			return result, err
+		}
+
+		if len(inRange) > 0 {
+			log.Printf("📜 %s: %d transactions so far, back to slot %d (%s)",
+				addr, result.Transactions, checkpoint.OldestSlot, checkpoint.OldestTime.Format("2006-01-02 15:04"))
+		}
+	}
+
+	result.Complete = true
+	return result, nil
+}
+
+func (w *WalletMonitor) saveCheckpoint(sink HistorySink, wallet string, checkpoint *BackfillCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now()
+	if err := sink.SaveCheckpoint(wallet, checkpoint); err != nil {
+		return fmt.Errorf("failed to save backfill checkpoint: %w", err)
+	}
+	return nil
+}
+
+// signaturePage fetches up to backfillPageSize signatures before the given one (or from the
+// top), stopping at until. Both can be zero.
+func (w *WalletMonitor) signaturePage(ctx context.Context, wallet solana.PublicKey, before, until solana.Signature) ([]*rpc.TransactionSignature, error) {
+	limit := backfillPageSize
+	callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+	defer cancel()
+
+	page, err := w.client.GetSignaturesForAddressWithOpts(callCtx, wallet, &rpc.GetSignaturesForAddressOpts{
+		Limit:      &limit,
+		Before:     before,
+		Until:      until,
+		Commitment: w.historyCommitment(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getSignaturesForAddress %s: %w", wallet, err)
+	}
+	return page, nil
+}
+
+// storeHistoryPage fetches the successful transactions of a page with the scan workers
+// and stores the wallet's balance movements in them
+func (w *WalletMonitor) storeHistoryPage(ctx context.Context, wallet solana.PublicKey, page []*rpc.TransactionSignature, sink HistorySink, result *BackfillResult) error {
+	var signatures []*rpc.TransactionSignature
+	for _, sig := range page {
+		if sig.Err == nil {
+			signatures = append(signatures, sig)
+		}
+	}
+	if len(signatures) == 0 {
+		return nil
+	}
+
+	transactions := make([]*rpc.GetTransactionResult, len(signatures))
+	errs := make([]error, len(signatures))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < w.workers && n < len(signatures); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				transactions[i], errs[i] = w.getTransactionWithRetry(ctx, signatures[i].Signature)
+			}
+		}()
+	}
+feed:
+	for i := range signatures {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var events []HistoryEvent
+	for i, sig := range signatures {
+		if errors.Is(errs[i], errTransactionUnavailable) {
+			// Nodes without full history return nothing for old transactions, retrying won't help
+			log.Printf("⚠️ Skipping transaction %s: %v", sig.Signature, errs[i])
+			continue
+		}
+		if errs[i] != nil {
+			return fmt.Errorf("getTransaction %s: %w", sig.Signature, errs[i])
+		}
+		events = append(events, historyEvents(sig, transactions[i], wallet.String())...)
+	}
+	result.Transactions += len(signatures)
+
+	added, err := sink.AddEvents(wallet.String(), events)
+	if err != nil {
+		return fmt.Errorf("failed to store history: %w", err)
+	}
+	result.Events += added
+	return nil
+}
+
+// getTransactionWithRetry retries rate limited and lagging calls like the scans do
+func (w *WalletMonitor) getTransactionWithRetry(ctx context.Context, signature solana.Signature) (*rpc.GetTransactionResult, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		result, err := w.getTransaction(ctx, signature)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+		if !isRateLimited(err) && !errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+
+		wait := w.pool.RetryAfter()
+		if wait <= 0 {
+			wait = laggingNodeRetryDelay
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return nil, lastErr
+}
+
+// historyEvents nets the wallet's token balances per mint in a transaction
+func historyEvents(sig *rpc.TransactionSignature, result *rpc.GetTransactionResult, wallet string) []HistoryEvent {
+	if result == nil || result.Meta == nil {
+		return nil
+	}
+
+	byMint := make(map[string]*HistoryEvent)
+	for _, delta := range tokenBalanceDeltas(result.Meta) {
+		if delta.Owner != wallet {
+			continue
+		}
+		event, ok := byMint[delta.Mint]
+		if !ok {
+			event = &HistoryEvent{
+				Signature:     sig.Signature.String(),
+				Slot:          sig.Slot,
+				BlockTime:     blockTime(sig),
+				WalletAddress: wallet,
+				Mint:          delta.Mint,
+				Decimals:      delta.Decimals,
+			}
+			byMint[delta.Mint] = event
+		}
+		event.PreBalance += delta.Pre
+		event.PostBalance += delta.Post
+	}
+	if len(byMint) == 0 {
+		return nil
+	}
+
+	var swap *Swap
+	if tx, err := result.Transaction.GetTransaction(); err == nil {
+		swap, _ = decodeSwap(tx, result.Meta, wallet)
+	}
+
+	events := make([]HistoryEvent, 0, len(byMint))
+	for _, event := range byMint {
+		event.Swap = swap
+		events = append(events, *event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Mint < events[j].Mint })
+	return events
+}
+
+func blockTime(sig *rpc.TransactionSignature) time.Time {
+	if sig.BlockTime == nil {
+		return time.Time{}
+	}
+	return sig.BlockTime.Time().UTC()
+}
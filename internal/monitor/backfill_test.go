@@ -0,0 +1,179 @@
+package monitor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryHistory is a HistorySink that keeps everything in memory
+type memoryHistory struct {
+	mu          sync.Mutex
+	events      map[string]HistoryEvent
+	checkpoints map[string]*BackfillCheckpoint
+}
+
+func newMemoryHistory() *memoryHistory {
+	return &memoryHistory{events: map[string]HistoryEvent{}, checkpoints: map[string]*BackfillCheckpoint{}}
+}
+
+func (m *memoryHistory) AddEvents(wallet string, events []HistoryEvent) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added := 0
+	for _, event := range events {
+		if _, ok := m.events[event.Key()]; !ok {
+			m.events[event.Key()] = event
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *memoryHistory) Checkpoint(wallet string) (*BackfillCheckpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if checkpoint, ok := m.checkpoints[wallet]; ok {
+		saved := *checkpoint
+		return &saved, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryHistory) SaveCheckpoint(wallet string, checkpoint *BackfillCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *checkpoint
+	m.checkpoints[wallet] = &saved
+	return nil
+}
+
+// newFakeHistoryRPC serves a wallet's signatures, newest first, honouring before and until.
+// Every transaction raises the wallet's balance of mint by 100.
+func newFakeHistoryRPC(t *testing.T, wallet, mint solana.PublicKey, slots *[]uint64) *httptest.Server {
+	account := solana.NewWallet().PublicKey()
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		solana.NewInstruction(solana.TokenProgramID, solana.AccountMetaSlice{solana.Meta(account).WRITE()}, []byte{3}),
+	}, solana.Hash{}, solana.TransactionPayer(wallet))
+	require.NoError(t, err)
+	tx.Signatures = []solana.Signature{{}}
+	raw, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	signature := func(slot uint64) solana.Signature {
+		return solana.Signature{byte(slot >> 8), byte(slot)}
+	}
+	balance := func(amount string) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"accountIndex":  1,
+			"mint":          mint.String(),
+			"owner":         wallet.String(),
+			"uiTokenAmount": map[string]interface{}{"amount": amount, "decimals": 6},
+		}}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     interface{}     `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		var result interface{}
+		switch req.Method {
+		case "getSignaturesForAddress":
+			var params []interface{}
+			_ = json.Unmarshal(req.Params, &params)
+			opts, _ := params[len(params)-1].(map[string]interface{})
+			before, _ := opts["before"].(string)
+			until, _ := opts["until"].(string)
+
+			page := []map[string]interface{}{}
+			started := before == ""
+			for _, slot := range *slots {
+				sig := signature(slot).String()
+				if sig == until {
+					break
+				}
+				if started {
+					page = append(page, map[string]interface{}{"signature": sig, "slot": slot, "blockTime": 1700000000 + slot})
+				}
+				if sig == before {
+					started = true
+				}
+			}
+			result = page
+		case "getTransaction":
+			result = map[string]interface{}{
+				"slot":        1,
+				"transaction": []string{base64.StdEncoding.EncodeToString(raw), "base64"},
+				"meta": map[string]interface{}{
+					"err":               nil,
+					"preTokenBalances":  balance("0"),
+					"postTokenBalances": balance("100"),
+				},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+func TestBackfillResumesAndDeduplicates(t *testing.T) {
+	wallet := solana.MustPublicKeyFromBase58(testWallet)
+	mint := solana.NewWallet().PublicKey()
+	slots := []uint64{500, 400, 300, 200, 100}
+	server := newFakeHistoryRPC(t, wallet, mint, &slots)
+	defer server.Close()
+
+	w, err := NewWalletMonitor(server.URL, []string{testWallet}, nil)
+	require.NoError(t, err)
+	sink := newMemoryHistory()
+
+	// Back to slot 200 only
+	result, err := w.Backfill(context.Background(), testWallet, BackfillOptions{SinceSlot: 200}, sink)
+	require.NoError(t, err)
+	assert.True(t, result.Complete)
+	assert.Equal(t, 4, result.Transactions)
+	assert.Equal(t, 4, result.Events)
+
+	checkpoint := sink.checkpoints[testWallet]
+	assert.Equal(t, uint64(500), checkpoint.NewestSlot)
+	assert.Equal(t, uint64(200), checkpoint.OldestSlot)
+	assert.False(t, checkpoint.ReachedEnd)
+
+	// A new transaction arrives and the complete history is requested: only the new one
+	// and the one below the previous start are fetched
+	slots = append([]uint64{600}, slots...)
+	result, err = w.Backfill(context.Background(), testWallet, BackfillOptions{}, sink)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Transactions)
+	assert.Equal(t, 2, result.Events)
+	assert.Len(t, sink.events, 6)
+
+	checkpoint = sink.checkpoints[testWallet]
+	assert.Equal(t, uint64(600), checkpoint.NewestSlot)
+	assert.Equal(t, uint64(100), checkpoint.OldestSlot)
+	assert.True(t, checkpoint.ReachedEnd)
+
+	// Nothing left to do
+	result, err = w.Backfill(context.Background(), testWallet, BackfillOptions{}, sink)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Transactions)
+
+	// Every event is the wallet's balance of the mint before and after
+	for _, event := range sink.events {
+		assert.Equal(t, mint.String(), event.Mint)
+		assert.Equal(t, uint64(0), event.PreBalance)
+		assert.Equal(t, uint64(100), event.PostBalance)
+		assert.Equal(t, uint8(6), event.Decimals)
+	}
+}
@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+)
+
+// ConvergenceEntry is one wallet's buy of a converging token
+type ConvergenceEntry struct {
+	WalletAddress string
+	Amount        uint64    // Raw units bought within the window
+	USDValue      float64   // Value of Amount when the token was priced
+	Time          time.Time // First buy within the window, from the block time when attributed
+}
+
+// Convergence is a token bought by several monitored wallets within the window
+type Convergence struct {
+	TokenMint     string
+	TokenSymbol   string
+	TokenName     string
+	TokenDecimals uint8
+	Entries       []ConvergenceEntry // In the order the wallets entered
+	Window        time.Duration
+}
+
+// Span is the time between the first and the last entry
+func (c Convergence) Span() time.Duration {
+	if len(c.Entries) == 0 {
+		return 0
+	}
+	return c.Entries[len(c.Entries)-1].Time.Sub(c.Entries[0].Time)
+}
+
+// ConvergenceDetector correlates buys across wallets. DetectChanges looks at one wallet at a
+// time, the detector keeps a sliding window of buys per mint and reports the mints that
+// enough distinct wallets bought within it.
+type ConvergenceDetector struct {
+	window     time.Duration
+	minWallets int
+	buys       map[string][]ConvergenceEntry // Mint -> buys in the window, oldest first
+	tokens     map[string]Change             // Mint -> latest change, for the token details
+	reported   map[string]map[string]bool    // Mint -> wallets already reported as converging
+}
+
+func NewConvergenceDetector(cfg config.ConvergenceConfig) *ConvergenceDetector {
+	return &ConvergenceDetector{
+		window:     cfg.WindowDuration(),
+		minWallets: cfg.MinimumWallets(),
+		buys:       make(map[string][]ConvergenceEntry),
+		tokens:     make(map[string]Change),
+		reported:   make(map[string]map[string]bool),
+	}
+}
+
+// Observe adds the buys among changes and returns the mints that converge. A mint is reported
+// once it reaches the minimum number of wallets and again every time a wallet that was not
+// reported yet joins. Wallets whose buys fell out of the window count as new when they return.
+func (c *ConvergenceDetector) Observe(changes []Change, now time.Time) []Convergence {
+	touched := make(map[string]bool)
+	for _, change := range changes {
+		amount, ok := boughtAmount(change)
+		if !ok {
+			continue
+		}
+		entry := ConvergenceEntry{
+			WalletAddress: change.WalletAddress,
+			Amount:        amount,
+			Time:          entryTime(change, now),
+		}
+		if change.USDPrice > 0 {
+			entry.USDValue = uiAmount(amount, change.TokenDecimals) * change.USDPrice
+		}
+		c.buys[change.TokenMint] = append(c.buys[change.TokenMint], entry)
+		c.tokens[change.TokenMint] = change
+		touched[change.TokenMint] = true
+	}
+
+	c.expire(now)
+
+	var convergences []Convergence
+	for mint := range touched {
+		entries := c.entries(mint)
+		if len(entries) < c.minWallets {
+			continue
+		}
+		reported, ok := c.reported[mint]
+		if !ok {
+			reported = make(map[string]bool)
+			c.reported[mint] = reported
+		}
+		joined := false
+		for _, entry := range entries {
+			if !reported[entry.WalletAddress] {
+				reported[entry.WalletAddress] = true
+				joined = true
+			}
+		}
+		if !joined {
+			continue
+		}
+
+		token := c.tokens[mint]
+		convergences = append(convergences, Convergence{
+			TokenMint:     mint,
+			TokenSymbol:   token.TokenSymbol,
+			TokenName:     token.TokenName,
+			TokenDecimals: token.TokenDecimals,
+			Entries:       entries,
+			Window:        c.window,
+		})
+	}
+	sort.Slice(convergences, func(i, j int) bool { return convergences[i].TokenMint < convergences[j].TokenMint })
+	return convergences
+}
+
+// expire drops buys that fell out of the window, and forgets mints without any
+func (c *ConvergenceDetector) expire(now time.Time) {
+	cutoff := now.Add(-c.window)
+	for mint, buys := range c.buys {
+		kept := buys[:0]
+		wallets := make(map[string]bool)
+		for _, buy := range buys {
+			if buy.Time.After(cutoff) {
+				kept = append(kept, buy)
+				wallets[buy.WalletAddress] = true
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.buys, mint)
+			delete(c.tokens, mint)
+			delete(c.reported, mint)
+			continue
+		}
+		c.buys[mint] = kept
+		for wallet := range c.reported[mint] {
+			if !wallets[wallet] {
+				delete(c.reported[mint], wallet)
+			}
+		}
+	}
+}
+
+// entries merges the buys of a mint per wallet, ordered by when each wallet first bought
+func (c *ConvergenceDetector) entries(mint string) []ConvergenceEntry {
+	byWallet := make(map[string]*ConvergenceEntry)
+	var entries []*ConvergenceEntry
+	for _, buy := range c.buys[mint] {
+		entry, ok := byWallet[buy.WalletAddress]
+		if !ok {
+			entry = &ConvergenceEntry{WalletAddress: buy.WalletAddress, Time: buy.Time}
+			byWallet[buy.WalletAddress] = entry
+			entries = append(entries, entry)
+		}
+		entry.Amount += buy.Amount
+		entry.USDValue += buy.USDValue
+		if buy.Time.Before(entry.Time) {
+			entry.Time = buy.Time
+		}
+	}
+
+	result := make([]ConvergenceEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result
+}
+
+// boughtAmount is how much of a token a change added: a new position or a balance increase.
+// A change explained by its transactions only counts when one of them bought the token, a
+// transfer or airdrop is no entry. Without transactions the balance is all there is to go by.
+func boughtAmount(change Change) (uint64, bool) {
+	if len(change.Transactions) > 0 && !boughtInTransactions(change) {
+		return 0, false
+	}
+	switch change.ChangeType {
+	case "new_token":
+		return change.NewBalance, change.NewBalance > 0
+	case "balance_change":
+		if change.NewBalance > change.OldBalance {
+			return change.NewBalance - change.OldBalance, true
+		}
+	}
+	return 0, false
+}
+
+func boughtInTransactions(change Change) bool {
+	for _, tx := range change.Transactions {
+		if tx.Swap != nil && tx.Swap.Side == SwapBuy && tx.Swap.OutputMint == change.TokenMint {
+			return true
+		}
+	}
+	return false
+}
+
+// entryTime is the block time of the first transaction behind a change, or now when the
+// change was not attributed
+func entryTime(change Change, now time.Time) time.Time {
+	for _, tx := range change.Transactions {
+		if !tx.BlockTime.IsZero() {
+			return tx.BlockTime
+		}
+	}
+	return now
+}
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvergenceDetector(t *testing.T) {
+	const mint, solMint = "DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263", "So11111111111111111111111111111111111111112"
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	detector := NewConvergenceDetector(config.ConvergenceConfig{Enabled: true, MinWallets: 3, Window: "1h"})
+
+	buy := func(wallet string, old, new uint64) Change {
+		change := Change{WalletAddress: wallet, TokenMint: mint, TokenSymbol: "BONK", TokenDecimals: 5,
+			ChangeType: "balance_change", OldBalance: old, NewBalance: new, USDPrice: 0.00002}
+		if old == 0 {
+			change.ChangeType = "new_token"
+		}
+		return change
+	}
+
+	// Two wallets are not enough, a sell does not count
+	assert.Empty(t, detector.Observe([]Change{buy("wallet1", 0, 1_000_000)}, start))
+	assert.Empty(t, detector.Observe([]Change{
+		buy("wallet2", 500, 2_000_500),
+		{WalletAddress: "wallet3", TokenMint: mint, ChangeType: "balance_change", OldBalance: 10, NewBalance: 5},
+	}, start.Add(10*time.Minute)))
+
+	// The block time of the transaction behind a change is when the wallet entered
+	late := buy("wallet3", 0, 3_000_000)
+	late.Transactions = []Transaction{{Signature: "sig", BlockTime: start.Add(20 * time.Minute),
+		Swap: &Swap{Side: SwapBuy, InputMint: solMint, OutputMint: mint}}}
+
+	// Tokens that were sent or airdropped to a wallet are no buy, nor is selling the token
+	transferred := buy("wallet5", 0, 5_000_000)
+	transferred.Transactions = []Transaction{{Signature: "transfer"}}
+	sold := buy("wallet6", 100, 200)
+	sold.Transactions = []Transaction{{Signature: "sell", Swap: &Swap{Side: SwapSell, InputMint: mint, OutputMint: solMint}}}
+
+	convergences := detector.Observe([]Change{buy("wallet1", 1_000_000, 1_500_000), late, transferred, sold}, start.Add(30*time.Minute))
+	require.Len(t, convergences, 1)
+	convergence := convergences[0]
+	assert.Equal(t, mint, convergence.TokenMint)
+	assert.Equal(t, "BONK", convergence.TokenSymbol)
+	assert.Equal(t, time.Hour, convergence.Window)
+	require.Len(t, convergence.Entries, 3)
+	assert.Equal(t, "wallet1", convergence.Entries[0].WalletAddress)
+	assert.Equal(t, uint64(1_500_000), convergence.Entries[0].Amount) // Both buys within the window
+	assert.Equal(t, "wallet2", convergence.Entries[1].WalletAddress)
+	assert.Equal(t, uint64(2_000_000), convergence.Entries[1].Amount)
+	assert.InDelta(t, 0.0004, convergence.Entries[1].USDValue, 1e-12) // 20 BONK
+	assert.Equal(t, "wallet3", convergence.Entries[2].WalletAddress)
+	assert.Equal(t, start.Add(20*time.Minute), convergence.Entries[2].Time)
+	assert.Equal(t, 20*time.Minute, convergence.Span())
+
+	// More buys by the same wallets are not reported again, another wallet is
+	assert.Empty(t, detector.Observe([]Change{buy("wallet2", 2_000_500, 2_500_500)}, start.Add(35*time.Minute)))
+	convergences = detector.Observe([]Change{buy("wallet4", 0, 100)}, start.Add(40*time.Minute))
+	require.Len(t, convergences, 1)
+	assert.Len(t, convergences[0].Entries, 4)
+
+	// Once the earlier buys leave the window only wallet4 remains, wallets buying again
+	// are new entries
+	assert.Empty(t, detector.Observe(nil, start.Add(90*time.Minute)))
+	convergences = detector.Observe([]Change{
+		buy("wallet1", 1_500_000, 1_600_000),
+		buy("wallet3", 3_000_000, 3_200_000),
+	}, start.Add(95*time.Minute))
+	require.Len(t, convergences, 1)
+	entries := convergences[0].Entries
+	require.Len(t, entries, 3)
+	assert.Equal(t, "wallet4", entries[0].WalletAddress)
+	assert.Equal(t, "wallet1", entries[1].WalletAddress)
+	assert.Equal(t, uint64(100_000), entries[1].Amount) // Only the buy within the window
+	assert.Equal(t, "wallet3", entries[2].WalletAddress)
+}
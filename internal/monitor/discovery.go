@@ -0,0 +1,481 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	discoveryPageSize = 100   // Signatures per getSignaturesForAddress page
+	maxDiscoveryPages = 10    // Pages inspected per wallet and pass, older ones are skipped
+	maxFundingEdges   = 10000 // Oldest edges are dropped beyond this
+
+	systemTransferInstruction = 2  // System program Transfer
+	tokenTransferInstruction  = 3  // SPL Token Transfer
+	tokenTransferChecked      = 12 // SPL Token TransferChecked
+)
+
+// FundingEdge is an outgoing SOL or token transfer from a monitored wallet
+type FundingEdge struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"` // Recipient wallet, the owner of the receiving token account for tokens
+	Signature string    `json:"signature"`
+	Slot      uint64    `json:"slot"`
+	BlockTime time.Time `json:"block_time"` // Zero when the node returned none
+	Mint      string    `json:"mint"`       // Wrapped SOL mint for native SOL
+	Amount    uint64    `json:"amount"`
+	Decimals  uint8     `json:"decimals"`
+	Symbol    string    `json:"symbol,omitempty"`
+	USDValue  float64   `json:"usd_value,omitempty"`
+}
+
+// LinkedWallet is a wallet discovered through a transfer from a monitored wallet
+type LinkedWallet struct {
+	Address      string      `json:"address"`
+	Parent       string      `json:"parent"` // Wallet that funded it
+	Root         string      `json:"root"`   // Configured wallet at the top of the funding chain
+	Depth        int         `json:"depth"`  // Funding hops from Root
+	FundedBy     FundingEdge `json:"funded_by"`
+	Transactions int         `json:"transactions"` // Transactions of the wallet when it was linked
+	Fresh        bool        `json:"fresh"`
+	Monitored    bool        `json:"monitored"` // Added to monitoring in auto mode
+	DiscoveredAt time.Time   `json:"discovered_at"`
+}
+
+// FundingGraph is what discovery has learned so far, persisted between runs
+type FundingGraph struct {
+	Linked  map[string]*LinkedWallet `json:"linked"`  // Address -> link
+	Edges   []FundingEdge            `json:"edges"`   // Qualifying transfers, oldest first
+	Cursors map[string]string        `json:"cursors"` // Wallet -> newest signature inspected
+}
+
+func NewFundingGraph() *FundingGraph {
+	return &FundingGraph{
+		Linked:  make(map[string]*LinkedWallet),
+		Cursors: make(map[string]string),
+	}
+}
+
+// Discovery follows the outgoing transfers of monitored wallets to the wallets they fund.
+// Recipients that pass the configured rules are linked to the wallet that funded them and,
+// in auto mode, monitored themselves, so their own transfers are followed one hop further.
+type Discovery struct {
+	monitor *WalletMonitor
+	cfg     config.DiscoveryConfig
+	graph   *FundingGraph
+	ignore  map[string]bool
+}
+
+// NewDiscovery resumes discovery from graph. In auto mode the wallets it linked before
+// are monitored again right away.
+func NewDiscovery(w *WalletMonitor, cfg config.DiscoveryConfig, graph *FundingGraph) *Discovery {
+	if graph == nil {
+		graph = NewFundingGraph()
+	}
+	if graph.Linked == nil {
+		graph.Linked = make(map[string]*LinkedWallet)
+	}
+	if graph.Cursors == nil {
+		graph.Cursors = make(map[string]string)
+	}
+
+	d := &Discovery{monitor: w, cfg: cfg, graph: graph, ignore: make(map[string]bool)}
+	for _, addr := range cfg.IgnoreAddresses {
+		d.ignore[addr] = true
+	}
+
+	for _, linked := range graph.Linked {
+		if !linked.Monitored {
+			continue
+		}
+		if !cfg.AutoAdd() {
+			linked.Monitored = false
+			continue
+		}
+		if err := w.AddWallet(linked.Address); err != nil {
+			log.Printf("⚠️ Could not monitor linked wallet %s: %v", linked.Address, err)
+		}
+	}
+	return d
+}
+
+// Graph returns the funding graph for persisting
+func (d *Discovery) Graph() *FundingGraph {
+	return d.graph
+}
+
+// Annotate marks the changes of linked wallets with how they were linked. A nil Discovery
+// annotates nothing.
+func (d *Discovery) Annotate(changes []Change) {
+	if d == nil {
+		return
+	}
+	for i := range changes {
+		if linked, ok := d.graph.Linked[changes[i].WalletAddress]; ok {
+			link := *linked
+			changes[i].LinkedFrom = &link
+		}
+	}
+}
+
+// Run inspects the transactions of every monitored wallet since the previous pass and
+// returns the wallets linked by it. A wallet's first pass inspects its most recent page.
+func (d *Discovery) Run(ctx context.Context) ([]LinkedWallet, error) {
+	var discovered []LinkedWallet
+	for _, wallet := range d.monitor.walletList() {
+		addr := wallet.String()
+		// Wallets at the depth limit can't link anything, don't spend requests on them
+		if d.depth(addr) >= d.cfg.MaxHops() {
+			continue
+		}
+
+		linked, err := d.inspect(ctx, wallet)
+		discovered = append(discovered, linked...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return discovered, ctx.Err()
+			}
+			log.Printf("⚠️ Discovery could not inspect wallet %s: %v", addr, err)
+		}
+	}
+	return discovered, nil
+}
+
+// inspect follows the transfers of one wallet since its cursor, oldest first
+func (d *Discovery) inspect(ctx context.Context, wallet solana.PublicKey) ([]LinkedWallet, error) {
+	addr := wallet.String()
+	page, err := d.signatures(ctx, wallet)
+	if err != nil {
+		return nil, err
+	}
+	if len(page) == 0 {
+		return nil, nil
+	}
+
+	var discovered []LinkedWallet
+	for i := len(page) - 1; i >= 0; i-- {
+		sig := page[i]
+		if sig.Err != nil {
+			continue
+		}
+		result, err := d.monitor.getTransactionWithRetry(ctx, sig.Signature)
+		if err != nil {
+			if ctx.Err() != nil {
+				return discovered, ctx.Err()
+			}
+			log.Printf("⚠️ Discovery skipped transaction %s: %v", sig.Signature, err)
+			continue
+		}
+		tx, err := result.Transaction.GetTransaction()
+		if err != nil {
+			continue
+		}
+
+		for _, edge := range fundingTransfers(tx, result.Meta, addr) {
+			edge.Signature, edge.Slot = sig.Signature.String(), sig.Slot
+			edge.BlockTime = blockTime(sig)
+			if !d.qualifies(&edge) {
+				continue
+			}
+			edge.Symbol = d.symbol(edge.Mint)
+			d.addEdge(edge)
+
+			if linked, ok := d.link(ctx, edge); ok {
+				discovered = append(discovered, *linked)
+			}
+		}
+	}
+
+	// Transactions that could not be fetched are not retried, the cursor only moves forward
+	d.graph.Cursors[addr] = page[0].Signature.String()
+	return discovered, nil
+}
+
+// signatures lists the wallet's signatures since its cursor, newest first. They are paged
+// back with Before until a short page reaches the cursor, a wallet without one gets its most
+// recent page.
+func (d *Discovery) signatures(ctx context.Context, wallet solana.PublicKey) ([]*rpc.TransactionSignature, error) {
+	var until solana.Signature
+	cursor := d.graph.Cursors[wallet.String()]
+	if cursor != "" {
+		if sig, err := solana.SignatureFromBase58(cursor); err == nil {
+			until = sig
+		}
+	}
+
+	var signatures []*rpc.TransactionSignature
+	var before solana.Signature
+	for page := 0; page < maxDiscoveryPages; page++ {
+		limit := discoveryPageSize
+		callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+		sigs, err := d.monitor.client.GetSignaturesForAddressWithOpts(callCtx, wallet, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &limit,
+			Before:     before,
+			Until:      until,
+			Commitment: d.monitor.historyCommitment(),
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("getSignaturesForAddress: %w", err)
+		}
+		signatures = append(signatures, sigs...)
+		if len(sigs) < discoveryPageSize || until.IsZero() {
+			return signatures, nil
+		}
+		before = sigs[len(sigs)-1].Signature
+	}
+	log.Printf("⚠️ Wallet %s made more than %d transactions since the last discovery pass, the older ones are skipped",
+		wallet, maxDiscoveryPages*discoveryPageSize)
+	return signatures, nil
+}
+
+// qualifies applies the minimum amount rules and values token transfers from cached prices
+func (d *Discovery) qualifies(edge *FundingEdge) bool {
+	if edge.Mint == solana.SolMint.String() {
+		if priceData, ok := d.monitor.priceService.GetPrice(edge.Mint); ok {
+			edge.USDValue = uiAmount(edge.Amount, edge.Decimals) * priceData.Price
+		}
+		return uiAmount(edge.Amount, edge.Decimals) >= d.cfg.MinSOL()
+	}
+
+	priceData, ok := d.monitor.priceService.GetPrice(edge.Mint)
+	if !ok {
+		return d.cfg.MinimumTokenUSD == 0
+	}
+	edge.USDValue = uiAmount(edge.Amount, edge.Decimals) * priceData.Price
+	return edge.USDValue >= d.cfg.MinimumTokenUSD
+}
+
+// addEdge records a transfer once, a pass cut short by shutdown inspects its page again
+func (d *Discovery) addEdge(edge FundingEdge) {
+	for _, existing := range d.graph.Edges {
+		if existing.Signature == edge.Signature && existing.To == edge.To && existing.Mint == edge.Mint {
+			return
+		}
+	}
+	d.graph.Edges = append(d.graph.Edges, edge)
+	if len(d.graph.Edges) > maxFundingEdges {
+		d.graph.Edges = d.graph.Edges[len(d.graph.Edges)-maxFundingEdges:]
+	}
+}
+
+// link links the recipient of a qualifying transfer when the remaining rules allow it
+func (d *Discovery) link(ctx context.Context, edge FundingEdge) (*LinkedWallet, bool) {
+	recipient := edge.To
+	if d.ignore[recipient] || d.graph.Linked[recipient] != nil || d.isMonitored(recipient) {
+		return nil, false
+	}
+	if len(d.graph.Linked) >= d.cfg.WalletLimit() {
+		log.Printf("⚠️ Not linking wallet %s, the limit of %d linked wallets is reached", recipient, d.cfg.WalletLimit())
+		return nil, false
+	}
+
+	// Insiders rotate into wallets with no past, an established recipient is more likely
+	// an exchange, a contract or a friend
+	count, err := d.transactionCount(ctx, recipient)
+	if err != nil {
+		log.Printf("⚠️ Could not check whether wallet %s is fresh: %v", recipient, err)
+		return nil, false
+	}
+	fresh := count <= d.cfg.FreshTransactions()
+	if !fresh && !d.cfg.IncludeEstablished {
+		return nil, false
+	}
+
+	linked := &LinkedWallet{
+		Address:      recipient,
+		Parent:       edge.From,
+		Root:         d.root(edge.From),
+		Depth:        d.depth(edge.From) + 1,
+		FundedBy:     edge,
+		Transactions: count,
+		Fresh:        fresh,
+		DiscoveredAt: time.Now(),
+	}
+	if d.cfg.AutoAdd() {
+		if err := d.monitor.AddWallet(recipient); err != nil {
+			log.Printf("⚠️ Could not monitor linked wallet %s: %v", recipient, err)
+		} else {
+			linked.Monitored = true
+		}
+	}
+	d.graph.Linked[recipient] = linked
+	log.Printf("🔗 Linked wallet %s, funded by %s (%d hops from %s)", recipient, edge.From, linked.Depth, linked.Root)
+	return linked, true
+}
+
+// transactionCount counts a wallet's transactions, up to one more than a fresh wallet may have
+func (d *Discovery) transactionCount(ctx context.Context, addr string) (int, error) {
+	wallet, err := solana.PublicKeyFromBase58(addr)
+	if err != nil {
+		return 0, err
+	}
+	limit := d.cfg.FreshTransactions() + 1
+	callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+	defer cancel()
+	page, err := d.monitor.client.GetSignaturesForAddressWithOpts(callCtx, wallet, &rpc.GetSignaturesForAddressOpts{
+		Limit:      &limit,
+		Commitment: d.monitor.historyCommitment(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(page), nil
+}
+
+func (d *Discovery) symbol(mint string) string {
+	if mint == solana.SolMint.String() {
+		return nativeSOLSymbol
+	}
+	if meta, ok := d.monitor.metadata.Get(mint); ok {
+		return meta.DisplaySymbol()
+	}
+	return shortMint(mint)
+}
+
+func (d *Discovery) isMonitored(addr string) bool {
+	for _, wallet := range d.monitor.walletList() {
+		if wallet.String() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// depth is how many funding hops a wallet is from a configured wallet
+func (d *Discovery) depth(addr string) int {
+	if linked, ok := d.graph.Linked[addr]; ok {
+		return linked.Depth
+	}
+	return 0
+}
+
+// root is the configured wallet at the top of a wallet's funding chain
+func (d *Discovery) root(addr string) string {
+	if linked, ok := d.graph.Linked[addr]; ok {
+		return linked.Root
+	}
+	return addr
+}
+
+// fundingTransfers lists the SOL and token transfers the wallet signed off in a transaction,
+// one edge per recipient and mint. Trades are not funding: transactions that invoke a DEX
+// are skipped, as are transfers between the wallet's own accounts. SOL sent to a token
+// account, wrapping it, goes to the account's owner, so a wallet wrapping its own SOL is
+// not funding anyone.
+func fundingTransfers(tx *solana.Transaction, meta *rpc.TransactionMeta, wallet string) []FundingEdge {
+	if tx == nil || meta == nil || meta.Err != nil {
+		return nil
+	}
+	keys := transactionAccountKeys(tx, meta)
+	if swapProgram(tx, meta, keys) != "" {
+		return nil
+	}
+
+	// Receiving token accounts are resolved to the wallets that own them. Accounts closed
+	// by the transaction only show up before it.
+	owners := make(map[uint16]rpc.TokenBalance)
+	for _, balances := range [][]rpc.TokenBalance{meta.PreTokenBalances, meta.PostTokenBalances} {
+		for _, balance := range balances {
+			owners[balance.AccountIndex] = balance
+		}
+	}
+
+	key := func(inst solana.CompiledInstruction, i int) (solana.PublicKey, uint16, bool) {
+		if i >= len(inst.Accounts) || int(inst.Accounts[i]) >= len(keys) {
+			return solana.PublicKey{}, 0, false
+		}
+		return keys[inst.Accounts[i]], inst.Accounts[i], true
+	}
+
+	byRecipient := make(map[string]*FundingEdge)
+	var order []string
+	add := func(to, mint string, amount uint64, decimals uint8) {
+		if to == "" || to == wallet || amount == 0 {
+			return
+		}
+		id := to + ":" + mint
+		edge, ok := byRecipient[id]
+		if !ok {
+			edge = &FundingEdge{From: wallet, To: to, Mint: mint, Decimals: decimals}
+			byRecipient[id] = edge
+			order = append(order, id)
+		}
+		edge.Amount += amount
+	}
+
+	inspect := func(inst solana.CompiledInstruction) {
+		if int(inst.ProgramIDIndex) >= len(keys) {
+			return
+		}
+		program := keys[inst.ProgramIDIndex]
+		data := []byte(inst.Data)
+
+		switch {
+		case program.Equals(solana.SystemProgramID):
+			if len(data) < 12 || binary.LittleEndian.Uint32(data) != systemTransferInstruction {
+				return
+			}
+			from, _, ok := key(inst, 0)
+			to, index, ok2 := key(inst, 1)
+			if !ok || !ok2 || from.String() != wallet {
+				return
+			}
+			recipient := to.String()
+			if balance, ok := owners[index]; ok {
+				if balance.Owner == nil {
+					return
+				}
+				recipient = balance.Owner.String()
+			}
+			add(recipient, solana.SolMint.String(), binary.LittleEndian.Uint64(data[4:]), nativeSOLDecimals)
+
+		case program.Equals(solana.TokenProgramID) || program.Equals(solana.Token2022ProgramID):
+			var destination, authority int
+			switch {
+			case len(data) >= 9 && data[0] == tokenTransferInstruction:
+				destination, authority = 1, 2
+			case len(data) >= 10 && data[0] == tokenTransferChecked:
+				destination, authority = 2, 3
+			default:
+				return
+			}
+			signer, _, ok := key(inst, authority)
+			_, index, ok2 := key(inst, destination)
+			if !ok || !ok2 || signer.String() != wallet {
+				return
+			}
+			balance, ok := owners[index]
+			if !ok || balance.Owner == nil {
+				return
+			}
+			var decimals uint8
+			if balance.UiTokenAmount != nil {
+				decimals = balance.UiTokenAmount.Decimals
+			}
+			add(balance.Owner.String(), balance.Mint.String(), binary.LittleEndian.Uint64(data[1:]), decimals)
+		}
+	}
+
+	for _, inst := range tx.Message.Instructions {
+		inspect(inst)
+	}
+	for _, inner := range meta.InnerInstructions {
+		for _, inst := range inner.Instructions {
+			inspect(inst)
+		}
+	}
+
+	edges := make([]FundingEdge, 0, len(order))
+	for _, id := range order {
+		edges = append(edges, *byRecipient[id])
+	}
+	return edges
+}
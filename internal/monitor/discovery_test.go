@@ -0,0 +1,222 @@
+package monitor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fundingFixture is a transaction served by the fake RPC, with its token balances
+type fundingFixture struct {
+	tx       *solana.Transaction
+	balances []interface{}
+}
+
+func TestDiscoveryLinksFreshRecipients(t *testing.T) {
+	wallet := solana.MustPublicKeyFromBase58(testWallet)
+	fresh, dust, established, tokenRecipient := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(),
+		solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	source, destination, mint := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+
+	build := func(instructions ...solana.Instruction) *solana.Transaction {
+		tx, err := solana.NewTransaction(instructions, solana.Hash{}, solana.TransactionPayer(wallet))
+		require.NoError(t, err)
+		tx.Signatures = []solana.Signature{{}}
+		return tx
+	}
+	index := func(tx *solana.Transaction, key solana.PublicKey) int {
+		for i, k := range tx.Message.AccountKeys {
+			if k.Equals(key) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// Oldest first: 2 SOL to a fresh wallet, dust, then 3 SOL to an established wallet
+	// together with tokens sent to another fresh wallet's token account
+	tokenTx := build(
+		system.NewTransferInstruction(3_000_000_000, wallet, established).Build(),
+		token.NewTransferCheckedInstruction(500_000_000, 6, source, mint, destination, wallet, nil).Build(),
+	)
+	transactions := map[solana.Signature]fundingFixture{
+		{1}: {tx: build(system.NewTransferInstruction(2_000_000_000, wallet, fresh).Build())},
+		{2}: {tx: build(system.NewTransferInstruction(10_000_000, wallet, dust).Build())},
+		{3}: {tx: tokenTx, balances: []interface{}{map[string]interface{}{
+			"accountIndex":  index(tokenTx, destination),
+			"mint":          mint.String(),
+			"owner":         tokenRecipient.String(),
+			"uiTokenAmount": map[string]interface{}{"amount": "500000000", "decimals": 6},
+		}}},
+	}
+	signatures := map[string][]solana.Signature{
+		wallet.String(): {{3}, {2}, {1}}, // Newest first
+		fresh.String():  {{1}},
+	}
+	for i := 0; i < 30; i++ {
+		signatures[established.String()] = append(signatures[established.String()], solana.Signature{9, byte(i)})
+	}
+	fetched := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     interface{}     `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		var params []interface{}
+		_ = json.Unmarshal(req.Params, &params)
+
+		var result interface{}
+		switch req.Method {
+		case "getSignaturesForAddress":
+			opts, _ := params[len(params)-1].(map[string]interface{})
+			until, _ := opts["until"].(string)
+			before, _ := opts["before"].(string)
+			limit, _ := opts["limit"].(float64)
+
+			page := []map[string]interface{}{}
+			listed := signatures[params[0].(string)]
+			for i, sig := range listed {
+				if sig.String() == before {
+					listed, page = listed[i+1:], page[:0]
+					break
+				}
+			}
+			for _, sig := range listed {
+				if sig.String() == until || len(page) == int(limit) {
+					break
+				}
+				page = append(page, map[string]interface{}{"signature": sig.String(), "slot": 100 + int(sig[0])})
+			}
+			result = page
+		case "getTransaction":
+			fetched++
+			sig := solana.MustSignatureFromBase58(params[0].(string))
+			fixture := transactions[sig]
+			raw, err := fixture.tx.MarshalBinary()
+			require.NoError(t, err)
+			balances := fixture.balances
+			if balances == nil {
+				balances = []interface{}{}
+			}
+			result = map[string]interface{}{
+				"slot":        100 + int(sig[0]),
+				"transaction": []string{base64.StdEncoding.EncodeToString(raw), "base64"},
+				"meta":        map[string]interface{}{"err": nil, "preTokenBalances": []interface{}{}, "postTokenBalances": balances},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	defer server.Close()
+
+	w, err := NewWalletMonitor(server.URL, []string{testWallet}, &config.ScanConfig{RequestsPerSecond: 1000})
+	require.NoError(t, err)
+	discovery := NewDiscovery(w, config.DiscoveryConfig{Enabled: true, Mode: "auto", MaxDepth: 2}, nil)
+
+	linked, err := discovery.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, linked, 2)
+
+	assert.Equal(t, fresh.String(), linked[0].Address)
+	assert.Equal(t, testWallet, linked[0].Parent)
+	assert.Equal(t, testWallet, linked[0].Root)
+	assert.Equal(t, 1, linked[0].Depth)
+	assert.Equal(t, uint64(2_000_000_000), linked[0].FundedBy.Amount)
+	assert.Equal(t, "SOL", linked[0].FundedBy.Symbol)
+	assert.True(t, linked[0].Fresh)
+	assert.True(t, linked[0].Monitored)
+
+	assert.Equal(t, tokenRecipient.String(), linked[1].Address)
+	assert.Equal(t, mint.String(), linked[1].FundedBy.Mint)
+	assert.Equal(t, uint64(500_000_000), linked[1].FundedBy.Amount)
+
+	// The dust transfer is not an edge, the established recipient is one but is not linked
+	assert.Len(t, discovery.Graph().Edges, 3)
+	assert.Len(t, w.walletList(), 3)
+
+	// Nothing new since the cursor, the linked wallets have no outgoing transfers
+	linked, err = discovery.Run(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, linked)
+	assert.Len(t, discovery.Graph().Edges, 3)
+
+	// More transactions than fit a page since the cursor are all inspected
+	var burst []solana.Signature
+	for i := 0; i < discoveryPageSize+50; i++ {
+		sig := solana.Signature{10, byte(i >> 8), byte(i)}
+		transactions[sig] = fundingFixture{tx: build(system.NewTransferInstruction(10_000_000, wallet, dust).Build())}
+		burst = append([]solana.Signature{sig}, burst...)
+	}
+	signatures[wallet.String()] = append(burst, signatures[wallet.String()]...)
+	fetched = 0
+	_, err = discovery.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, discoveryPageSize+50, fetched)
+	assert.Equal(t, burst[0].String(), discovery.Graph().Cursors[testWallet])
+
+	changes := []Change{{WalletAddress: fresh.String(), ChangeType: "new_wallet"}, {WalletAddress: testWallet, ChangeType: "new_wallet"}}
+	discovery.Annotate(changes)
+	require.NotNil(t, changes[0].LinkedFrom)
+	assert.Equal(t, testWallet, changes[0].LinkedFrom.Parent)
+	assert.Nil(t, changes[1].LinkedFrom)
+
+	// Restarting in propose mode does not monitor the linked wallets
+	proposeOnly, err := NewWalletMonitor(server.URL, []string{testWallet}, nil)
+	require.NoError(t, err)
+	NewDiscovery(proposeOnly, config.DiscoveryConfig{Enabled: true}, discovery.Graph())
+	assert.Len(t, proposeOnly.walletList(), 1)
+}
+
+func TestFundingTransfersSkipsTrades(t *testing.T) {
+	tx, meta, wallet := loadTransactionFixture(t, "pumpfun_buy")
+	assert.Empty(t, fundingTransfers(tx, meta, wallet))
+}
+
+func TestFundingTransfersSkipsWrappingOwnSOL(t *testing.T) {
+	wallet := solana.MustPublicKeyFromBase58(testWallet)
+	ownWSOL, otherWSOL, other := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+
+	// A manual wrap: SOL into the wallet's own wSOL account, then SyncNative. The same
+	// transaction also tops up someone else's wSOL account.
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		system.NewTransferInstruction(1_000_000_000, wallet, ownWSOL).Build(),
+		solana.NewInstruction(solana.TokenProgramID, solana.AccountMetaSlice{solana.Meta(ownWSOL).WRITE()}, []byte{17}),
+		system.NewTransferInstruction(2_000_000_000, wallet, otherWSOL).Build(),
+	}, solana.Hash{}, solana.TransactionPayer(wallet))
+	require.NoError(t, err)
+	index := func(key solana.PublicKey) uint16 {
+		for i, k := range tx.Message.AccountKeys {
+			if k.Equals(key) {
+				return uint16(i)
+			}
+		}
+		t.Fatalf("%s is not in the transaction", key)
+		return 0
+	}
+	balance := func(account, owner solana.PublicKey) rpc.TokenBalance {
+		return rpc.TokenBalance{AccountIndex: index(account), Owner: &owner, Mint: solana.SolMint,
+			UiTokenAmount: &rpc.UiTokenAmount{Decimals: 9}}
+	}
+	meta := &rpc.TransactionMeta{
+		PreTokenBalances:  []rpc.TokenBalance{balance(ownWSOL, wallet)},
+		PostTokenBalances: []rpc.TokenBalance{balance(ownWSOL, wallet), balance(otherWSOL, other)},
+	}
+
+	edges := fundingTransfers(tx, meta, testWallet)
+	require.Len(t, edges, 1, "wrapping the wallet's own SOL is no funding edge")
+	assert.Equal(t, other.String(), edges[0].To, "wrapped SOL is credited to the account's owner")
+	assert.Equal(t, uint64(2_000_000_000), edges[0].Amount)
+}
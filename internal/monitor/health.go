@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// WalletFailure describes a wallet that could not be scanned
+type WalletFailure struct {
+	WalletAddress       string    `json:"wallet_address"`
+	Error               string    `json:"error"`                // First line of the error, without the troubleshooting hints
+	ConsecutiveFailures int       `json:"consecutive_failures"` // Scans in a row this wallet has failed
+	FailingSince        time.Time `json:"failing_since"`
+
+	Err error `json:"-"`
+}
+
+// ScanReport describes how a scan went for every wallet, not just the ones that succeeded
+type ScanReport struct {
+	Scanned   int             `json:"scanned"`
+	Failures  []WalletFailure `json:"failures,omitempty"`
+	Recovered []WalletFailure `json:"recovered,omitempty"` // Wallets that succeeded again, with their last failure
+	Duration  time.Duration   `json:"duration"`
+}
+
+// FailedWallet reports whether the wallet failed in this scan
+func (r *ScanReport) FailedWallet(walletAddr string) bool {
+	if r == nil {
+		return false
+	}
+	for _, failure := range r.Failures {
+		if failure.WalletAddress == walletAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// walletHealth remembers consecutive scan failures per wallet across scans
+type walletHealth struct {
+	mu       sync.Mutex
+	failures map[string]*WalletFailure
+}
+
+func newWalletHealth() *walletHealth {
+	return &walletHealth{failures: make(map[string]*WalletFailure)}
+}
+
+func (h *walletHealth) recordFailure(walletAddr string, err error) WalletFailure {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failure, ok := h.failures[walletAddr]
+	if !ok {
+		failure = &WalletFailure{WalletAddress: walletAddr, FailingSince: time.Now()}
+		h.failures[walletAddr] = failure
+	}
+	failure.ConsecutiveFailures++
+	failure.Err = err
+	failure.Error = firstLine(err.Error())
+	return *failure
+}
+
+// recordSuccess clears the wallet's failures and returns them if it had any
+func (h *walletHealth) recordSuccess(walletAddr string) (WalletFailure, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failure, ok := h.failures[walletAddr]
+	if !ok {
+		return WalletFailure{}, false
+	}
+	delete(h.failures, walletAddr)
+	return *failure, true
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
@@ -0,0 +1,332 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	metadataCacheFile = "token_metadata.json"
+	metadataCacheTTL  = 24 * time.Hour // Supply, authorities and extensions can change
+	mintBaseSize      = 82             // Size of an SPL mint without extensions
+)
+
+// TokenMetadata describes a mint as read from its on-chain accounts
+type TokenMetadata struct {
+	Mint            string           `json:"mint"`
+	Name            string           `json:"name,omitempty"`
+	Symbol          string           `json:"symbol,omitempty"`
+	URI             string           `json:"uri,omitempty"`
+	Decimals        uint8            `json:"decimals"`
+	Supply          uint64           `json:"supply"`
+	MintAuthority   string           `json:"mint_authority,omitempty"`
+	FreezeAuthority string           `json:"freeze_authority,omitempty"`
+	ProgramID       string           `json:"program_id"`
+	Extensions      *TokenExtensions `json:"extensions,omitempty"` // Token-2022 mint extensions
+	FetchedAt       time.Time        `json:"fetched_at"`
+}
+
+// DisplaySymbol returns the token symbol, or a shortened mint for tokens without metadata
+func (m *TokenMetadata) DisplaySymbol() string {
+	if m.Symbol != "" {
+		return m.Symbol
+	}
+	return shortMint(m.Mint)
+}
+
+func shortMint(mint string) string {
+	if len(mint) <= 8 {
+		return mint
+	}
+	return mint[:8] + "..."
+}
+
+// MetadataResolver reads decimals, supply and authorities from mint accounts and the
+// name, symbol and URI from either the Token-2022 metadata extension or the Metaplex
+// Token Metadata PDA. Results are cached and optionally persisted to the data directory.
+type MetadataResolver struct {
+	client    *rpc.Client
+	cachePath string
+
+	mu    sync.RWMutex
+	cache map[string]*TokenMetadata
+
+	saveMu sync.Mutex // One writer of the cache file at a time
+}
+
+func NewMetadataResolver(client *rpc.Client) *MetadataResolver {
+	return &MetadataResolver{
+		client: client,
+		cache:  make(map[string]*TokenMetadata),
+	}
+}
+
+// LoadCache reads the persisted cache from dataDir and keeps it up to date from then on
+func (r *MetadataResolver) LoadCache(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	path := filepath.Join(dataDir, metadataCacheFile)
+	r.mu.Lock()
+	r.cachePath = path
+	r.mu.Unlock()
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read token metadata cache: %w", err)
+	}
+
+	cache := make(map[string]*TokenMetadata)
+	if err := json.Unmarshal(file, &cache); err != nil {
+		return fmt.Errorf("failed to parse token metadata cache: %w", err)
+	}
+
+	r.mu.Lock()
+	for mint, meta := range cache {
+		r.cache[mint] = meta
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Get returns cached metadata without touching the network
+func (r *MetadataResolver) Get(mint string) (*TokenMetadata, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	meta, ok := r.cache[mint]
+	return meta, ok
+}
+
+// Resolve returns metadata for the given mints, fetching those that are missing or stale.
+// Lookup failures are logged and fall back to whatever is cached.
+func (r *MetadataResolver) Resolve(ctx context.Context, mints []solana.PublicKey) map[string]*TokenMetadata {
+	result := make(map[string]*TokenMetadata, len(mints))
+	var missing []solana.PublicKey
+	seen := make(map[solana.PublicKey]bool, len(mints))
+
+	r.mu.RLock()
+	for _, mint := range mints {
+		if seen[mint] {
+			continue
+		}
+		seen[mint] = true
+
+		meta, ok := r.cache[mint.String()]
+		if ok {
+			result[mint.String()] = meta
+		}
+		if !ok || time.Since(meta.FetchedAt) > metadataCacheTTL {
+			missing = append(missing, mint)
+		}
+	}
+	r.mu.RUnlock()
+
+	if len(missing) == 0 {
+		return result
+	}
+
+	fetched := r.fetch(ctx, missing)
+	if len(fetched) == 0 {
+		return result
+	}
+
+	r.mu.Lock()
+	for mint, meta := range fetched {
+		r.cache[mint] = meta
+		result[mint] = meta
+	}
+	r.mu.Unlock()
+
+	if err := r.save(); err != nil {
+		log.Printf("⚠️  Warning: failed to save token metadata cache: %v", err)
+	}
+	return result
+}
+
+func (r *MetadataResolver) fetch(ctx context.Context, mints []solana.PublicKey) map[string]*TokenMetadata {
+	fetched := make(map[string]*TokenMetadata, len(mints))
+	now := time.Now()
+
+	// Mint accounts first: decimals, supply, authorities and Token-2022 extensions
+	var needMetaplex []solana.PublicKey
+	r.forEachAccount(ctx, mints, func(mint solana.PublicKey, acc *rpc.Account) {
+		if acc == nil || acc.Data == nil {
+			return
+		}
+		data := acc.Data.GetBinary()
+		if len(data) < mintBaseSize {
+			return
+		}
+
+		var mintAccount token.Mint
+		if err := bin.NewBinDecoder(data[:mintBaseSize]).Decode(&mintAccount); err != nil {
+			log.Printf("⚠️  Warning: failed to decode mint %s: %v", mint.String(), err)
+			return
+		}
+
+		meta := &TokenMetadata{
+			Mint:      mint.String(),
+			Decimals:  mintAccount.Decimals,
+			Supply:    mintAccount.Supply,
+			ProgramID: acc.Owner.String(),
+			FetchedAt: now,
+		}
+		if mintAccount.MintAuthority != nil {
+			meta.MintAuthority = mintAccount.MintAuthority.String()
+		}
+		if mintAccount.FreezeAuthority != nil {
+			meta.FreezeAuthority = mintAccount.FreezeAuthority.String()
+		}
+
+		if acc.Owner.Equals(solana.Token2022ProgramID) {
+			meta.Extensions = decodeMintExtensions(data)
+			for _, ext := range parseExtensions(data, token2022AccountTypeMint) {
+				if ext.kind == extTokenMetadata {
+					meta.Name, meta.Symbol, meta.URI = decodeTokenMetadataExtension(ext.data)
+				}
+			}
+		}
+
+		fetched[mint.String()] = meta
+		if meta.Symbol == "" {
+			needMetaplex = append(needMetaplex, mint)
+		}
+	})
+
+	// Then the Metaplex metadata PDAs for everything that did not carry its own metadata
+	pdas := make([]solana.PublicKey, 0, len(needMetaplex))
+	pdaToMint := make(map[solana.PublicKey]solana.PublicKey, len(needMetaplex))
+	for _, mint := range needMetaplex {
+		pda, _, err := solana.FindTokenMetadataAddress(mint)
+		if err != nil {
+			continue
+		}
+		pdas = append(pdas, pda)
+		pdaToMint[pda] = mint
+	}
+
+	r.forEachAccount(ctx, pdas, func(pda solana.PublicKey, acc *rpc.Account) {
+		if acc == nil || acc.Data == nil {
+			return
+		}
+		meta := fetched[pdaToMint[pda].String()]
+		if name, symbol, uri, ok := decodeMetaplexMetadata(acc.Data.GetBinary()); ok {
+			meta.Name, meta.Symbol, meta.URI = name, symbol, uri
+		}
+	})
+
+	return fetched
+}
+
+// forEachAccount loads accounts in getMultipleAccounts sized batches
+func (r *MetadataResolver) forEachAccount(ctx context.Context, keys []solana.PublicKey, fn func(solana.PublicKey, *rpc.Account)) {
+	for i := 0; i < len(keys) && ctx.Err() == nil; i += maxAccountsPerRequest {
+		end := i + maxAccountsPerRequest
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+		accounts, err := r.client.GetMultipleAccountsWithOpts(callCtx, keys[i:end], &rpc.GetMultipleAccountsOpts{
+			Encoding: solana.EncodingBase64,
+		})
+		cancel()
+		if err != nil {
+			log.Printf("⚠️  Warning: failed to load token metadata: %v", err)
+			continue
+		}
+
+		for j, acc := range accounts.Value {
+			if i+j >= end {
+				break
+			}
+			fn(keys[i+j], acc)
+		}
+	}
+}
+
+// save replaces the cache file through a rename, so a crash leaves either the old or the
+// new cache. Scan workers resolve concurrently, their saves take turns.
+func (r *MetadataResolver) save() error {
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	r.mu.RLock()
+	path := r.cachePath
+	if path == "" {
+		r.mu.RUnlock()
+		return nil
+	}
+	file, err := json.MarshalIndent(r.cache, "", "  ")
+	r.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal token metadata: %w", err)
+	}
+	if err := os.WriteFile(path+".tmp", file, 0644); err != nil {
+		return fmt.Errorf("failed to write token metadata: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// decodeMetaplexMetadata reads name, symbol and URI from a Metaplex metadata account:
+// key (1), update authority (32), mint (32), then three borsh strings
+func decodeMetaplexMetadata(data []byte) (name, symbol, uri string, ok bool) {
+	offset := 1 + 32 + 32
+	var fields [3]string
+	for i := range fields {
+		value, next, ok := readBorshString(data, offset)
+		if !ok {
+			return "", "", "", false
+		}
+		fields[i] = value
+		offset = next
+	}
+	return fields[0], fields[1], fields[2], true
+}
+
+// decodeTokenMetadataExtension reads the Token-2022 TokenMetadata extension:
+// update authority (32), mint (32), name, symbol, uri, additional metadata
+func decodeTokenMetadataExtension(data []byte) (name, symbol, uri string) {
+	offset := 32 + 32
+	var fields [3]string
+	for i := range fields {
+		value, next, ok := readBorshString(data, offset)
+		if !ok {
+			break
+		}
+		fields[i] = value
+		offset = next
+	}
+	return fields[0], fields[1], fields[2]
+}
+
+// readBorshString reads a u32 length prefixed string. Metaplex pads strings with NUL bytes.
+func readBorshString(data []byte, offset int) (string, int, bool) {
+	if offset+4 > len(data) {
+		return "", offset, false
+	}
+	length := int(binary.LittleEndian.Uint32(data[offset:]))
+	offset += 4
+	if length < 0 || offset+length > len(data) {
+		return "", offset, false
+	}
+	value := strings.TrimSpace(strings.TrimRight(string(data[offset:offset+length]), "\x00"))
+	return value, offset + length, true
+}
@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeMetaplexMetadata(t *testing.T) {
+	borsh := func(value string, size int) []byte {
+		out := binary.LittleEndian.AppendUint32(nil, uint32(size))
+		padded := make([]byte, size)
+		copy(padded, value)
+		return append(out, padded...)
+	}
+
+	// key, update authority, mint, then NUL padded name, symbol and uri
+	data := make([]byte, 1+32+32)
+	data = append(data, borsh("Bonk", 32)...)
+	data = append(data, borsh("BONK", 10)...)
+	data = append(data, borsh("https://arweave.net/bonk", 200)...)
+
+	name, symbol, uri, ok := decodeMetaplexMetadata(data)
+	assert.True(t, ok)
+	assert.Equal(t, "Bonk", name)
+	assert.Equal(t, "BONK", symbol)
+	assert.Equal(t, "https://arweave.net/bonk", uri)
+
+	_, _, _, ok = decodeMetaplexMetadata(data[:80])
+	assert.False(t, ok)
+}
+
+func TestMetadataCacheSavesConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	r := NewMetadataResolver(nil)
+	require.NoError(t, r.LoadCache(dir))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mint := fmt.Sprintf("mint%d", i)
+			r.mu.Lock()
+			r.cache[mint] = &TokenMetadata{Mint: mint, Symbol: "TKN", Decimals: 6}
+			r.mu.Unlock()
+			assert.NoError(t, r.save())
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded := NewMetadataResolver(nil)
+	require.NoError(t, reloaded.LoadCache(dir))
+	assert.Len(t, reloaded.cache, 8)
+	_, err := os.Stat(filepath.Join(dir, metadataCacheFile+".tmp"))
+	assert.True(t, os.IsNotExist(err), "the temporary file is renamed into place")
+}
@@ -2,36 +2,63 @@ package monitor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/accursedgalaxy/insider-monitor/internal/config"
 	"github.com/accursedgalaxy/insider-monitor/internal/price"
-	bin "github.com/gagliardetto/binary"
 	"github.com/gagliardetto/solana-go"
-	"github.com/gagliardetto/solana-go/programs/token"
 	"github.com/gagliardetto/solana-go/rpc"
 )
 
 type WalletMonitor struct {
 	client       *rpc.Client
-	wallets      []solana.PublicKey
+	wallets      []solana.PublicKey // Replaced, never modified, when a wallet is added
+	walletsMu    sync.RWMutex
 	networkURL   string
 	isConnected  bool
 	scanConfig   *config.ScanConfig
 	priceService *price.JupiterPrice
+	metadata     *MetadataResolver
+	pool         *RPCPool // Every RPC call goes through the pool
+	workers      int
+	health       *walletHealth
+	commitment   rpc.CommitmentType
+	slots        slotTracker         // Highest context slot seen, sent as minContextSlot
+	history      HistorySource       // Backfilled history, nil until enabled
+	mintAges     map[string]*MintAge // Mint -> age, nil when the age could not be found
 }
 
 func NewWalletMonitor(networkURL string, wallets []string, scanConfig *config.ScanConfig) (*WalletMonitor, error) {
-	client := rpc.NewWithCustomRPCClient(rpc.NewWithLimiter(
-		networkURL,
-		4,
-		1,
-	))
+	return NewWalletMonitorWithEndpoints([]config.RPCEndpoint{{URL: networkURL}}, wallets, scanConfig)
+}
+
+// NewWalletMonitorWithEndpoints creates a monitor whose RPC calls are spread over a pool of endpoints
+func NewWalletMonitorWithEndpoints(endpoints []config.RPCEndpoint, wallets []string, scanConfig *config.ScanConfig) (*WalletMonitor, error) {
+	workers := defaultScanWorkers
+	requestsPerSecond := float64(defaultRequestsPerSecond)
+	commitment := rpc.CommitmentFinalized
+	if scanConfig != nil {
+		commitment = parseCommitment(scanConfig.Commitment)
+		if scanConfig.Workers > 0 {
+			workers = scanConfig.Workers
+		}
+		if scanConfig.RequestsPerSecond > 0 {
+			requestsPerSecond = scanConfig.RequestsPerSecond
+		}
+	}
+
+	pool, err := NewRPCPool(endpoints, requestsPerSecond, workers)
+	if err != nil {
+		return nil, err
+	}
+	client := rpc.NewWithCustomRPCClient(pool)
 
 	// Convert wallet addresses to PublicKeys
 	pubKeys := make([]solana.PublicKey, len(wallets))
@@ -46,28 +73,97 @@ func NewWalletMonitor(networkURL string, wallets []string, scanConfig *config.Sc
 	return &WalletMonitor{
 		client:       client,
 		wallets:      pubKeys,
-		networkURL:   networkURL,
+		networkURL:   endpoints[0].URL,
 		scanConfig:   scanConfig,
 		priceService: price.NewJupiterPrice(),
+		metadata:     NewMetadataResolver(client),
+		pool:         pool,
+		workers:      workers,
+		health:       newWalletHealth(),
+		commitment:   commitment,
 	}, nil
 }
 
+// walletList returns the monitored wallets. The slice is never modified, wallets added later
+// are only in the lists returned after them.
+func (w *WalletMonitor) walletList() []solana.PublicKey {
+	w.walletsMu.RLock()
+	defer w.walletsMu.RUnlock()
+	return w.wallets
+}
+
+// AddWallet starts monitoring a wallet at runtime. Polling scans it from the next scan on,
+// the stream once it resubscribes. Adding a monitored wallet again is a no-op.
+func (w *WalletMonitor) AddWallet(addr string) error {
+	pubKey, err := solana.PublicKeyFromBase58(addr)
+	if err != nil {
+		return fmt.Errorf("invalid wallet address %s: %v", addr, err)
+	}
+
+	w.walletsMu.Lock()
+	defer w.walletsMu.Unlock()
+	for _, wallet := range w.wallets {
+		if wallet.Equals(pubKey) {
+			return nil
+		}
+	}
+	wallets := make([]solana.PublicKey, len(w.wallets), len(w.wallets)+1)
+	copy(wallets, w.wallets)
+	w.wallets = append(wallets, pubKey)
+	return nil
+}
+
+// EnableHistory lets new_wallet changes summarize the wallet's backfilled history
+func (w *WalletMonitor) EnableHistory(source HistorySource) {
+	w.history = source
+}
+
+// EndpointStatus reports the health of every RPC endpoint in the pool
+func (w *WalletMonitor) EndpointStatus() []EndpointStatus {
+	return w.pool.Status()
+}
+
+// EnableMetadataCache persists resolved token metadata under dataDir so names and
+// decimals survive restarts without refetching every mint
+func (w *WalletMonitor) EnableMetadataCache(dataDir string) error {
+	return w.metadata.LoadCache(dataDir)
+}
+
 // Simplified TokenAccountInfo
 type TokenAccountInfo struct {
 	Balance         uint64    `json:"balance"`
 	LastUpdated     time.Time `json:"last_updated"`
 	Symbol          string    `json:"symbol"`
+	Name            string    `json:"name,omitempty"`
 	Decimals        uint8     `json:"decimals"`
 	USDPrice        float64   `json:"usd_price"`
 	USDValue        float64   `json:"usd_value"`
 	ConfidenceLevel string    `json:"confidence_level"`
+
+	ProgramID  string            `json:"program_id,omitempty"` // Token program that owns the account
+	Extensions *TokenExtensions  `json:"extensions,omitempty"` // Token-2022 mint extensions
+	Accounts   map[string]uint64 `json:"accounts,omitempty"`   // Token account address -> balance, Balance is their sum
 }
 
 // Simplified WalletData
 type WalletData struct {
 	WalletAddress string                      `json:"wallet_address"`
-	TokenAccounts map[string]TokenAccountInfo `json:"token_accounts"` // mint -> info
+	TokenAccounts map[string]TokenAccountInfo `json:"token_accounts"`       // mint -> info
+	NativeSOL     *TokenAccountInfo           `json:"native_sol,omitempty"` // Lamport balance as a pseudo-holding
 	LastScanned   time.Time                   `json:"last_scanned"`
+	Slot          uint64                      `json:"slot,omitempty"` // Context slot the token accounts were read at
+}
+
+// OlderThan reports whether the snapshot was read at an earlier slot than other.
+// Snapshots without a slot (stored before slots were recorded) are never older.
+func (d *WalletData) OlderThan(other *WalletData) bool {
+	return d.Slot > 0 && other.Slot > 0 && d.Slot < other.Slot
+}
+
+// Token programs scanned for every wallet
+var tokenProgramIDs = []solana.PublicKey{
+	solana.TokenProgramID,
+	solana.Token2022ProgramID,
 }
 
 // Add these constants for retry configuration
@@ -75,32 +171,46 @@ const (
 	maxRetries     = 5
 	initialBackoff = 5 * time.Second
 	maxBackoff     = 30 * time.Second
+	rpcCallTimeout = 30 * time.Second // Per attempt, waiting on the rate limiter included
+
+	laggingNodeRetryDelay = 500 * time.Millisecond
 )
 
-func (w *WalletMonitor) getTokenAccountsWithRetry(wallet solana.PublicKey) (*rpc.GetTokenAccountsResult, error) {
+func (w *WalletMonitor) getTokenAccountsWithRetry(ctx context.Context, wallet, programID solana.PublicKey) (*rpc.GetTokenAccountsResult, error) {
 	var lastErr error
-	backoff := initialBackoff
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		accounts, err := w.client.GetTokenAccountsByOwner(
-			context.Background(),
-			wallet,
-			&rpc.GetTokenAccountsConfig{
-				ProgramId: solana.TokenProgramID.ToPointer(),
-			},
-			&rpc.GetTokenAccountsOpts{
-				Encoding: solana.EncodingBase64,
-			},
-		)
-
+		// Never accept a result older than a slot we have already seen
+		callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+		accounts, err := w.getTokenAccountsByOwner(callCtx, wallet, programID, w.slots.Highest())
+		cancel()
 		if err == nil {
 			return accounts, nil
 		}
 
+		// Shutting down, don't retry or dress up the error
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
 		lastErr = err
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "Too Many Requests") {
+		if errors.Is(err, errLaggingNode) {
+			// Discard the stale result and give the pool a chance to route to a node that caught up
+			log.Printf("⏳ Discarding result for wallet %s from a lagging RPC node: %v", wallet.String(), err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(laggingNodeRetryDelay):
+			}
+			continue
+		}
+
+		if isRateLimited(err) {
+			// The pool paused every endpoint that rate limited us, honouring its Retry-After or
+			// backing off exponentially, so the next attempt waits until one accepts requests again
+			wait := w.pool.RetryAfter()
 			log.Printf("⚠️  Rate limited on attempt %d for wallet %s, waiting %v before retry",
-				attempt+1, wallet.String(), backoff)
+				attempt+1, wallet.String(), wait.Round(time.Millisecond))
 
 			// Show helpful message on first rate limit
 			if attempt == 0 {
@@ -111,13 +221,6 @@ func (w *WalletMonitor) getTokenAccountsWithRetry(wallet solana.PublicKey) (*rpc
 				log.Printf("   • Triton: 10M requests/month free - https://triton.one")
 			}
 
-			time.Sleep(backoff)
-
-			// Exponential backoff with max
-			backoff *= 2
-			if backoff > maxBackoff {
-				backoff = maxBackoff
-			}
 			continue
 		}
 
@@ -139,7 +242,7 @@ func (w *WalletMonitor) getTokenAccountsWithRetry(wallet solana.PublicKey) (*rpc
 	}
 
 	// Enhanced final error message with actionable suggestions
-	if strings.Contains(lastErr.Error(), "429") || strings.Contains(lastErr.Error(), "Too Many Requests") {
+	if isRateLimited(lastErr) {
 		return nil, fmt.Errorf("❌ Rate limit exceeded after %d retries\n\n"+
 			"🔧 SOLUTION: You're likely using a public RPC endpoint with strict limits.\n"+
 			"   Update your config.json with a dedicated RPC endpoint:\n\n"+
@@ -187,57 +290,124 @@ func (w *WalletMonitor) shouldIncludeToken(mint string) bool {
 	}
 }
 
-func (w *WalletMonitor) GetWalletData(wallet solana.PublicKey) (*WalletData, error) {
+func (w *WalletMonitor) GetWalletData(ctx context.Context, wallet solana.PublicKey) (*WalletData, error) {
+	var tokenAccounts []tokenAccountState
+	var slot uint64
+	for _, programID := range tokenProgramIDs {
+		// Use the retry version instead
+		accounts, err := w.getTokenAccountsWithRetry(ctx, wallet, programID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token accounts for wallet %s: %w", wallet.String(), err)
+		}
+		if accounts.Context.Slot > slot {
+			slot = accounts.Context.Slot
+		}
+
+		// Process token accounts
+		for _, acc := range accounts.Value {
+			tokenAccount, err := decodeTokenAccount(acc.Pubkey, acc.Account.Data.GetBinary(), programID)
+			if err != nil {
+				log.Printf("⚠️  Warning: failed to decode token account (this is usually normal): %v", err)
+				continue
+			}
+			tokenAccounts = append(tokenAccounts, tokenAccount)
+		}
+	}
+
+	walletData := w.buildWalletData(ctx, wallet, tokenAccounts)
+	walletData.Slot = slot
+
+	log.Printf("✅ Wallet %s: found %d token accounts (after filtering)", wallet.String(), len(walletData.TokenAccounts))
+	return walletData, nil
+}
+
+// buildWalletData turns decoded token accounts into a wallet snapshot.
+// Both the polling scan and the PubSub stream build their snapshots here.
+func (w *WalletMonitor) buildWalletData(ctx context.Context, wallet solana.PublicKey, accounts []tokenAccountState) *WalletData {
 	walletData := &WalletData{
 		WalletAddress: wallet.String(),
 		TokenAccounts: make(map[string]TokenAccountInfo),
 		LastScanned:   time.Now(),
 	}
 
-	// Use the retry version instead
-	accounts, err := w.getTokenAccountsWithRetry(wallet)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get token accounts for wallet %s: %w", wallet.String(), err)
-	}
-
-	// Process token accounts
-	for _, acc := range accounts.Value {
-		var tokenAccount token.Account
-		err = bin.NewBinDecoder(acc.Account.Data.GetBinary()).Decode(&tokenAccount)
-		if err != nil {
-			log.Printf("⚠️  Warning: failed to decode token account (this is usually normal): %v", err)
-			continue
+	// Decimals, symbols and Token-2022 extensions come from the mint accounts
+	mints := make([]solana.PublicKey, 0, len(accounts))
+	for _, tokenAccount := range accounts {
+		if tokenAccount.Amount > 0 && w.shouldIncludeToken(tokenAccount.Mint.String()) {
+			mints = append(mints, tokenAccount.Mint)
 		}
+	}
+	var metadata map[string]*TokenMetadata
+	if len(mints) > 0 {
+		metadata = w.metadata.Resolve(ctx, mints)
+	}
 
+	for _, tokenAccount := range accounts {
 		// Only include accounts with positive balance and that pass the filter
 		if tokenAccount.Amount > 0 {
 			mint := tokenAccount.Mint.String()
 			if w.shouldIncludeToken(mint) {
-				walletData.TokenAccounts[mint] = TokenAccountInfo{
-					Balance:     tokenAccount.Amount,
-					LastUpdated: time.Now(),
-					Symbol:      mint[:8] + "...",
-					Decimals:    9,
+				// A wallet can hold several accounts for one mint (ATA plus auxiliary accounts),
+				// so balances are summed per mint and each account is kept for change detection
+				info, exists := walletData.TokenAccounts[mint]
+				if !exists {
+					info = TokenAccountInfo{
+						LastUpdated: time.Now(),
+						Symbol:      shortMint(mint),
+						Decimals:    9, // Only used when the mint could not be read
+						ProgramID:   tokenAccount.ProgramID.String(),
+						Accounts:    make(map[string]uint64),
+					}
+					if meta, ok := metadata[mint]; ok {
+						info.Symbol = meta.DisplaySymbol()
+						info.Name = meta.Name
+						info.Decimals = meta.Decimals
+						info.Extensions = meta.Extensions
+					}
 				}
+				info.Balance += tokenAccount.Amount
+				info.Accounts[tokenAccount.Address.String()] += tokenAccount.Amount
+				walletData.TokenAccounts[mint] = info
 			}
 		}
 	}
 
-	log.Printf("✅ Wallet %s: found %d token accounts (after filtering)", wallet.String(), len(walletData.TokenAccounts))
-	return walletData, nil
+	return walletData
 }
 
 // Add these type definitions
 type Change struct {
-	WalletAddress string
-	TokenMint     string
-	TokenSymbol   string // Add symbol
-	TokenDecimals uint8  // Add decimals
-	ChangeType    string
-	OldBalance    uint64
-	NewBalance    uint64
-	ChangePercent float64
-	TokenBalances map[string]uint64 `json:",omitempty"`
+	WalletAddress  string
+	TokenMint      string // Empty for native SOL, which is told apart by its change type
+	TokenSymbol    string // Add symbol
+	TokenName      string // Token name from the mint metadata
+	TokenDecimals  uint8  // Add decimals
+	ChangeType     string
+	OldBalance     uint64
+	NewBalance     uint64
+	ChangePercent  float64
+	TransferAmount uint64                      `json:",omitempty"` // Amount moved between the wallet's own accounts
+	TokenBalances  map[string]uint64           `json:",omitempty"`
+	Holdings       map[string]TokenAccountInfo `json:",omitempty"` // Token holdings of a new_wallet, by mint like TokenBalances
+	NativeSOL      *TokenAccountInfo           `json:",omitempty"` // Native SOL of a new_wallet, kept apart from the wrapped SOL mint
+	Extensions     *TokenExtensions            `json:",omitempty"` // Token-2022 mint extensions
+	USDPrice       float64                     // Price per whole token when known
+	USDValue       float64                     // USD value of the new balance (last known value for token_removed, wallet total for new_wallet)
+	USDChange      float64                     // USD value of the balance movement, signed, when the token is priced
+
+	AccountChanges []AccountBalanceChange `json:",omitempty"` // Per token account movements behind the change
+	Transactions   []Transaction          `json:",omitempty"` // Transactions behind the change, set by AttributeChanges
+	History        *HistorySummary        `json:",omitempty"` // Backfilled history of a new_wallet, set by AttributeChanges
+	LinkedFrom     *LinkedWallet          `json:",omitempty"` // How a discovered wallet was linked, set by Discovery.Annotate
+	FirstBuy       bool                   `json:",omitempty"` // A new_token the wallet never held before, as far as its history goes
+	TokenAge       *MintAge               `json:",omitempty"` // When the mint was created, set by ResolveTokenAges
+}
+
+// AccountBalanceChange is the movement of a single token account within a mint holding
+type AccountBalanceChange struct {
+	Address    string
+	OldBalance uint64
+	NewBalance uint64
 }
 
 func calculatePercentageChange(old, new uint64) float64 {
@@ -266,13 +436,18 @@ func abs(x float64) float64 {
 	return x
 }
 
-func (w *WalletMonitor) checkConnection() error {
-	// Try to get slot number as a simple connection test
-	_, err := w.client.GetSlot(context.Background(), rpc.CommitmentFinalized)
+func (w *WalletMonitor) checkConnection(ctx context.Context) error {
+	// Probe every endpoint, ejecting the unhealthy ones; only fails when none is usable
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	err := w.pool.CheckHealth(checkCtx)
 	w.isConnected = err == nil
 
 	if err != nil {
-		if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "Too Many Requests") {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isRateLimited(err) {
 			return fmt.Errorf("RPC rate limit exceeded during connection check\n\n"+
 				"💡 This indicates you're using a public RPC endpoint with strict limits.\n"+
 				"   Consider upgrading to a dedicated RPC provider for reliable monitoring.\n\n"+
@@ -289,45 +464,159 @@ func (w *WalletMonitor) checkConnection() error {
 	return nil
 }
 
-// Update ScanAllWallets to handle batches
-func (w *WalletMonitor) ScanAllWallets() (map[string]*WalletData, error) {
+// walletScanResult is the outcome of scanning a single wallet
+type walletScanResult struct {
+	Wallet   solana.PublicKey
+	Data     *WalletData
+	Err      error
+	Duration time.Duration
+}
+
+// scanWallets scans wallets with a bounded pool of workers. Results come back in
+// the order of the input, whatever order the workers finish in. Once ctx is cancelled
+// no new wallets are started and the results of the unscanned ones carry ctx's error.
+func (w *WalletMonitor) scanWallets(ctx context.Context, wallets []solana.PublicKey) []walletScanResult {
+	results := make([]walletScanResult, len(wallets))
+	jobs := make(chan int)
+
+	workers := w.workers
+	if workers > len(wallets) {
+		workers = len(wallets)
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				data, err := w.GetWalletData(ctx, wallets[i])
+				results[i] = walletScanResult{
+					Wallet:   wallets[i],
+					Data:     data,
+					Err:      err,
+					Duration: time.Since(start),
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range wallets {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for ; i < len(wallets); i++ {
+				results[i] = walletScanResult{Wallet: wallets[i], Err: ctx.Err()}
+			}
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// ScanAllWallets scans every wallet and returns the ones that succeeded together with a
+// report on the ones that failed. An error is only returned when nothing could be scanned.
+func (w *WalletMonitor) ScanAllWallets(ctx context.Context) (map[string]*WalletData, *ScanReport, error) {
 	// Check connection first
-	if err := w.checkConnection(); err != nil {
-		return nil, err
+	if err := w.checkConnection(ctx); err != nil {
+		return nil, nil, err
 	}
 
+	wallets := w.walletList()
+	log.Printf("📊 Scanning %d wallets with %d workers", len(wallets), w.workers)
+	start := time.Now()
+
 	results := make(map[string]*WalletData)
-	batchSize := 2
+	report := &ScanReport{}
+	for _, result := range w.scanWallets(ctx, wallets) {
+		walletAddr := result.Wallet.String()
+		if result.Err != nil {
+			failure := w.health.recordFailure(walletAddr, result.Err)
+			log.Printf("❌ Error scanning wallet %s (%d in a row): %s", walletAddr, failure.ConsecutiveFailures, failure.Error)
+			report.Failures = append(report.Failures, failure)
+			continue
+		}
 
-	for i := 0; i < len(w.wallets); i += batchSize {
-		end := i + batchSize
-		if end > len(w.wallets) {
-			end = len(w.wallets)
+		if failure, recovered := w.health.recordSuccess(walletAddr); recovered {
+			report.Recovered = append(report.Recovered, failure)
 		}
+		results[walletAddr] = result.Data
+	}
+	report.Scanned = len(results)
+	report.Duration = time.Since(start)
+
+	if len(results) == 0 && len(report.Failures) > 0 {
+		// Every wallet failing points at the endpoint rather than the wallets.
+		// Return the first error to propagate the enhanced error messages.
+		failure := report.Failures[0]
+		return nil, report, fmt.Errorf("failed to scan wallet %s: %w", failure.WalletAddress, failure.Err)
+	}
 
-		log.Printf("📊 Processing wallets %d-%d of %d", i+1, end, len(w.wallets))
+	if len(report.Failures) > 0 {
+		log.Printf("⚠️  Scanned %d of %d wallets in %v, %d failed",
+			len(results), len(wallets), report.Duration.Round(time.Millisecond), len(report.Failures))
+	} else {
+		log.Printf("✅ Scanned %d wallets in %v", len(results), report.Duration.Round(time.Millisecond))
+	}
 
-		// Process batch
-		for _, wallet := range w.wallets[i:end] {
-			data, err := w.GetWalletData(wallet)
-			if err != nil {
-				log.Printf("❌ Error scanning wallet %s: %v", wallet.String(), err)
-				// Return the error to propagate the enhanced error messages
-				return nil, fmt.Errorf("failed to scan wallet %s: %w", wallet.String(), err)
-			}
-			results[wallet.String()] = data
+	w.attachNativeBalances(ctx, results)
+
+	// Value every holding so alerts can report what a position was worth
+	w.updatePrices(ctx, results)
+
+	// A scan cut short by shutdown is incomplete, comparing it would raise false alerts
+	if ctx.Err() != nil {
+		return nil, report, ctx.Err()
+	}
+	for _, data := range results {
+		w.applyPrices(data)
+	}
+
+	return results, report, nil
+}
+
+// updatePrices refreshes the Jupiter prices of every mint held in the scan results
+func (w *WalletMonitor) updatePrices(ctx context.Context, results map[string]*WalletData) {
+	mints := []string{solana.SolMint.String()}
+	for _, data := range results {
+		for mint := range data.TokenAccounts {
+			mints = append(mints, mint)
 		}
+	}
 
-		// Small delay between batches to be nice to the RPC
-		if end < len(w.wallets) {
-			time.Sleep(500 * time.Millisecond)
+	if err := w.priceService.UpdatePrices(ctx, mints); err != nil {
+		log.Printf("Error updating prices: %v", err)
+	}
+}
+
+// applyPrices sets USD price and value on a snapshot from the last known prices
+func (w *WalletMonitor) applyPrices(data *WalletData) {
+	for mint, info := range data.TokenAccounts {
+		if priceData, ok := w.priceService.GetPrice(mint); ok {
+			info.USDPrice = priceData.Price
+			info.USDValue = float64(info.Balance) / math.Pow(10, float64(info.Decimals)) * priceData.Price
+			info.ConfidenceLevel = priceData.ConfidenceLevel
+			data.TokenAccounts[mint] = info
 		}
 	}
 
-	return results, nil
+	if data.NativeSOL != nil {
+		if priceData, ok := w.priceService.GetPrice(solana.SolMint.String()); ok {
+			data.NativeSOL.USDPrice = priceData.Price
+			data.NativeSOL.USDValue = lamportsToSOL(data.NativeSOL.Balance) * priceData.Price
+			data.NativeSOL.ConfidenceLevel = priceData.ConfidenceLevel
+		}
+	}
 }
 
-func DetectChanges(oldData, newData map[string]*WalletData, significantChange float64) []Change {
+// DetectChanges compares the wallets in newData against their previous state. Wallets that
+// failed to scan are simply absent from newData, so only successful scans are compared.
+func DetectChanges(oldData, newData map[string]*WalletData, alertCfg config.AlertConfig) []Change {
 	var changes []Change
 
 	// Check for changes in existing wallets
@@ -335,48 +624,229 @@ func DetectChanges(oldData, newData map[string]*WalletData, significantChange fl
 		oldWalletData, existed := oldData[walletAddr]
 
 		if !existed {
-			continue // Skip new wallet detection for now
+			// One consolidated baseline alert instead of a new_token alert per holding.
+			// Once stored, the baseline is what later scans are compared against.
+			changes = append(changes, newWalletChange(walletAddr, newWalletData, alertCfg))
+			continue
+		}
+
+		// A snapshot from a node that lags behind the stored one would report
+		// changes that already happened, or undo them
+		if newWalletData.OlderThan(oldWalletData) {
+			log.Printf("⏳ Skipping wallet %s: snapshot at slot %d is older than the stored slot %d",
+				walletAddr, newWalletData.Slot, oldWalletData.Slot)
+			continue
+		}
+
+		// Native SOL has its own thresholds, large SOL moves often precede token buys
+		if change, ok := detectNativeChange(walletAddr, oldWalletData.NativeSOL, newWalletData.NativeSOL,
+			alertCfg.SOLSignificantChange(), alertCfg.SOL.MinimumChange); ok && !alertCfg.Ignored(config.NativeSOL) {
+			changes = append(changes, change)
 		}
 
 		// Check for changes in existing wallet
 		for mint, newInfo := range newWalletData.TokenAccounts {
+			if alertCfg.Ignored(mint) {
+				continue
+			}
 			oldInfo, existed := oldWalletData.TokenAccounts[mint]
 
 			if !existed {
-				// New token detected
+				// New token detected, unless it is dust
+				if alertCfg.BelowMinimumBalance(newInfo.Balance, newInfo.Decimals) ||
+					!significantTokenChange(alertCfg, 0, newInfo.Balance, newInfo.Decimals, newInfo.USDPrice) {
+					continue
+				}
 				changes = append(changes, Change{
 					WalletAddress: walletAddr,
 					TokenMint:     mint,
 					TokenSymbol:   newInfo.Symbol,
+					TokenName:     newInfo.Name,
 					TokenDecimals: newInfo.Decimals,
 					ChangeType:    "new_token",
 					NewBalance:    newInfo.Balance,
+					Extensions:    newInfo.Extensions,
+					USDPrice:      newInfo.USDPrice,
+					USDValue:      newInfo.USDValue,
+					USDChange:     newInfo.USDValue,
+					FirstBuy:      true,
 				})
 				continue
 			}
 
-			// Check for significant balance changes
+			// Moves between the wallet's own accounts are reported apart from real flows
+			accountChanges := diffAccounts(oldInfo.Accounts, newInfo.Accounts)
+			if internal := internalTransferAmount(accountChanges); internal > 0 {
+				changes = append(changes, Change{
+					WalletAddress:  walletAddr,
+					TokenMint:      mint,
+					TokenSymbol:    newInfo.Symbol,
+					TokenName:      newInfo.Name,
+					TokenDecimals:  newInfo.Decimals,
+					ChangeType:     "internal_transfer",
+					OldBalance:     oldInfo.Balance,
+					NewBalance:     newInfo.Balance,
+					TransferAmount: internal,
+					Extensions:     newInfo.Extensions,
+					AccountChanges: accountChanges,
+				})
+			}
+
+			// Check for significant balance changes, valued at the current price
 			pctChange := calculatePercentageChange(oldInfo.Balance, newInfo.Balance)
-			absChange := abs(pctChange)
+			price := newInfo.USDPrice
+			if price == 0 {
+				price = oldInfo.USDPrice
+			}
+
+			// A position that is below the minimum before and after does not count
+			belowMinimum := alertCfg.BelowMinimumBalance(oldInfo.Balance, newInfo.Decimals) &&
+				alertCfg.BelowMinimumBalance(newInfo.Balance, newInfo.Decimals)
 
-			if absChange >= significantChange {
+			if oldInfo.Balance != newInfo.Balance && !belowMinimum &&
+				significantTokenChange(alertCfg, oldInfo.Balance, newInfo.Balance, newInfo.Decimals, price) {
 				changes = append(changes, Change{
-					WalletAddress: walletAddr,
-					TokenMint:     mint,
-					TokenSymbol:   newInfo.Symbol,
-					TokenDecimals: newInfo.Decimals,
-					ChangeType:    "balance_change",
-					OldBalance:    oldInfo.Balance,
-					NewBalance:    newInfo.Balance,
-					ChangePercent: pctChange,
+					WalletAddress:  walletAddr,
+					TokenMint:      mint,
+					TokenSymbol:    newInfo.Symbol,
+					TokenName:      newInfo.Name,
+					TokenDecimals:  newInfo.Decimals,
+					ChangeType:     "balance_change",
+					OldBalance:     oldInfo.Balance,
+					NewBalance:     newInfo.Balance,
+					ChangePercent:  pctChange,
+					Extensions:     newInfo.Extensions,
+					USDPrice:       price,
+					USDValue:       uiAmount(newInfo.Balance, newInfo.Decimals) * price,
+					USDChange:      (uiAmount(newInfo.Balance, newInfo.Decimals) - uiAmount(oldInfo.Balance, newInfo.Decimals)) * price,
+					AccountChanges: accountChanges,
 				})
 			}
 		}
+
+		// A token that vanished from the wallet was sold or sent off in full.
+		// Zero balance accounts are dropped from snapshots, so this is the only trace of an exit.
+		for mint, oldInfo := range oldWalletData.TokenAccounts {
+			if _, stillHeld := newWalletData.TokenAccounts[mint]; stillHeld || alertCfg.Ignored(mint) {
+				continue
+			}
+			// Dust disappearing is not an exit worth reporting
+			if alertCfg.BelowMinimumBalance(oldInfo.Balance, oldInfo.Decimals) ||
+				!significantTokenChange(alertCfg, oldInfo.Balance, 0, oldInfo.Decimals, oldInfo.USDPrice) {
+				continue
+			}
+			changes = append(changes, Change{
+				WalletAddress: walletAddr,
+				TokenMint:     mint,
+				TokenSymbol:   oldInfo.Symbol,
+				TokenName:     oldInfo.Name,
+				TokenDecimals: oldInfo.Decimals,
+				ChangeType:    "token_removed",
+				OldBalance:    oldInfo.Balance,
+				ChangePercent: -100.0,
+				Extensions:    oldInfo.Extensions,
+				USDPrice:      oldInfo.USDPrice,
+				USDValue:      oldInfo.USDValue,
+				USDChange:     -oldInfo.USDValue,
+			})
+		}
 	}
 
 	return changes
 }
 
+// significantTokenChange applies the alert thresholds to a token balance moving from oldBalance
+// to newBalance. Tokens without a price fall back to significant_change unless the policy
+// ignores them. Priced tokens have to be worth minimum_position_usd before or after and move
+// at least minimum_change_usd. Above percentage_floor_usd significant_change applies as well;
+// below it a percentage means little, and only a set minimum_change_usd can make the change count.
+func significantTokenChange(alertCfg config.AlertConfig, oldBalance, newBalance uint64, decimals uint8, price float64) bool {
+	pctChange := abs(calculatePercentageChange(oldBalance, newBalance))
+	if price <= 0 {
+		return !alertCfg.IgnoreUnpriced() && pctChange >= alertCfg.SignificantChange
+	}
+
+	oldValue := uiAmount(oldBalance, decimals) * price
+	newValue := uiAmount(newBalance, decimals) * price
+	position := math.Max(oldValue, newValue)
+	if position < alertCfg.MinimumPositionUSD || math.Abs(newValue-oldValue) < alertCfg.MinimumChangeUSD {
+		return false
+	}
+	if position >= alertCfg.PercentageFloorUSD {
+		return pctChange >= alertCfg.SignificantChange
+	}
+	return alertCfg.MinimumChangeUSD > 0
+}
+
+// newWalletChange summarises the holdings of a wallet seen for the first time, leaving out
+// ignored tokens and holdings below the minimum balance
+func newWalletChange(walletAddr string, data *WalletData, alertCfg config.AlertConfig) Change {
+	change := Change{
+		WalletAddress: walletAddr,
+		ChangeType:    "new_wallet",
+		TokenBalances: make(map[string]uint64, len(data.TokenAccounts)),
+		Holdings:      make(map[string]TokenAccountInfo, len(data.TokenAccounts)),
+	}
+
+	for mint, info := range data.TokenAccounts {
+		if alertCfg.Ignored(mint) || alertCfg.BelowMinimumBalance(info.Balance, info.Decimals) {
+			continue
+		}
+		change.TokenBalances[mint] = info.Balance
+		change.Holdings[mint] = info
+		change.USDValue += info.USDValue
+	}
+	if sol := data.NativeSOL; sol != nil && !alertCfg.Ignored(config.NativeSOL) && !alertCfg.BelowMinimumBalance(sol.Balance, sol.Decimals) {
+		native := *sol
+		change.NativeSOL = &native
+		change.USDValue += native.USDValue
+	}
+
+	return change
+}
+
+// diffAccounts lists the token accounts whose balance changed between two snapshots.
+// Snapshots stored before per-account tracking have no accounts and yield nothing.
+func diffAccounts(oldAccounts, newAccounts map[string]uint64) []AccountBalanceChange {
+	if len(oldAccounts) == 0 || len(newAccounts) == 0 {
+		return nil
+	}
+
+	var diffs []AccountBalanceChange
+	for addr, newBalance := range newAccounts {
+		if oldBalance := oldAccounts[addr]; oldBalance != newBalance {
+			diffs = append(diffs, AccountBalanceChange{Address: addr, OldBalance: oldBalance, NewBalance: newBalance})
+		}
+	}
+	for addr, oldBalance := range oldAccounts {
+		if _, ok := newAccounts[addr]; !ok {
+			diffs = append(diffs, AccountBalanceChange{Address: addr, OldBalance: oldBalance})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Address < diffs[j].Address
+	})
+	return diffs
+}
+
+// internalTransferAmount is the part of the movement that stayed within the wallet:
+// whatever left one account and showed up in another. The rest is a real in- or outflow.
+func internalTransferAmount(diffs []AccountBalanceChange) uint64 {
+	var increase, decrease uint64
+	for _, d := range diffs {
+		if d.NewBalance > d.OldBalance {
+			increase += d.NewBalance - d.OldBalance
+		} else {
+			decrease += d.OldBalance - d.NewBalance
+		}
+	}
+	if increase < decrease {
+		return increase
+	}
+	return decrease
+}
+
 // Add this helper function
 func formatTokenAmount(amount uint64, decimals uint8) string {
 	if decimals == 0 {
@@ -474,9 +944,11 @@ func formatTokenValue(value float64, confidence string) string {
 // Add a struct to hold token data with USD value
 type tokenHolding struct {
 	Mint     string
-	Amount   float64
+	Amount   uint64
+	Decimals uint8
 	USDValue float64
 	Symbol   string
+	Flags    string // Token-2022 extension warnings
 }
 
 // Update the DisplayWalletOverview function to create a more attractive output
@@ -498,6 +970,7 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 	const (
 		walletSymbol = "💼"
 		tokenSymbol  = "🔹"
+		solSymbol    = "◎"
 		dollarSymbol = "💲"
 		moreSymbol   = "..."
 		divider      = "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
@@ -507,23 +980,12 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 	fmt.Printf("%s%s SOLANA WALLET MONITOR %s\n", colorBold, colorPurple, colorReset)
 	fmt.Printf("%s%s %s\n\n", colorPurple, divider, colorReset)
 
-	// Collect all unique mints
-	mints := make([]string, 0)
-	for _, walletData := range walletDataMap {
-		for mint := range walletData.TokenAccounts {
-			mints = append(mints, mint)
-		}
-	}
-
-	// Update prices for all tokens
-	if err := m.priceService.UpdatePrices(mints); err != nil {
-		log.Printf("Error updating prices: %v", err)
-	}
+	// Prices were refreshed by the scan that produced walletDataMap
 
 	// Total value counter
 	totalPortfolioValue := 0.0
 
-	for _, wallet := range m.wallets {
+	for _, wallet := range m.walletList() {
 		fmt.Printf("%s%s %s %s%s\n", colorBold, colorBlue, walletSymbol, wallet.String(), colorReset)
 		walletData, exists := walletDataMap[wallet.String()]
 		if !exists {
@@ -535,6 +997,10 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 		holdings := make([]tokenHolding, 0)
 		walletTotalValue := 0.0
 
+		if walletData.NativeSOL != nil {
+			walletTotalValue += walletData.NativeSOL.USDValue
+		}
+
 		for mint, info := range walletData.TokenAccounts {
 			// Get price data from Jupiter
 			priceData, exists := m.priceService.GetPrice(mint)
@@ -547,17 +1013,19 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 				walletTotalValue += usdValue
 			}
 
-			// Try to look up well-known token addresses to get better names
+			// Prefer freshly resolved metadata over what was stored with older snapshots
 			symbol := info.Symbol
-			if tokenName, found := getKnownTokenName(mint); found {
-				symbol = tokenName
+			if meta, found := m.metadata.Get(mint); found {
+				symbol = meta.DisplaySymbol()
 			}
 
 			holdings = append(holdings, tokenHolding{
 				Mint:     mint,
-				Amount:   float64(info.Balance),
+				Amount:   info.Balance,
+				Decimals: info.Decimals,
 				USDValue: usdValue,
 				Symbol:   symbol,
+				Flags:    formatExtensionFlags(info.Extensions),
 			})
 		}
 
@@ -582,21 +1050,38 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 			fmt.Printf("   %s%sTotal Value: %s%s\n", colorBold, colorGreen, valueStr, colorReset)
 		}
 
+		// Native SOL is always listed first, it is not part of the token ranking
+		if sol := walletData.NativeSOL; sol != nil {
+			amountStr := formatTokenAmount(sol.Balance, sol.Decimals)
+			if sol.USDValue > 0 {
+				fmt.Printf("   %s %s%-15s%s %12s %s%s($%.2f)%s\n",
+					solSymbol,
+					colorBold,
+					nativeSOLSymbol,
+					colorReset,
+					amountStr,
+					colorGreen,
+					dollarSymbol,
+					sol.USDValue,
+					colorReset)
+			} else {
+				fmt.Printf("   %s %s%-15s%s %12s\n",
+					solSymbol,
+					colorBold,
+					nativeSOLSymbol,
+					colorReset,
+					amountStr)
+			}
+		}
+
 		// Display top 5 holdings with better formatting
 		for i := 0; i < min(5, len(holdings)); i++ {
 			holding := holdings[i]
 
-			// Get short mint or symbol for display
 			displayName := holding.Symbol
-			if displayName == holding.Mint[:8]+"..." {
-				// If it's still just the short mint, check for known tokens
-				if tokenName, found := getKnownTokenName(holding.Mint); found {
-					displayName = tokenName
-				}
-			}
 
 			// Format amount
-			actualAmount := holding.Amount / math.Pow(10, float64(9)) // assuming 9 decimals
+			actualAmount := float64(holding.Amount) / math.Pow(10, float64(holding.Decimals))
 			amountStr := ""
 			if actualAmount >= 1000000 {
 				amountStr = fmt.Sprintf("%.2fM", actualAmount/1000000)
@@ -615,7 +1100,7 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 			}
 
 			if holding.USDValue > 0 {
-				fmt.Printf("   %s %s%-15s%s %12s %s%s($%.2f)%s\n",
+				fmt.Printf("   %s %s%-15s%s %12s %s%s($%.2f)%s%s%s%s\n",
 					tokenSymbol,
 					colorBold,
 					displayName,
@@ -624,14 +1109,20 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 					valueColor,
 					dollarSymbol,
 					holding.USDValue,
+					colorReset,
+					colorYellow,
+					holding.Flags,
 					colorReset)
 			} else {
-				fmt.Printf("   %s %s%-15s%s %12s\n",
+				fmt.Printf("   %s %s%-15s%s %12s%s%s%s\n",
 					tokenSymbol,
 					colorBold,
 					displayName,
 					colorReset,
-					amountStr)
+					amountStr,
+					colorYellow,
+					holding.Flags,
+					colorReset)
 			}
 		}
 
@@ -657,24 +1148,6 @@ func (m *WalletMonitor) DisplayWalletOverview(walletDataMap map[string]*WalletDa
 	fmt.Printf("%sLast updated: %s%s\n\n", colorYellow, time.Now().Format("2006-01-02 15:04:05"), colorReset)
 }
 
-// Helper function to lookup well-known token names
-func getKnownTokenName(mint string) (string, bool) {
-	// Map of well-known token mints to symbols
-	knownTokens := map[string]string{
-		"So11111111111111111111111111111111111111112":  "SOL",
-		"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v": "USDC",
-		"Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB": "USDT",
-		"DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263": "BONK",
-		"7dHbWXmci3dT8UFYWYZweBLXgycu7Y3iL6trKn1Y7ARj": "stSOL",
-		"mSoLzYCxHdYgdzU16g5QSh3i5K3z3KZK7ytfqcJm7So":  "mSOL",
-		"kinXdEcpDQeHPEuQnqmUgtYykqKGVFq6CeVX5iAHJq6":  "KIN",
-		"JUPyiwrYJFskUPiHa7hkeR8VUtAeFoSYbKedZNsDvCN":  "JUP",
-	}
-
-	symbol, found := knownTokens[mint]
-	return symbol, found
-}
-
 // Helper function for min
 func min(a, b int) int {
 	if a < b {
@@ -1,10 +1,19 @@
 package monitor
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewWalletMonitor(t *testing.T) {
@@ -118,7 +127,7 @@ func TestDetectChanges(t *testing.T) {
 		},
 	}
 
-	changes := DetectChanges(oldData, newData, 50.0)
+	changes := DetectChanges(oldData, newData, config.AlertConfig{SignificantChange: 50.0})
 	assert.Len(t, changes, 1)
 	assert.Equal(t, "wallet1", changes[0].WalletAddress)
 	assert.Equal(t, "token1", changes[0].TokenMint)
@@ -127,6 +136,246 @@ func TestDetectChanges(t *testing.T) {
 	assert.Equal(t, 100.0, changes[0].ChangePercent)
 }
 
+func TestDetectChangesTokenRemoved(t *testing.T) {
+	oldData := map[string]*WalletData{
+		"wallet1": {
+			WalletAddress: "wallet1",
+			TokenAccounts: map[string]TokenAccountInfo{
+				"token1": {Balance: 1000, Symbol: "TKN1", Decimals: 9, USDValue: 2500},
+				"token2": {Balance: 500, Symbol: "TKN2", Decimals: 9},
+			},
+		},
+	}
+	newData := map[string]*WalletData{
+		"wallet1": {
+			WalletAddress: "wallet1",
+			TokenAccounts: map[string]TokenAccountInfo{
+				"token2": {Balance: 500, Symbol: "TKN2", Decimals: 9},
+			},
+		},
+	}
+
+	changes := DetectChanges(oldData, newData, config.AlertConfig{SignificantChange: 50.0})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "token_removed", changes[0].ChangeType)
+	assert.Equal(t, "token1", changes[0].TokenMint)
+	assert.Equal(t, uint64(1000), changes[0].OldBalance)
+	assert.Equal(t, uint64(0), changes[0].NewBalance)
+	assert.Equal(t, -100.0, changes[0].ChangePercent)
+	assert.Equal(t, 2500.0, changes[0].USDValue)
+}
+
+func TestDetectChangesUSDThresholds(t *testing.T) {
+	cfg := config.AlertConfig{
+		SignificantChange:  10.0,
+		MinimumPositionUSD: 50,
+		MinimumChangeUSD:   20,
+		PercentageFloorUSD: 1000,
+	}
+	const unit = 1_000_000 // 6 decimals
+
+	tests := []struct {
+		name     string
+		old, new uint64 // Whole tokens, 0 for a token that is not held
+		price    float64
+		cfg      config.AlertConfig
+		want     string // Change type, empty when filtered out
+	}{
+		{name: "dust tripling", old: 1, new: 3, price: 0.0001, cfg: cfg},
+		{name: "unpriced tripling", old: 1, new: 3, cfg: cfg, want: "balance_change"},
+		{name: "unpriced ignored", old: 1, new: 3, cfg: config.AlertConfig{SignificantChange: 10.0, UnpricedTokens: "ignore"}},
+		{name: "below floor, large move", old: 100, new: 150, price: 2, cfg: cfg, want: "balance_change"},
+		{name: "below floor, small move", old: 100, new: 105, price: 2, cfg: cfg},
+		{name: "above floor, small percentage", old: 1000, new: 1050, price: 2, cfg: cfg},
+		{name: "above floor, large percentage", old: 1000, new: 1500, price: 2, cfg: cfg, want: "balance_change"},
+		{name: "new dust token", new: 1, price: 1, cfg: cfg},
+		{name: "new token", new: 100, price: 1, cfg: cfg, want: "new_token"},
+		{name: "dust exit", old: 10, price: 1, cfg: cfg},
+		{name: "exit", old: 100, price: 1, cfg: cfg, want: "token_removed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holdings := func(balance uint64) map[string]TokenAccountInfo {
+				if balance == 0 {
+					return map[string]TokenAccountInfo{}
+				}
+				return map[string]TokenAccountInfo{"token1": {
+					Balance: balance * unit, Symbol: "TKN1", Decimals: 6,
+					USDPrice: tt.price, USDValue: float64(balance) * tt.price,
+				}}
+			}
+			oldData := map[string]*WalletData{"wallet1": {WalletAddress: "wallet1", TokenAccounts: holdings(tt.old)}}
+			newData := map[string]*WalletData{"wallet1": {WalletAddress: "wallet1", TokenAccounts: holdings(tt.new)}}
+
+			changes := DetectChanges(oldData, newData, tt.cfg)
+			if tt.want == "" {
+				assert.Empty(t, changes)
+				return
+			}
+			require.Len(t, changes, 1)
+			assert.Equal(t, tt.want, changes[0].ChangeType)
+			assert.InDelta(t, (float64(tt.new)-float64(tt.old))*tt.price, changes[0].USDChange, 1e-9)
+		})
+	}
+}
+
+func TestDetectChangesMinimumBalanceAndIgnoreTokens(t *testing.T) {
+	cfg := config.AlertConfig{
+		SignificantChange: 10.0,
+		MinimumBalance:    1, // Whole tokens, whatever the decimals
+		IgnoreTokens:      []string{"ignored"},
+	}
+	oldData := map[string]*WalletData{
+		"wallet1": {
+			WalletAddress: "wallet1",
+			TokenAccounts: map[string]TokenAccountInfo{
+				"ignored": {Balance: 1_000, Symbol: "IGN", Decimals: 0},
+				"small":   {Balance: 500_000, Symbol: "SML", Decimals: 6},       // 0.5
+				"growing": {Balance: 500_000, Symbol: "GRW", Decimals: 6},       // 0.5
+				"crumbs":  {Balance: 900, Symbol: "CRB", Decimals: 3},           // 0.9
+				"exited":  {Balance: 5_000_000_000, Symbol: "EXT", Decimals: 9}, // 5
+			},
+		},
+	}
+	newData := map[string]*WalletData{
+		"wallet1": {
+			WalletAddress: "wallet1",
+			TokenAccounts: map[string]TokenAccountInfo{
+				"ignored": {Balance: 9_000, Symbol: "IGN", Decimals: 0},
+				"small":   {Balance: 900_000, Symbol: "SML", Decimals: 6},   // 0.9, still below
+				"growing": {Balance: 2_000_000, Symbol: "GRW", Decimals: 6}, // 2
+				"dust":    {Balance: 10, Symbol: "DST", Decimals: 2},        // 0.1, new
+			},
+		},
+		"wallet2": {
+			WalletAddress: "wallet2",
+			TokenAccounts: map[string]TokenAccountInfo{
+				"ignored": {Balance: 1_000, Symbol: "IGN", Decimals: 0},
+				"dust":    {Balance: 10, Symbol: "DST", Decimals: 2},
+				"growing": {Balance: 2_000_000, Symbol: "GRW", Decimals: 6},
+			},
+		},
+	}
+
+	changes := DetectChanges(oldData, newData, cfg)
+	byType := map[string][]string{}
+	for _, change := range changes {
+		byType[change.ChangeType] = append(byType[change.ChangeType], change.TokenMint)
+		if change.ChangeType == "new_wallet" {
+			assert.Equal(t, map[string]uint64{"growing": 2_000_000}, change.TokenBalances)
+		}
+	}
+	assert.Equal(t, []string{"growing"}, byType["balance_change"])
+	assert.Equal(t, []string{"exited"}, byType["token_removed"]) // crumbs were below the minimum
+	assert.Empty(t, byType["new_token"])
+	assert.Len(t, byType["new_wallet"], 1)
+	assert.Len(t, changes, 3)
+}
+
+func TestDetectChangesNewWallet(t *testing.T) {
+	newData := map[string]*WalletData{
+		"wallet2": {
+			WalletAddress: "wallet2",
+			TokenAccounts: map[string]TokenAccountInfo{
+				"token1": {Balance: 1000, Symbol: "TKN1", Decimals: 6, USDValue: 25},
+				"token2": {Balance: 500, Symbol: "TKN2", Decimals: 9},
+			},
+			NativeSOL: &TokenAccountInfo{Balance: 2000000000, Symbol: "SOL", Decimals: 9, USDValue: 300},
+		},
+	}
+
+	// One consolidated alert instead of one new_token per holding
+	changes := DetectChanges(map[string]*WalletData{}, newData, config.AlertConfig{SignificantChange: 50.0})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "new_wallet", changes[0].ChangeType)
+	assert.Len(t, changes[0].TokenBalances, 2)
+	assert.Len(t, changes[0].Holdings, 2)
+	assert.Equal(t, uint8(6), changes[0].Holdings["token1"].Decimals)
+	assert.Equal(t, uint64(2000000000), changes[0].NativeSOL.Balance)
+	assert.Equal(t, 325.0, changes[0].USDValue)
+}
+
+func TestDetectChangesNewWalletWrappedAndNativeSOL(t *testing.T) {
+	wsol := solana.SolMint.String()
+	newData := map[string]*WalletData{
+		"wallet2": {
+			WalletAddress: "wallet2",
+			TokenAccounts: map[string]TokenAccountInfo{
+				wsol: {Balance: 500000000, Symbol: "wSOL", Decimals: 9, USDValue: 75},
+			},
+			NativeSOL: &TokenAccountInfo{Balance: 2000000000, Symbol: "SOL", Decimals: 9, USDValue: 300},
+		},
+	}
+
+	changes := DetectChanges(map[string]*WalletData{}, newData, config.AlertConfig{SignificantChange: 50.0})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, uint64(500000000), changes[0].Holdings[wsol].Balance, "wrapped SOL is not overwritten")
+	assert.Len(t, changes[0].Holdings, len(changes[0].TokenBalances))
+	assert.Equal(t, uint64(2000000000), changes[0].NativeSOL.Balance)
+	assert.Equal(t, 375.0, changes[0].USDValue)
+
+	// "SOL" ignores native SOL only, the wrapped SOL mint stays a holding
+	changes = DetectChanges(map[string]*WalletData{}, newData, config.AlertConfig{SignificantChange: 50.0, IgnoreTokens: []string{config.NativeSOL}})
+	assert.Nil(t, changes[0].NativeSOL)
+	assert.Contains(t, changes[0].Holdings, wsol)
+	assert.Equal(t, 75.0, changes[0].USDValue)
+
+	// minimum_balance applies to native SOL like to any holding
+	changes = DetectChanges(map[string]*WalletData{}, newData, config.AlertConfig{SignificantChange: 50.0, MinimumBalance: 3})
+	assert.Nil(t, changes[0].NativeSOL)
+	assert.Empty(t, changes[0].Holdings)
+}
+
+func TestBuildWalletDataAggregatesAccounts(t *testing.T) {
+	w, err := NewWalletMonitor("http://127.0.0.1:0", []string{testWallet}, nil)
+	assert.NoError(t, err)
+	w.metadata.cache[testMint] = &TokenMetadata{Mint: testMint, Symbol: "USDC", Decimals: 6, FetchedAt: time.Now()}
+
+	mint := solana.MustPublicKeyFromBase58(testMint)
+	ata := solana.MustPublicKeyFromBase58(testTokenAccount)
+	aux := solana.MustPublicKeyFromBase58("mSoLzYCxHdYgdzU16g5QSh3i5K3z3KZK7ytfqcJm7So")
+	account := func(address solana.PublicKey, amount uint64) tokenAccountState {
+		state := tokenAccountState{Address: address, ProgramID: solana.TokenProgramID}
+		state.Mint = mint
+		state.Amount = amount
+		return state
+	}
+
+	// RPC order must not matter
+	first := w.buildWalletData(context.Background(), w.wallets[0], []tokenAccountState{account(ata, 700), account(aux, 300)})
+	second := w.buildWalletData(context.Background(), w.wallets[0], []tokenAccountState{account(aux, 300), account(ata, 700)})
+	assert.Equal(t, uint64(1000), first.TokenAccounts[testMint].Balance)
+	assert.Equal(t, uint8(6), first.TokenAccounts[testMint].Decimals)
+	assert.Len(t, first.TokenAccounts[testMint].Accounts, 2)
+
+	cfg := config.AlertConfig{SignificantChange: 10.0}
+	changes := DetectChanges(
+		map[string]*WalletData{testWallet: first},
+		map[string]*WalletData{testWallet: second}, cfg)
+	assert.Empty(t, changes)
+
+	// Shuffling 200 from the ATA to the auxiliary account is internal, not a sale
+	moved := w.buildWalletData(context.Background(), w.wallets[0], []tokenAccountState{account(ata, 500), account(aux, 500)})
+	changes = DetectChanges(
+		map[string]*WalletData{testWallet: first},
+		map[string]*WalletData{testWallet: moved}, cfg)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "internal_transfer", changes[0].ChangeType)
+	assert.Equal(t, uint64(200), changes[0].TransferAmount)
+	assert.Len(t, changes[0].AccountChanges, 2)
+
+	// Selling 500 out of the ATA on top of the shuffle is both
+	sold := w.buildWalletData(context.Background(), w.wallets[0], []tokenAccountState{account(aux, 500)})
+	changes = DetectChanges(
+		map[string]*WalletData{testWallet: first},
+		map[string]*WalletData{testWallet: sold}, cfg)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "internal_transfer", changes[0].ChangeType)
+	assert.Equal(t, "balance_change", changes[1].ChangeType)
+	assert.Equal(t, -50.0, changes[1].ChangePercent)
+}
+
 func TestAbs(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -198,3 +447,130 @@ func TestFormatTokenAmount(t *testing.T) {
 		})
 	}
 }
+
+// newSlowRPC answers every getTokenAccountsByOwner with no accounts after a fixed latency.
+// The first rateLimited requests are rejected with 429 and a one second Retry-After.
+func newSlowRPC(latency time.Duration, rateLimited int32) (*httptest.Server, *int32) {
+	var requests int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= rateLimited {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		time.Sleep(latency)
+
+		var req struct {
+			ID interface{} `json:"id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result": map[string]interface{}{
+				"context": map[string]interface{}{"slot": 1},
+				"value":   []interface{}{},
+			},
+		})
+	})), &requests
+}
+
+func testWallets(n int) []string {
+	wallets := make([]string, n)
+	for i := range wallets {
+		wallets[i] = solana.NewWallet().PublicKey().String()
+	}
+	return wallets
+}
+
+func TestScanWalletsScalesWithWorkers(t *testing.T) {
+	server, _ := newSlowRPC(25*time.Millisecond, 0)
+	defer server.Close()
+
+	wallets := testWallets(12)
+	scanTime := func(workers int) time.Duration {
+		w, err := NewWalletMonitor(server.URL, wallets, &config.ScanConfig{Workers: workers, RequestsPerSecond: 1000})
+		require.NoError(t, err)
+
+		start := time.Now()
+		results := w.scanWallets(context.Background(), w.wallets)
+		elapsed := time.Since(start)
+
+		require.Len(t, results, len(wallets))
+		for i, result := range results {
+			require.NoError(t, result.Err)
+			assert.Equal(t, wallets[i], result.Data.WalletAddress)
+		}
+		return elapsed
+	}
+
+	// 12 wallets x 2 token programs x 25ms: ~600ms sequential, ~150ms with 4 workers
+	sequential := scanTime(1)
+	concurrent := scanTime(4)
+	t.Logf("1 worker: %v, 4 workers: %v", sequential, concurrent)
+	assert.Less(t, concurrent, sequential/2)
+}
+
+func TestScanWalletsHonoursRetryAfter(t *testing.T) {
+	server, requests := newSlowRPC(0, 1)
+	defer server.Close()
+
+	w, err := NewWalletMonitor(server.URL, testWallets(2), &config.ScanConfig{Workers: 2, RequestsPerSecond: 1000})
+	require.NoError(t, err)
+
+	start := time.Now()
+	for _, result := range w.scanWallets(context.Background(), w.wallets) {
+		require.NoError(t, result.Err)
+	}
+
+	// The 429 pauses both workers for the Retry-After instead of the default backoff
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, time.Second)
+	assert.Less(t, elapsed, initialBackoff)
+	assert.Equal(t, int32(5), atomic.LoadInt32(requests))
+}
+
+func TestWalletHealthTracksConsecutiveFailures(t *testing.T) {
+	health := newWalletHealth()
+
+	first := health.recordFailure("wallet1", fmt.Errorf("RPC request failed: boom\n\n💡 If this error persists, try:"))
+	assert.Equal(t, 1, first.ConsecutiveFailures)
+	assert.Equal(t, "RPC request failed: boom", first.Error)
+
+	second := health.recordFailure("wallet1", fmt.Errorf("connection error"))
+	assert.Equal(t, 2, second.ConsecutiveFailures)
+	assert.Equal(t, first.FailingSince, second.FailingSince)
+
+	report := &ScanReport{Failures: []WalletFailure{second}}
+	assert.True(t, report.FailedWallet("wallet1"))
+	assert.False(t, report.FailedWallet("wallet2"))
+
+	recovered, ok := health.recordSuccess("wallet1")
+	assert.True(t, ok)
+	assert.Equal(t, 2, recovered.ConsecutiveFailures)
+
+	// A success without prior failures is not a recovery, and the count starts over
+	_, ok = health.recordSuccess("wallet1")
+	assert.False(t, ok)
+	assert.Equal(t, 1, health.recordFailure("wallet1", fmt.Errorf("boom")).ConsecutiveFailures)
+}
+
+func TestScanWalletsStopsOnCancel(t *testing.T) {
+	// Every request is rate limited, so the workers sit in the Retry-After pause
+	server, _ := newSlowRPC(0, 1<<30)
+	defer server.Close()
+
+	w, err := NewWalletMonitor(server.URL, testWallets(4), &config.ScanConfig{Workers: 2, RequestsPerSecond: 1000})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	results := w.scanWallets(ctx, w.wallets)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	for _, result := range results {
+		assert.ErrorIs(t, result.Err, context.Canceled)
+	}
+}
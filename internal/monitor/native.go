@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	nativeSOLSymbol   = "SOL"
+	nativeSOLDecimals = 9
+)
+
+// getNativeBalances fetches the lamport balance of every wallet, batched with getMultipleAccounts.
+// Wallets without an on-chain account (never funded) report a zero balance.
+func (w *WalletMonitor) getNativeBalances(ctx context.Context, wallets []solana.PublicKey) (map[string]uint64, error) {
+	balances := make(map[string]uint64, len(wallets))
+
+	for i := 0; i < len(wallets); i += maxAccountsPerRequest {
+		end := i + maxAccountsPerRequest
+		if end > len(wallets) {
+			end = len(wallets)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, rpcCallTimeout)
+		minSlot := w.slots.Highest()
+		opts := &rpc.GetMultipleAccountsOpts{Commitment: w.commitment}
+		if minSlot > 0 {
+			opts.MinContextSlot = &minSlot
+		}
+		accounts, err := w.client.GetMultipleAccountsWithOpts(callCtx, wallets[i:end], opts)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get SOL balances: %w", err)
+		}
+		if err := checkContextSlot(accounts.Context.Slot, minSlot); err != nil {
+			return nil, fmt.Errorf("failed to get SOL balances: %w", err)
+		}
+
+		for j, wallet := range wallets[i:end] {
+			var lamports uint64
+			if j < len(accounts.Value) && accounts.Value[j] != nil {
+				lamports = accounts.Value[j].Lamports
+			}
+			balances[wallet.String()] = lamports
+		}
+	}
+
+	return balances, nil
+}
+
+// attachNativeBalances adds the native SOL pseudo-holding to each scanned wallet.
+// A failure only costs this scan its SOL data, token results are kept.
+func (w *WalletMonitor) attachNativeBalances(ctx context.Context, results map[string]*WalletData) {
+	wallets := make([]solana.PublicKey, 0, len(results))
+	for _, wallet := range w.walletList() {
+		if _, ok := results[wallet.String()]; ok {
+			wallets = append(wallets, wallet)
+		}
+	}
+	if len(wallets) == 0 {
+		return
+	}
+
+	balances, err := w.getNativeBalances(ctx, wallets)
+	if err != nil {
+		log.Printf("⚠️  Warning: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for addr, lamports := range balances {
+		results[addr].NativeSOL = &TokenAccountInfo{
+			Balance:     lamports,
+			LastUpdated: now,
+			Symbol:      nativeSOLSymbol,
+			Decimals:    nativeSOLDecimals,
+		}
+	}
+}
+
+func lamportsToSOL(lamports uint64) float64 {
+	return float64(lamports) / float64(solana.LAMPORTS_PER_SOL)
+}
+
+// detectNativeChange compares native SOL balances using the SOL specific thresholds. The change
+// has no TokenMint, wrapped SOL is a token of its own and mint conditions must not match both.
+func detectNativeChange(walletAddr string, oldInfo, newInfo *TokenAccountInfo, significantChange, minimumChange float64) (Change, bool) {
+	// Snapshots from before SOL tracking (or a failed balance fetch) have nothing to compare
+	if oldInfo == nil || newInfo == nil {
+		return Change{}, false
+	}
+
+	pctChange := calculatePercentageChange(oldInfo.Balance, newInfo.Balance)
+	delta := lamportsToSOL(newInfo.Balance) - lamportsToSOL(oldInfo.Balance)
+	if oldInfo.Balance == newInfo.Balance || abs(pctChange) < significantChange || abs(delta) < minimumChange {
+		return Change{}, false
+	}
+
+	return Change{
+		WalletAddress: walletAddr,
+		TokenSymbol:   nativeSOLSymbol,
+		TokenDecimals: nativeSOLDecimals,
+		ChangeType:    "sol_balance_change",
+		OldBalance:    oldInfo.Balance,
+		NewBalance:    newInfo.Balance,
+		ChangePercent: pctChange,
+		USDPrice:      newInfo.USDPrice,
+		USDValue:      newInfo.USDValue,
+	}, true
+}
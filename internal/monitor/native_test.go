@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectChangesNativeSOL(t *testing.T) {
+	snapshot := func(lamports uint64) map[string]*WalletData {
+		return map[string]*WalletData{
+			"wallet1": {
+				WalletAddress: "wallet1",
+				TokenAccounts: map[string]TokenAccountInfo{},
+				NativeSOL:     &TokenAccountInfo{Balance: lamports, Decimals: 9},
+			},
+		}
+	}
+	cfg := config.AlertConfig{
+		SignificantChange: 50.0,
+		SOL:               config.SOLAlertConfig{SignificantChange: 10.0, MinimumChange: 100},
+	}
+
+	// 5,000 SOL out of 10,000 passes both thresholds
+	changes := DetectChanges(snapshot(10_000*solana.LAMPORTS_PER_SOL), snapshot(5_000*solana.LAMPORTS_PER_SOL), cfg)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "sol_balance_change", changes[0].ChangeType)
+	assert.Empty(t, changes[0].TokenMint, "native SOL is not the wrapped SOL mint")
+	assert.Equal(t, -50.0, changes[0].ChangePercent)
+
+	// 50% of a tiny balance is below the absolute minimum
+	changes = DetectChanges(snapshot(10*solana.LAMPORTS_PER_SOL), snapshot(5*solana.LAMPORTS_PER_SOL), cfg)
+	assert.Empty(t, changes)
+
+	// Snapshots without SOL data are not compared
+	oldData := snapshot(0)
+	oldData["wallet1"].NativeSOL = nil
+	changes = DetectChanges(oldData, snapshot(5_000*solana.LAMPORTS_PER_SOL), cfg)
+	assert.Empty(t, changes)
+}
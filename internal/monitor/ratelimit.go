@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultScanWorkers       = 4
+	defaultRequestsPerSecond = 10
+)
+
+// rpcLimiter is the request budget of one RPC endpoint, shared by every scan worker.
+// A 429 from the endpoint pauses all workers at once instead of letting each one hammer it.
+type rpcLimiter struct {
+	limiter *rate.Limiter
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+func newRPCLimiter(requestsPerSecond float64, burst int) *rpcLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rpcLimiter{limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), burst)}
+}
+
+// Wait blocks until a pause has passed and the rate limit allows another request
+func (l *rpcLimiter) Wait(ctx context.Context) error {
+	for {
+		remaining := l.Paused()
+		if remaining <= 0 {
+			return l.limiter.Wait(ctx)
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Pause holds back every request for at least d
+func (l *rpcLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Paused returns how long requests are still held back
+func (l *rpcLimiter) Paused() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.pausedUntil)
+}
+
+// retryAfterTransport pauses the limiter when the RPC answers 429 with a Retry-After header.
+// The JSON-RPC client drops the response headers, so this is the only place to read it.
+type retryAfterTransport struct {
+	base    http.RoundTripper
+	limiter *rpcLimiter
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			t.limiter.Pause(wait)
+		}
+	}
+	return resp, err
+}
+
+// parseRetryAfter accepts both forms allowed by RFC 9110: delay seconds and an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
@@ -0,0 +1,436 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+const (
+	maxEndpointLatency = 2 * time.Second  // Health checks slower than this eject the endpoint
+	maxEndpointSlotLag = 150              // Slots an endpoint may trail the most advanced one
+	endpointEjectTime  = 30 * time.Second // How long an unhealthy endpoint sits out
+	healthCheckTimeout = 10 * time.Second
+)
+
+// Endpoint states reported by EndpointStatus
+const (
+	EndpointHealthy     = "healthy"
+	EndpointEjected     = "ejected"
+	EndpointRateLimited = "rate_limited"
+)
+
+// EndpointStatus is a snapshot of one RPC endpoint in the pool
+type EndpointStatus struct {
+	Name        string        `json:"name"` // Host only, API keys in the URL are not shown
+	Weight      int           `json:"weight"`
+	State       string        `json:"state"`
+	Reason      string        `json:"reason,omitempty"`
+	Slot        uint64        `json:"slot"`
+	Latency     time.Duration `json:"latency"` // Latency of the last health check
+	Requests    uint64        `json:"requests"`
+	Failures    uint64        `json:"failures"`
+	AvailableIn time.Duration `json:"available_in,omitempty"`
+}
+
+type rpcEndpoint struct {
+	name    string
+	weight  int
+	client  jsonrpc.RPCClient
+	limiter *rpcLimiter
+
+	mu           sync.Mutex
+	ejectedUntil time.Time
+	reason       string
+	backoff      time.Duration // Grows with consecutive 429s that came without a Retry-After
+	slot         uint64
+	latency      time.Duration
+	requests     uint64
+	failures     uint64
+}
+
+// RPCPool routes JSON-RPC calls over several endpoints by weight. Endpoints that fail,
+// rate limit, lag behind or respond slowly are ejected for a while and calls fail over
+// to the remaining ones. It implements rpc.JSONRPCClient so every call made through
+// the rpc.Client built on it is pooled.
+type RPCPool struct {
+	endpoints []*rpcEndpoint
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRPCPool creates a pool from the configured endpoints. Endpoints without a rate limit
+// use defaultRPS; idle connections per host are sized for the scan workers.
+func NewRPCPool(endpoints []config.RPCEndpoint, defaultRPS float64, workers int) (*RPCPool, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("at least one RPC endpoint is required")
+	}
+
+	pool := &RPCPool{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	for _, cfg := range endpoints {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("RPC endpoint URL is required")
+		}
+
+		weight := cfg.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		rps := cfg.RequestsPerSecond
+		if rps <= 0 {
+			rps = defaultRPS
+		}
+
+		limiter := newRPCLimiter(rps, workers)
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = workers
+		httpClient := &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: &retryAfterTransport{base: transport, limiter: limiter},
+		}
+
+		pool.endpoints = append(pool.endpoints, &rpcEndpoint{
+			name:    endpointName(cfg.URL),
+			weight:  weight,
+			client:  jsonrpc.NewClientWithOpts(cfg.URL, &jsonrpc.RPCClientOpts{HTTPClient: httpClient}),
+			limiter: limiter,
+		})
+	}
+	return pool, nil
+}
+
+// endpointName strips everything but the host so API keys never end up in logs or alerts
+func endpointName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
+
+func (p *RPCPool) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	return p.do(ctx, method, func(e *rpcEndpoint) error {
+		return e.client.CallForInto(ctx, out, method, params)
+	})
+}
+
+func (p *RPCPool) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	return p.do(ctx, method, func(e *rpcEndpoint) error {
+		return e.client.CallWithCallback(ctx, method, params, callback)
+	})
+}
+
+func (p *RPCPool) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	var responses jsonrpc.RPCResponses
+	err := p.do(ctx, "batch", func(e *rpcEndpoint) error {
+		var err error
+		responses, err = e.client.CallBatch(ctx, requests)
+		return err
+	})
+	return responses, err
+}
+
+// do runs call on a weighted pick of the available endpoints, failing over to the
+// next one on transport errors, 429s and server errors. JSON-RPC errors returned by
+// a healthy node are answers, not failures, and are passed straight through.
+func (p *RPCPool) do(ctx context.Context, method string, call func(*rpcEndpoint) error) error {
+	tried := make(map[*rpcEndpoint]bool, len(p.endpoints))
+	var lastErr error
+
+	for len(tried) < len(p.endpoints) {
+		e := p.pick(tried)
+		tried[e] = true
+
+		if err := e.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := call(e)
+		p.record(e, time.Since(start), err)
+
+		if err == nil || !shouldFailover(err) || ctx.Err() != nil {
+			return err
+		}
+		lastErr = err
+
+		if len(tried) < len(p.endpoints) {
+			log.Printf("🔀 %s failed on %s, failing over: %s", method, e.name, firstLine(err.Error()))
+		}
+	}
+	return lastErr
+}
+
+// pick chooses an untried endpoint by weight among the available ones. When every
+// untried endpoint is ejected or paused, the one that becomes available first is used.
+func (p *RPCPool) pick(tried map[*rpcEndpoint]bool) *rpcEndpoint {
+	now := time.Now()
+	var candidates []*rpcEndpoint
+	var soonest *rpcEndpoint
+	var soonestAt time.Time
+	totalWeight := 0
+
+	for _, e := range p.endpoints {
+		if tried[e] {
+			continue
+		}
+		availableAt := e.availableAt()
+		if !availableAt.After(now) {
+			candidates = append(candidates, e)
+			totalWeight += e.weight
+		} else if soonest == nil || availableAt.Before(soonestAt) {
+			soonest, soonestAt = e, availableAt
+		}
+	}
+
+	if len(candidates) == 0 {
+		return soonest
+	}
+
+	p.mu.Lock()
+	n := p.rand.Intn(totalWeight)
+	p.mu.Unlock()
+	for _, e := range candidates {
+		if n < e.weight {
+			return e
+		}
+		n -= e.weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// availableAt is when the endpoint may be used again, considering ejection and 429 pauses
+func (e *rpcEndpoint) availableAt() time.Time {
+	e.mu.Lock()
+	at := e.ejectedUntil
+	e.mu.Unlock()
+
+	if paused := time.Now().Add(e.limiter.Paused()); paused.After(at) {
+		at = paused
+	}
+	return at
+}
+
+func (p *RPCPool) record(e *rpcEndpoint, latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.requests++
+	switch {
+	case err == nil:
+		e.backoff = 0
+		if e.reason != "" && time.Now().After(e.ejectedUntil) {
+			log.Printf("✅ RPC endpoint %s is healthy again", e.name)
+			e.reason = ""
+		}
+
+	case isRateLimited(err):
+		e.failures++
+		e.reason = "rate limited"
+		// The transport already paused the endpoint when the response carried a Retry-After
+		if e.limiter.Paused() <= 0 {
+			if e.backoff == 0 {
+				e.backoff = initialBackoff
+			} else if e.backoff *= 2; e.backoff > maxBackoff {
+				e.backoff = maxBackoff
+			}
+			e.limiter.Pause(e.backoff)
+		}
+
+	case shouldFailover(err):
+		e.failures++
+		e.eject(firstLine(err.Error()), endpointEjectTime)
+	}
+}
+
+// eject takes the endpoint out of rotation, the caller holds e.mu
+func (e *rpcEndpoint) eject(reason string, d time.Duration) {
+	if time.Now().After(e.ejectedUntil) {
+		log.Printf("🔌 RPC endpoint %s ejected for %v: %s", e.name, d, reason)
+	}
+	e.ejectedUntil = time.Now().Add(d)
+	e.reason = reason
+}
+
+// RetryAfter returns how long until any endpoint accepts requests again, zero if one does now
+func (p *RPCPool) RetryAfter() time.Duration {
+	now := time.Now()
+	var wait time.Duration
+	for i, e := range p.endpoints {
+		d := e.availableAt().Sub(now)
+		if d <= 0 {
+			return 0
+		}
+		if i == 0 || d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// CheckHealth probes every endpoint with getHealth and getSlot, ejecting those that are
+// unhealthy, slow or lagging behind the others. It fails only when no endpoint is usable.
+func (p *RPCPool) CheckHealth(ctx context.Context) error {
+	type probe struct {
+		slot    uint64
+		latency time.Duration
+		err     error
+	}
+	probes := make([]probe, len(p.endpoints))
+
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func(i int, e *rpcEndpoint) {
+			defer wg.Done()
+			if err := e.limiter.Wait(ctx); err != nil {
+				probes[i].err = err
+				return
+			}
+
+			start := time.Now()
+			var health string
+			err := e.client.CallForInto(ctx, &health, "getHealth", nil)
+			var rpcErr *jsonrpc.RPCError
+			if errors.As(err, &rpcErr) && rpcErr.Code == -32601 {
+				err = nil // Not every provider implements getHealth
+			}
+			if err == nil {
+				err = e.client.CallForInto(ctx, &probes[i].slot, "getSlot",
+					[]interface{}{rpc.M{"commitment": rpc.CommitmentFinalized}})
+			}
+			probes[i].latency = time.Since(start)
+			probes[i].err = err
+		}(i, e)
+	}
+	wg.Wait()
+
+	var bestSlot uint64
+	for _, pr := range probes {
+		if pr.err == nil && pr.slot > bestSlot {
+			bestSlot = pr.slot
+		}
+	}
+
+	var lastErr error
+	healthy := 0
+	for i, e := range p.endpoints {
+		pr := probes[i]
+
+		if pr.err != nil && isRateLimited(pr.err) {
+			// A rate limited endpoint is alive, record handles the pause
+			p.record(e, pr.latency, pr.err)
+			lastErr = pr.err
+			continue
+		}
+
+		e.mu.Lock()
+		e.requests++
+		e.latency = pr.latency
+		if pr.err == nil {
+			e.slot = pr.slot
+		}
+
+		switch {
+		case pr.err != nil:
+			e.failures++
+			e.eject(firstLine(pr.err.Error()), endpointEjectTime)
+			lastErr = pr.err
+		case pr.latency > maxEndpointLatency:
+			e.eject(fmt.Sprintf("slow (%v)", pr.latency.Round(time.Millisecond)), endpointEjectTime)
+		case bestSlot > pr.slot+maxEndpointSlotLag:
+			e.eject(fmt.Sprintf("%d slots behind", bestSlot-pr.slot), endpointEjectTime)
+		default:
+			if e.reason != "" {
+				log.Printf("✅ RPC endpoint %s is healthy again", e.name)
+			}
+			e.ejectedUntil = time.Time{}
+			e.reason = ""
+			healthy++
+		}
+		e.mu.Unlock()
+	}
+
+	if healthy == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("all endpoints are slow or lagging")
+		}
+		return fmt.Errorf("no healthy RPC endpoint: %w", lastErr)
+	}
+	return nil
+}
+
+// Status reports the state of every endpoint in the pool
+func (p *RPCPool) Status() []EndpointStatus {
+	now := time.Now()
+	statuses := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		availableIn := e.availableAt().Sub(now)
+
+		e.mu.Lock()
+		status := EndpointStatus{
+			Name:     e.name,
+			Weight:   e.weight,
+			State:    EndpointHealthy,
+			Slot:     e.slot,
+			Latency:  e.latency,
+			Requests: e.requests,
+			Failures: e.failures,
+		}
+		if availableIn > 0 {
+			status.AvailableIn = availableIn
+			status.Reason = e.reason
+			status.State = EndpointEjected
+			if e.limiter.Paused() > 0 {
+				status.State = EndpointRateLimited
+			}
+		}
+		e.mu.Unlock()
+
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// isRateLimited recognises 429s whether they arrive as an HTTP status or a JSON-RPC error
+func isRateLimited(err error) bool {
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) && (rpcErr.Code == 429 || rpcErr.Code == -32429) {
+		return true
+	}
+	// Slot numbers in other errors can contain "429", so only match the status line
+	return strings.Contains(err.Error(), "status code: 429") || strings.Contains(err.Error(), "Too Many Requests")
+}
+
+// shouldFailover reports whether another endpoint might succeed where this one failed
+func shouldFailover(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if isRateLimited(err) {
+		return true
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		// -32005 is "node is behind" and -32016 "minimum context slot not reached",
+		// every other JSON-RPC error is a real answer
+		return rpcErr.Code == -32005 || rpcErr.Code == minContextSlotNotReached
+	}
+	return true
+}
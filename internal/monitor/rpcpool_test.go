@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeEndpoint answers getHealth and getSlot at the given slot, or fails every
+// request with the given HTTP status when it is not 200
+func newFakeEndpoint(slot uint64, status int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		var req struct {
+			ID     interface{} `json:"id"`
+			Method string      `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		var result interface{} = "ok"
+		if req.Method == "getSlot" {
+			result = slot
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+func TestRPCPoolFailsOver(t *testing.T) {
+	var goodRequests, badRequests int32
+	good := newFakeEndpoint(1000, http.StatusOK, &goodRequests)
+	defer good.Close()
+	bad := newFakeEndpoint(1000, http.StatusBadGateway, &badRequests)
+	defer bad.Close()
+
+	pool, err := NewRPCPool([]config.RPCEndpoint{
+		{URL: bad.URL, Weight: 1000}, // Picked first, almost certainly
+		{URL: good.URL, Weight: 1},
+	}, 1000, 1)
+	require.NoError(t, err)
+	client := rpc.NewWithCustomRPCClient(pool)
+
+	for i := 0; i < 5; i++ {
+		slot, err := client.GetSlot(context.Background(), rpc.CommitmentFinalized)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1000), slot)
+	}
+
+	// The failing endpoint is ejected after its first error and skipped from then on
+	assert.Equal(t, int32(1), atomic.LoadInt32(&badRequests))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&goodRequests))
+
+	statuses := pool.Status()
+	assert.Equal(t, EndpointEjected, statuses[0].State)
+	assert.Equal(t, uint64(1), statuses[0].Failures)
+	assert.Equal(t, EndpointHealthy, statuses[1].State)
+}
+
+func TestRPCPoolCheckHealth(t *testing.T) {
+	var requests int32
+	ahead := newFakeEndpoint(5000, http.StatusOK, &requests)
+	defer ahead.Close()
+	lagging := newFakeEndpoint(4000, http.StatusOK, &requests)
+	defer lagging.Close()
+	down := newFakeEndpoint(0, http.StatusServiceUnavailable, &requests)
+	defer down.Close()
+
+	pool, err := NewRPCPool([]config.RPCEndpoint{{URL: ahead.URL}, {URL: lagging.URL}, {URL: down.URL}}, 1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, pool.CheckHealth(context.Background()))
+
+	statuses := pool.Status()
+	assert.Equal(t, EndpointHealthy, statuses[0].State)
+	assert.Equal(t, uint64(5000), statuses[0].Slot)
+	assert.Equal(t, EndpointEjected, statuses[1].State)
+	assert.Equal(t, "1000 slots behind", statuses[1].Reason)
+	assert.Equal(t, EndpointEjected, statuses[2].State)
+
+	// With only the dead endpoint left there is nothing to fail over to
+	pool, err = NewRPCPool([]config.RPCEndpoint{{URL: down.URL}}, 1000, 1)
+	require.NoError(t, err)
+	assert.Error(t, pool.CheckHealth(context.Background()))
+}
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// errLaggingNode marks a response from a node that is behind a slot we have already seen
+var errLaggingNode = errors.New("RPC node is behind the last seen slot")
+
+// minContextSlotNotReached is the JSON-RPC error a node returns when minContextSlot is ahead of it
+const minContextSlotNotReached = -32016
+
+// slotTracker remembers the highest context slot seen in any response so later requests
+// can insist, through minContextSlot, on a node that has caught up with it
+type slotTracker struct {
+	highest atomic.Uint64
+}
+
+func (t *slotTracker) Observe(slot uint64) {
+	for {
+		current := t.highest.Load()
+		if slot <= current || t.highest.CompareAndSwap(current, slot) {
+			return
+		}
+	}
+}
+
+func (t *slotTracker) Highest() uint64 {
+	return t.highest.Load()
+}
+
+// parseCommitment maps the configured commitment onto the RPC type, finalized by default
+func parseCommitment(commitment string) rpc.CommitmentType {
+	switch strings.ToLower(commitment) {
+	case "processed":
+		return rpc.CommitmentProcessed
+	case "confirmed":
+		return rpc.CommitmentConfirmed
+	default:
+		return rpc.CommitmentFinalized
+	}
+}
+
+// getTokenAccountsByOwner is rpc.Client.GetTokenAccountsByOwner with minContextSlot,
+// which the library's options do not expose. Results older than minSlot are rejected.
+func (w *WalletMonitor) getTokenAccountsByOwner(ctx context.Context, wallet, programID solana.PublicKey, minSlot uint64) (*rpc.GetTokenAccountsResult, error) {
+	opts := rpc.M{
+		"encoding":   solana.EncodingBase64,
+		"commitment": w.commitment,
+	}
+	if minSlot > 0 {
+		opts["minContextSlot"] = minSlot
+	}
+
+	var out *rpc.GetTokenAccountsResult
+	err := w.client.RPCCallForInto(ctx, &out, "getTokenAccountsByOwner", []interface{}{
+		wallet,
+		rpc.M{"programId": programID},
+		opts,
+	})
+	if err != nil {
+		if isMinContextSlotError(err) {
+			return nil, fmt.Errorf("%w: %v", errLaggingNode, err)
+		}
+		return nil, err
+	}
+	if out == nil {
+		return nil, errors.New("empty getTokenAccountsByOwner response")
+	}
+	if err := checkContextSlot(out.Context.Slot, minSlot); err != nil {
+		return nil, err
+	}
+
+	w.slots.Observe(out.Context.Slot)
+	return out, nil
+}
+
+// checkContextSlot rejects responses from nodes that ignored minContextSlot
+func checkContextSlot(slot, minSlot uint64) error {
+	if slot < minSlot {
+		return fmt.Errorf("%w: context slot %d, last seen %d", errLaggingNode, slot, minSlot)
+	}
+	return nil
+}
+
+func isMinContextSlotError(err error) bool {
+	var rpcErr *jsonrpc.RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == minContextSlotNotReached
+}
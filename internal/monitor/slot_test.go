@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTokenAccountsDiscardsLaggingNode(t *testing.T) {
+	// Slots the node answers at, one per request, and the options it received
+	slots := []uint64{100, 50}
+	var options []map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     interface{}              `json:"id"`
+			Params []map[string]interface{} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		options = append(options, req.Params[len(req.Params)-1])
+
+		slot := slots[0]
+		slots = slots[1:]
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result": map[string]interface{}{
+				"context": map[string]interface{}{"slot": slot},
+				"value":   []interface{}{},
+			},
+		})
+	}))
+	defer server.Close()
+
+	w, err := NewWalletMonitor(server.URL, []string{testWallet}, &config.ScanConfig{Commitment: "confirmed"})
+	require.NoError(t, err)
+	wallet := solana.MustPublicKeyFromBase58(testWallet)
+
+	accounts, err := w.getTokenAccountsByOwner(context.Background(), wallet, solana.TokenProgramID, w.slots.Highest())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), accounts.Context.Slot)
+	assert.Equal(t, uint64(100), w.slots.Highest())
+
+	// The node ignores minContextSlot and answers from an older slot
+	_, err = w.getTokenAccountsByOwner(context.Background(), wallet, solana.TokenProgramID, w.slots.Highest())
+	assert.ErrorIs(t, err, errLaggingNode)
+
+	assert.Equal(t, "confirmed", options[0]["commitment"])
+	assert.NotContains(t, options[0], "minContextSlot")
+	assert.Equal(t, float64(100), options[1]["minContextSlot"])
+}
+
+func TestDetectChangesSkipsOlderSnapshot(t *testing.T) {
+	oldData := map[string]*WalletData{
+		"wallet1": {
+			WalletAddress: "wallet1",
+			Slot:          200,
+			TokenAccounts: map[string]TokenAccountInfo{"token1": {Balance: 1000, Symbol: "TKN1"}},
+		},
+	}
+	newData := map[string]*WalletData{
+		"wallet1": {
+			WalletAddress: "wallet1",
+			Slot:          150,
+			TokenAccounts: map[string]TokenAccountInfo{},
+		},
+	}
+
+	// Without the slot check this would be a full exit
+	assert.Empty(t, DetectChanges(oldData, newData, config.AlertConfig{SignificantChange: 50.0}))
+
+	// Snapshots stored before slots were recorded are still compared
+	oldData["wallet1"].Slot = 0
+	assert.Len(t, DetectChanges(oldData, newData, config.AlertConfig{SignificantChange: 50.0}), 1)
+}
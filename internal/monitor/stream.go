@@ -0,0 +1,396 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	tokenAccountSize     = 165 // Size of an SPL token account
+	tokenAccountOwnerOff = 32  // Offset of the owner field in an SPL token account
+	streamPingInterval   = 30 * time.Second
+	streamReconnectDelay = time.Second
+)
+
+// WalletStream keeps wallet snapshots current from Solana PubSub notifications.
+// Every monitored wallet gets a programSubscribe on both token programs filtered by
+// owner, and each notification is turned into a fresh WalletData snapshot that can
+// be fed to DetectChanges just like a polling result. The read loop only records
+// notifications, snapshots are built and delivered apart from it, so a slow consumer
+// or metadata lookup never stalls the socket. Notifications that arrive meanwhile are
+// folded into the wallet's next snapshot.
+type WalletStream struct {
+	monitor        *WalletMonitor
+	wsURL          string
+	updates        chan *WalletData
+	reconnectDelay time.Duration
+
+	mu       sync.Mutex
+	accounts map[string]map[solana.PublicKey]streamAccount // wallet -> token account -> state
+	seeded   map[string]bool
+	dirty    map[string]solana.PublicKey // Wallets changed since their last snapshot
+	wake     chan struct{}               // Signalled when a wallet becomes dirty
+}
+
+type streamAccount struct {
+	account tokenAccountState
+	slot    uint64
+}
+
+// streamSubscription identifies what a PubSub subscription is watching
+type streamSubscription struct {
+	wallet    solana.PublicKey
+	programID solana.PublicKey
+}
+
+// pubsubMessage covers both subscription responses and notifications
+type pubsubMessage struct {
+	ID     *uint64         `json:"id,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+	Method string `json:"method,omitempty"`
+	Params *struct {
+		Subscription uint64          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params,omitempty"`
+}
+
+type programNotification struct {
+	Context struct {
+		Slot uint64 `json:"slot"`
+	} `json:"context"`
+	Value rpc.KeyedAccount `json:"value"`
+}
+
+func NewWalletStream(w *WalletMonitor, wsURL string) *WalletStream {
+	return &WalletStream{
+		monitor:        w,
+		wsURL:          wsURL,
+		updates:        make(chan *WalletData, len(w.walletList())),
+		reconnectDelay: streamReconnectDelay,
+		accounts:       make(map[string]map[solana.PublicKey]streamAccount),
+		seeded:         make(map[string]bool),
+		dirty:          make(map[string]solana.PublicKey),
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// Updates delivers a full snapshot of a wallet every time one of its token accounts changes
+func (s *WalletStream) Updates() <-chan *WalletData {
+	return s.updates
+}
+
+// Run connects to the PubSub endpoint and keeps the subscriptions alive until ctx is cancelled.
+// Dropped connections are re-established with exponential backoff and every wallet is
+// resubscribed and re-seeded so notifications missed while offline are not lost.
+func (s *WalletStream) Run(ctx context.Context) {
+	go s.emitLoop(ctx)
+	delay := s.reconnectDelay
+
+	for {
+		started := time.Now()
+		err := s.runSession(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A session that stayed up for a while was healthy, start the backoff over
+		if time.Since(started) > maxBackoff {
+			delay = s.reconnectDelay
+		}
+
+		log.Printf("⚠️  PubSub stream disconnected: %v, reconnecting in %v", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+}
+
+func (s *WalletStream) runSession(ctx context.Context) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, s.wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.wsURL, err)
+	}
+	defer conn.Close()
+
+	// Unblock the reader when the caller shuts us down
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-sessionDone:
+		}
+	}()
+
+	var writeMu sync.Mutex
+	write := func(v interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(v)
+	}
+
+	// Request IDs map 1:1 onto (wallet, program) pairs
+	requests := make(map[uint64]streamSubscription)
+	wallets := s.monitor.walletList()
+	for _, wallet := range wallets {
+		for _, programID := range tokenProgramIDs {
+			filters := []rpc.RPCFilter{
+				{Memcmp: &rpc.RPCFilterMemcmp{Offset: tokenAccountOwnerOff, Bytes: solana.Base58(wallet.Bytes())}},
+			}
+			// Token-2022 accounts with extensions are larger than the base layout
+			if programID.Equals(solana.TokenProgramID) {
+				filters = append(filters, rpc.RPCFilter{DataSize: tokenAccountSize})
+			}
+
+			id := uint64(len(requests) + 1)
+			requests[id] = streamSubscription{wallet: wallet, programID: programID}
+			req := map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      id,
+				"method":  "programSubscribe",
+				"params": []interface{}{
+					programID.String(),
+					map[string]interface{}{
+						"encoding":   solana.EncodingBase64,
+						"commitment": s.monitor.commitment,
+						"filters":    filters,
+					},
+				},
+			}
+			if err := write(req); err != nil {
+				return fmt.Errorf("failed to subscribe wallet %s: %w", wallet.String(), err)
+			}
+		}
+	}
+
+	log.Printf("📡 Subscribed to token account updates for %d wallets", len(wallets))
+
+	// Seed every wallet from RPC in the background so we have full snapshots to update
+	go s.seedAll(ctx, sessionDone)
+
+	// Keep the connection alive, some providers drop idle sockets
+	go func() {
+		ticker := time.NewTicker(streamPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sessionDone:
+				return
+			case <-ticker.C:
+				writeMu.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+				writeMu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	subscriptions := make(map[uint64]streamSubscription)
+	for {
+		var msg pubsubMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		switch {
+		case msg.ID != nil:
+			sub, ok := requests[*msg.ID]
+			if !ok {
+				continue
+			}
+			if msg.Error != nil {
+				log.Printf("❌ Subscription for wallet %s rejected: %s", sub.wallet.String(), msg.Error.Message)
+				continue
+			}
+			var subID uint64
+			if err := json.Unmarshal(msg.Result, &subID); err != nil {
+				log.Printf("❌ Unexpected subscription response for wallet %s: %v", sub.wallet.String(), err)
+				continue
+			}
+			subscriptions[subID] = sub
+
+		case msg.Method == "programNotification" && msg.Params != nil:
+			sub, ok := subscriptions[msg.Params.Subscription]
+			if !ok {
+				continue
+			}
+			var notification programNotification
+			if err := json.Unmarshal(msg.Params.Result, &notification); err != nil {
+				log.Printf("⚠️  Warning: failed to parse notification for wallet %s: %v", sub.wallet.String(), err)
+				continue
+			}
+			s.handleNotification(sub, &notification)
+		}
+	}
+}
+
+func (s *WalletStream) handleNotification(sub streamSubscription, notification *programNotification) {
+	if notification.Value.Account == nil || notification.Value.Account.Data == nil {
+		return
+	}
+
+	// A closed account comes through as an empty, zero-lamport account
+	tokenAccount := tokenAccountState{Address: notification.Value.Pubkey, ProgramID: sub.programID}
+	data := notification.Value.Account.Data.GetBinary()
+	if len(data) > 0 {
+		var err error
+		if tokenAccount, err = decodeTokenAccount(notification.Value.Pubkey, data, sub.programID); err != nil {
+			log.Printf("⚠️  Warning: failed to decode streamed token account: %v", err)
+			return
+		}
+	}
+
+	if s.apply(sub.wallet, notification.Value.Pubkey, tokenAccount, notification.Context.Slot) {
+		s.markDirty(sub.wallet)
+	}
+}
+
+// seedAll loads the current token accounts of every wallet. Notifications that arrive
+// while seeding are kept if they are newer than the RPC snapshot.
+func (s *WalletStream) seedAll(ctx context.Context, sessionDone <-chan struct{}) {
+	for _, wallet := range s.monitor.walletList() {
+		select {
+		case <-sessionDone:
+			return
+		default:
+		}
+
+		results := make(map[solana.PublicKey]*rpc.GetTokenAccountsResult, len(tokenProgramIDs))
+		var err error
+		for _, programID := range tokenProgramIDs {
+			if results[programID], err = s.monitor.getTokenAccountsWithRetry(ctx, wallet, programID); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("❌ Failed to seed stream for wallet %s, relying on polling: %v", wallet.String(), err)
+			continue
+		}
+
+		s.mu.Lock()
+		state := make(map[solana.PublicKey]streamAccount)
+		for programID, accounts := range results {
+			for pubkey, current := range s.accounts[wallet.String()] {
+				if current.account.ProgramID.Equals(programID) && current.slot > accounts.Context.Slot {
+					state[pubkey] = current
+				}
+			}
+			for _, acc := range accounts.Value {
+				if current, ok := state[acc.Pubkey]; ok && current.slot > accounts.Context.Slot {
+					continue
+				}
+				tokenAccount, err := decodeTokenAccount(acc.Pubkey, acc.Account.Data.GetBinary(), programID)
+				if err != nil {
+					continue
+				}
+				state[acc.Pubkey] = streamAccount{account: tokenAccount, slot: accounts.Context.Slot}
+			}
+		}
+		s.accounts[wallet.String()] = state
+		s.seeded[wallet.String()] = true
+		s.mu.Unlock()
+
+		s.markDirty(wallet)
+	}
+}
+
+// apply records a token account update and reports whether a snapshot should be emitted
+func (s *WalletStream) apply(wallet, pubkey solana.PublicKey, account tokenAccountState, slot uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.accounts[wallet.String()]
+	if !ok {
+		state = make(map[solana.PublicKey]streamAccount)
+		s.accounts[wallet.String()] = state
+	}
+	if current, ok := state[pubkey]; ok && current.slot > slot {
+		return false
+	}
+	state[pubkey] = streamAccount{account: account, slot: slot}
+
+	// Without a full seed the snapshot would be missing the wallet's other holdings
+	return s.seeded[wallet.String()]
+}
+
+// markDirty queues a snapshot of the wallet for the emit loop
+func (s *WalletStream) markDirty(wallet solana.PublicKey) {
+	s.mu.Lock()
+	s.dirty[wallet.String()] = wallet
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// emitLoop delivers a snapshot of every dirty wallet, built from its latest state
+func (s *WalletStream) emitLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+
+		s.mu.Lock()
+		dirty := s.dirty
+		s.dirty = make(map[string]solana.PublicKey)
+		s.mu.Unlock()
+
+		for _, wallet := range dirty {
+			if ctx.Err() != nil {
+				return
+			}
+			s.emit(ctx, wallet)
+		}
+	}
+}
+
+func (s *WalletStream) emit(ctx context.Context, wallet solana.PublicKey) {
+	s.mu.Lock()
+	accounts := make([]tokenAccountState, 0, len(s.accounts[wallet.String()]))
+	var slot uint64
+	for _, acc := range s.accounts[wallet.String()] {
+		accounts = append(accounts, acc.account)
+		if acc.slot > slot {
+			slot = acc.slot
+		}
+	}
+	s.mu.Unlock()
+
+	// Prices come from the last polling pass, the stream never hits the price API itself
+	snapshot := s.monitor.buildWalletData(ctx, wallet, accounts)
+	snapshot.Slot = slot
+	s.monitor.slots.Observe(slot)
+	s.monitor.applyPrices(snapshot)
+
+	select {
+	case s.updates <- snapshot:
+	case <-ctx.Done():
+	}
+}
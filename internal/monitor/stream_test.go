@@ -0,0 +1,193 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testWallet       = "DYw8jCTfwHNRJhhmFcbXvVDTqWMEVFBX6ZKUmG5CNSKK"
+	testMint         = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+	testTokenAccount = "7dHbWXmci3dT8UFYWYZweBLXgycu7Y3iL6trKn1Y7ARj"
+)
+
+func encodeTokenAccount(t *testing.T, owner, mint string, amount uint64) string {
+	t.Helper()
+	var buf bytes.Buffer
+	err := bin.NewBinEncoder(&buf).Encode(token.Account{
+		Mint:   solana.MustPublicKeyFromBase58(mint),
+		Owner:  solana.MustPublicKeyFromBase58(owner),
+		Amount: amount,
+		State:  token.Initialized,
+	})
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func keyedAccountJSON(pubkey, data string) map[string]interface{} {
+	return map[string]interface{}{
+		"pubkey": pubkey,
+		"account": map[string]interface{}{
+			"data":       []string{data, "base64"},
+			"executable": false,
+			"lamports":   2039280,
+			"owner":      solana.TokenProgramID.String(),
+			"rentEpoch":  0,
+		},
+	}
+}
+
+// newFakeRPC answers getTokenAccountsByOwner with a single SPL token account at slot 1
+// and no Token-2022 accounts
+func newFakeRPC(t *testing.T, amount uint64) *httptest.Server {
+	data := encodeTokenAccount(t, testWallet, testMint, amount)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     interface{}       `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		value := []interface{}{}
+		if len(req.Params) > 1 && strings.Contains(string(req.Params[1]), solana.TokenProgramID.String()) {
+			value = append(value, keyedAccountJSON(testTokenAccount, data))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result": map[string]interface{}{
+				"context": map[string]interface{}{"slot": 1},
+				"value":   value,
+			},
+		})
+	}))
+}
+
+// newFakePubSub acknowledges every programSubscribe, pushes one notification with
+// the given balance and then drops the connection to force a reconnect.
+func newFakePubSub(t *testing.T, amount uint64, subscribes *int32) *httptest.Server {
+	data := encodeTokenAccount(t, testWallet, testMint, amount)
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req struct {
+			ID     uint64        `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		if req.Method != "programSubscribe" || req.Params[0] != solana.TokenProgramID.String() {
+			return
+		}
+		atomic.AddInt32(subscribes, 1)
+
+		_ = conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": 42})
+		_ = conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "programNotification",
+			"params": map[string]interface{}{
+				"subscription": 42,
+				"result": map[string]interface{}{
+					"context": map[string]interface{}{"slot": 10},
+					"value":   keyedAccountJSON(testTokenAccount, data),
+				},
+			},
+		})
+
+		time.Sleep(200 * time.Millisecond)
+	}))
+}
+
+func TestWalletStream(t *testing.T) {
+	rpcServer := newFakeRPC(t, 1000)
+	defer rpcServer.Close()
+
+	var subscribes int32
+	wsServer := newFakePubSub(t, 5000, &subscribes)
+	defer wsServer.Close()
+
+	w, err := NewWalletMonitor(rpcServer.URL, []string{testWallet}, nil)
+	require.NoError(t, err)
+
+	stream := NewWalletStream(w, "ws"+strings.TrimPrefix(wsServer.URL, "http"))
+	stream.reconnectDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go stream.Run(ctx)
+
+	// The notification at slot 10 must win over the seed at slot 1, whichever arrives first
+	for {
+		select {
+		case snapshot := <-stream.Updates():
+			assert.Equal(t, testWallet, snapshot.WalletAddress)
+			if snapshot.TokenAccounts[testMint].Balance != 5000 {
+				continue
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for streamed balance")
+		}
+		break
+	}
+
+	// The server drops every connection, so we should see a resubscription
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&subscribes) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWalletStreamReadsWhileUpdatesWait(t *testing.T) {
+	rpcServer := newFakeRPC(t, 1000)
+	defer rpcServer.Close()
+
+	var subscribes int32
+	wsServer := newFakePubSub(t, 5000, &subscribes)
+	defer wsServer.Close()
+
+	w, err := NewWalletMonitor(rpcServer.URL, []string{testWallet}, nil)
+	require.NoError(t, err)
+	stream := NewWalletStream(w, "ws"+strings.TrimPrefix(wsServer.URL, "http"))
+	stream.reconnectDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go stream.Run(ctx)
+
+	// Nobody reads the updates, notifications keep being read and sessions keep reconnecting
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&subscribes) >= 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The queued snapshot is the latest state, not the first notification or seed
+	var snapshot *WalletData
+	assert.Eventually(t, func() bool {
+		select {
+		case snapshot = <-stream.Updates():
+		default:
+		}
+		return snapshot != nil && snapshot.TokenAccounts[testMint].Balance == 5000
+	}, 5*time.Second, 10*time.Millisecond)
+}
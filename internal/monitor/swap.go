@@ -0,0 +1,271 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/utils"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Swap sides, from the point of view of the monitored wallet
+const (
+	SwapBuy   = "buy"  // Quote token (SOL or a stablecoin) in, token out
+	SwapSell  = "sell" // Token in, quote token out
+	SwapToken = "swap" // One token for another
+)
+
+// swapPrograms are the DEX and aggregator programs whose transactions are decoded as swaps
+var swapPrograms = map[string]string{
+	"JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4":  "Jupiter",
+	"JUP4Fb2cqiRUcaTHdrPC8h2gNsA5ETXiPDD33WcGuJB":  "Jupiter",
+	"675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8": "Raydium AMM",
+	"CAMMCzo5YL8w4VFF8KVHrK22GGUsp5VTaW7grrKgrWqK": "Raydium CLMM",
+	"CPMMoo8L3F4NbTegBCKVNunggL7H1ZpdTHKxQB5qKP1C": "Raydium CPMM",
+	"whirLbMiicVdio4qvUfM5KAg6Ct8VwpYzGff3uctyCc":  "Orca Whirlpool",
+	"LBUZKhRxPF3XUpBCjp4YzTKgLccjZhTSDM9YuVaPwxo":  "Meteora DLMM",
+	"Eo7WjKq67rjJQSZxS6z3YkapzY3eMj6Xy8X5EQVn5UaB": "Meteora AMM",
+	"6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P":  "pump.fun",
+	"pAMMBay6oceH9fJKBRHGP5D4bD4sWpmSwMn52FMfXEA":  "PumpSwap",
+}
+
+// aggregatorPrograms route through the DEXes above, a trade is credited to the aggregator
+var aggregatorPrograms = map[string]bool{
+	"JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4": true,
+	"JUP4Fb2cqiRUcaTHdrPC8h2gNsA5ETXiPDD33WcGuJB": true,
+}
+
+// quoteMints are what tokens are priced in, trades against them are buys or sells
+var quoteMints = map[string]string{
+	solana.SolMint.String():                        nativeSOLSymbol,
+	"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v": "USDC",
+	"Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB": "USDT",
+}
+
+// swapDustLamports is the SOL movement next to a token-to-token swap that is put down to
+// rent, priority fees and tips rather than counted as a leg of the trade
+const swapDustLamports = 10_000_000 // 0.01 SOL
+
+// Swap is a trade decoded from a transaction, from the point of view of the monitored wallet
+type Swap struct {
+	Program        string  `json:"program"` // DEX, or the aggregator that routed the trade
+	Side           string  `json:"side"`    // SwapBuy, SwapSell or SwapToken
+	InputMint      string  `json:"input_mint"`
+	InputSymbol    string  `json:"input_symbol,omitempty"`
+	InputAmount    uint64  `json:"input_amount"`
+	InputDecimals  uint8   `json:"input_decimals"`
+	OutputMint     string  `json:"output_mint"`
+	OutputSymbol   string  `json:"output_symbol,omitempty"`
+	OutputAmount   uint64  `json:"output_amount"`
+	OutputDecimals uint8   `json:"output_decimals"`
+	Price          float64 `json:"price"` // Quote per token for buys and sells, input per output for swaps
+}
+
+// String describes the trade the way an analyst would, e.g. "BOUGHT 2.10M BONK for 14.0000 SOL via Jupiter"
+func (s *Swap) String() string {
+	input := fmt.Sprintf("%s %s", utils.FormatTokenAmount(s.InputAmount, s.InputDecimals), swapSymbol(s.InputSymbol, s.InputMint))
+	output := fmt.Sprintf("%s %s", utils.FormatTokenAmount(s.OutputAmount, s.OutputDecimals), swapSymbol(s.OutputSymbol, s.OutputMint))
+
+	switch s.Side {
+	case SwapBuy:
+		return fmt.Sprintf("BOUGHT %s for %s via %s", output, input, s.Program)
+	case SwapSell:
+		return fmt.Sprintf("SOLD %s for %s via %s", input, output, s.Program)
+	default:
+		return fmt.Sprintf("SWAPPED %s for %s via %s", input, output, s.Program)
+	}
+}
+
+func swapSymbol(symbol, mint string) string {
+	if symbol != "" {
+		return symbol
+	}
+	return shortMint(mint)
+}
+
+// swapLeg is the wallet's net movement of one mint in a transaction
+type swapLeg struct {
+	Mint     string
+	Decimals uint8
+	Amount   uint64
+}
+
+// decodeSwap classifies a transaction as a swap by wallet. The transaction has to invoke a known
+// DEX or aggregator, and the wallet has to end up giving one token and receiving another.
+// Legs are read from balance changes rather than instruction data, so routes through any
+// number of pools decode the same way and the amounts are what actually settled.
+func decodeSwap(tx *solana.Transaction, meta *rpc.TransactionMeta, wallet string) (*Swap, bool) {
+	if tx == nil || meta == nil || meta.Err != nil {
+		return nil, false
+	}
+	keys := transactionAccountKeys(tx, meta)
+
+	program := swapProgram(tx, meta, keys)
+	if program == "" {
+		return nil, false
+	}
+
+	spent, received := walletLegs(tx, meta, keys, wallet)
+	// Rent for new token accounts, priority fees and tips leave a SOL remainder next to
+	// token-to-token swaps
+	if len(spent)+len(received) > 2 {
+		spent, received = dropSOLDust(spent), dropSOLDust(received)
+	}
+	if len(spent) != 1 || len(received) != 1 {
+		return nil, false
+	}
+	input, output := spent[0], received[0]
+
+	swap := &Swap{
+		Program:        program,
+		Side:           SwapToken,
+		InputMint:      input.Mint,
+		InputSymbol:    quoteMints[input.Mint],
+		InputAmount:    input.Amount,
+		InputDecimals:  input.Decimals,
+		OutputMint:     output.Mint,
+		OutputSymbol:   quoteMints[output.Mint],
+		OutputAmount:   output.Amount,
+		OutputDecimals: output.Decimals,
+	}
+
+	inputUI, outputUI := uiAmount(input.Amount, input.Decimals), uiAmount(output.Amount, output.Decimals)
+	_, inputIsQuote := quoteMints[input.Mint]
+	_, outputIsQuote := quoteMints[output.Mint]
+	switch {
+	case inputIsQuote && !outputIsQuote:
+		swap.Side = SwapBuy
+		swap.Price = inputUI / outputUI
+	case outputIsQuote && !inputIsQuote:
+		swap.Side = SwapSell
+		swap.Price = outputUI / inputUI
+	default:
+		swap.Price = inputUI / outputUI
+	}
+	return swap, true
+}
+
+// swapProgram names the program a trade went through: an aggregator anywhere in the
+// transaction, otherwise the first DEX invoked, directly or through a CPI
+func swapProgram(tx *solana.Transaction, meta *rpc.TransactionMeta, keys []solana.PublicKey) string {
+	var dex string
+	check := func(inst solana.CompiledInstruction) bool {
+		if int(inst.ProgramIDIndex) >= len(keys) {
+			return false
+		}
+		id := keys[inst.ProgramIDIndex].String()
+		name, ok := swapPrograms[id]
+		if !ok {
+			return false
+		}
+		if aggregatorPrograms[id] {
+			dex = name
+			return true
+		}
+		if dex == "" {
+			dex = name
+		}
+		return false
+	}
+
+	for _, inst := range tx.Message.Instructions {
+		if check(inst) {
+			return dex
+		}
+	}
+	for _, inner := range meta.InnerInstructions {
+		for _, inst := range inner.Instructions {
+			if check(inst) {
+				return dex
+			}
+		}
+	}
+	return dex
+}
+
+// walletLegs nets the wallet's movements per mint. SOL counts the lamports of the wallet and
+// of every token account it owns, with the fee added back: wrapping, unwrapping and the rent of
+// accounts opened or closed in the transaction then cancel out, and what remains is SOL traded.
+func walletLegs(tx *solana.Transaction, meta *rpc.TransactionMeta, keys []solana.PublicKey, wallet string) (spent, received []swapLeg) {
+	accounts := map[int]bool{}
+	for i, key := range keys {
+		if key.String() == wallet {
+			accounts[i] = true
+		}
+	}
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	for _, balances := range [][]rpc.TokenBalance{meta.PreTokenBalances, meta.PostTokenBalances} {
+		for _, balance := range balances {
+			if balance.Owner != nil && balance.Owner.String() == wallet {
+				accounts[int(balance.AccountIndex)] = true
+			}
+		}
+	}
+
+	var lamports int64
+	for i := range accounts {
+		if i < len(meta.PreBalances) && i < len(meta.PostBalances) {
+			lamports += int64(meta.PostBalances[i]) - int64(meta.PreBalances[i])
+		}
+	}
+	if len(tx.Message.AccountKeys) > 0 && tx.Message.AccountKeys[0].String() == wallet {
+		lamports += int64(meta.Fee)
+	}
+	if lamports < 0 {
+		spent = append(spent, swapLeg{Mint: solana.SolMint.String(), Decimals: nativeSOLDecimals, Amount: uint64(-lamports)})
+	} else if lamports > 0 {
+		received = append(received, swapLeg{Mint: solana.SolMint.String(), Decimals: nativeSOLDecimals, Amount: uint64(lamports)})
+	}
+
+	// Wrapped SOL is already counted in the lamports of the accounts holding it
+	type movement struct {
+		gained, lost uint64
+		decimals     uint8
+	}
+	movements := make(map[string]*movement)
+	var order []string
+	for _, delta := range tokenBalanceDeltas(meta) {
+		if delta.Owner != wallet || delta.Mint == solana.SolMint.String() {
+			continue
+		}
+		m, ok := movements[delta.Mint]
+		if !ok {
+			m = &movement{decimals: delta.Decimals}
+			movements[delta.Mint] = m
+			order = append(order, delta.Mint)
+		}
+		if delta.Post > delta.Pre {
+			m.gained += delta.Post - delta.Pre
+		} else {
+			m.lost += delta.Pre - delta.Post
+		}
+	}
+	for _, mint := range order {
+		m := movements[mint]
+		switch {
+		case m.gained > m.lost:
+			received = append(received, swapLeg{Mint: mint, Decimals: m.decimals, Amount: m.gained - m.lost})
+		case m.lost > m.gained:
+			spent = append(spent, swapLeg{Mint: mint, Decimals: m.decimals, Amount: m.lost - m.gained})
+		}
+	}
+	return spent, received
+}
+
+func dropSOLDust(legs []swapLeg) []swapLeg {
+	kept := legs[:0:0]
+	for _, leg := range legs {
+		if leg.Mint == solana.SolMint.String() && leg.Amount < swapDustLamports {
+			continue
+		}
+		kept = append(kept, leg)
+	}
+	return kept
+}
+
+func uiAmount(amount uint64, decimals uint8) float64 {
+	return float64(amount) / math.Pow(10, float64(decimals))
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	usdcMint      = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+	bonkMint      = "DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263"
+	wifMint       = "EKpQGSJtjMFqKZ9KQanSqYXRcF8fBopzLHYxdM65zcjm"
+	rayMint       = "4k3Dyjzvzp8eMZWUXbBCjEvwSkkk59S5iCNLY3QrkX6R"
+	jupMint       = "JUPyiwrYJFskUPiHa7hkeR8VUtAeFoSYbKedZNsDvCN"
+	pumpTokenMint = "2roUsCshVDvDqfq5XriyRR5oqy3a1akvxpPYeEsqpump"
+)
+
+// loadTransactionFixture reads a getTransaction result (json encoding) from testdata/swaps.
+// The trader is the fee payer. The fixtures are still hand-built, see testdata/swaps/README.md.
+func loadTransactionFixture(t *testing.T, name string) (*solana.Transaction, *rpc.TransactionMeta, string) {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "swaps", name+".json"))
+	require.NoError(t, err)
+
+	var result rpc.GetTransactionResult
+	require.NoError(t, json.Unmarshal(raw, &result))
+	tx, err := result.Transaction.GetTransaction()
+	require.NoError(t, err)
+	require.NotNil(t, tx)
+	return tx, result.Meta, tx.Message.AccountKeys[0].String()
+}
+
+func TestDecodeSwapFixtures(t *testing.T) {
+	sol := solana.SolMint.String()
+
+	tests := []struct {
+		fixture string
+		want    Swap
+		summary string
+	}{
+		{
+			fixture: "jupiter_buy", // Routed through a Raydium pool, wSOL wrapped in a temporary account
+			want: Swap{Program: "Jupiter", Side: SwapBuy,
+				InputMint: sol, InputAmount: 14_000_000_000, InputDecimals: 9,
+				OutputMint: bonkMint, OutputAmount: 210_000_000_000, OutputDecimals: 5},
+			summary: "BOUGHT 2.10M BONK for 14.0000 SOL via Jupiter",
+		},
+		{
+			fixture: "raydium_amm_sell", // Proceeds land in a persistent wSOL account
+			want: Swap{Program: "Raydium AMM", Side: SwapSell,
+				InputMint: wifMint, InputAmount: 1_500_000_000, InputDecimals: 6,
+				OutputMint: sol, OutputAmount: 9_250_000_000, OutputDecimals: 9},
+			summary: "SOLD 1.50K WIF for 9.2500 SOL via Raydium AMM",
+		},
+		{
+			fixture: "raydium_clmm_buy",
+			want: Swap{Program: "Raydium CLMM", Side: SwapBuy,
+				InputMint: usdcMint, InputAmount: 2_500_000_000, InputDecimals: 6,
+				OutputMint: rayMint, OutputAmount: 1_000_000_000, OutputDecimals: 6},
+			summary: "BOUGHT 1.00K RAY for 2.50K USDC via Raydium CLMM",
+		},
+		{
+			fixture: "orca_whirlpool_swap", // Token to token, the Jito tip is not a leg
+			want: Swap{Program: "Orca Whirlpool", Side: SwapToken,
+				InputMint: jupMint, InputAmount: 800_000_000, InputDecimals: 6,
+				OutputMint: bonkMint, OutputAmount: 3_200_000_000_000, OutputDecimals: 5},
+			summary: "SWAPPED 800.0000 JUP for 32.00M BONK via Orca Whirlpool",
+		},
+		{
+			fixture: "meteora_dlmm_sell",
+			want: Swap{Program: "Meteora DLMM", Side: SwapSell,
+				InputMint: jupMint, InputAmount: 5_000_000_000, InputDecimals: 6,
+				OutputMint: usdcMint, OutputAmount: 4_125_500_000, OutputDecimals: 6},
+			summary: "SOLD 5.00K JUP for 4.13K USDC via Meteora DLMM",
+		},
+		{
+			fixture: "pumpfun_buy", // Native SOL, the new token account's rent is not part of the price
+			want: Swap{Program: "pump.fun", Side: SwapBuy,
+				InputMint: sol, InputAmount: 2_000_000_000, InputDecimals: 9,
+				OutputMint: pumpTokenMint, OutputAmount: 71_234_567_890_123, OutputDecimals: 6},
+			summary: "BOUGHT 71.23M 2roUsCsh... for 2.0000 SOL via pump.fun",
+		},
+		{
+			fixture: "pumpfun_sell", // Token account closed in the same transaction, its rent refund is not proceeds
+			want: Swap{Program: "pump.fun", Side: SwapSell,
+				InputMint: pumpTokenMint, InputAmount: 71_234_567_890_123, InputDecimals: 6,
+				OutputMint: sol, OutputAmount: 1_950_000_000, OutputDecimals: 9},
+			summary: "SOLD 71.23M 2roUsCsh... for 1.9500 SOL via pump.fun",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			tx, meta, wallet := loadTransactionFixture(t, tt.fixture)
+			swap, ok := decodeSwap(tx, meta, wallet)
+			require.True(t, ok)
+
+			assert.Equal(t, tt.want.Program, swap.Program)
+			assert.Equal(t, tt.want.Side, swap.Side)
+			assert.Equal(t, tt.want.InputMint, swap.InputMint)
+			assert.Equal(t, tt.want.InputAmount, swap.InputAmount)
+			assert.Equal(t, tt.want.InputDecimals, swap.InputDecimals)
+			assert.Equal(t, tt.want.OutputMint, swap.OutputMint)
+			assert.Equal(t, tt.want.OutputAmount, swap.OutputAmount)
+			assert.Equal(t, tt.want.OutputDecimals, swap.OutputDecimals)
+
+			// Symbols of tokens other than SOL and stablecoins are filled in from metadata later
+			swap.InputSymbol, swap.OutputSymbol = symbolFor(swap.InputMint), symbolFor(swap.OutputMint)
+			assert.Equal(t, tt.summary, swap.String())
+		})
+	}
+}
+
+func TestDecodeSwapPrice(t *testing.T) {
+	tx, meta, wallet := loadTransactionFixture(t, "jupiter_buy")
+	swap, ok := decodeSwap(tx, meta, wallet)
+	require.True(t, ok)
+	assert.InDelta(t, 14.0/2_100_000, swap.Price, 1e-12) // SOL per BONK
+
+	tx, meta, wallet = loadTransactionFixture(t, "meteora_dlmm_sell")
+	swap, ok = decodeSwap(tx, meta, wallet)
+	require.True(t, ok)
+	assert.InDelta(t, 0.8251, swap.Price, 1e-9) // USDC per JUP
+}
+
+func TestDecodeSwapIgnoresTransfers(t *testing.T) {
+	tx, meta, wallet := loadTransactionFixture(t, "token_transfer")
+	_, ok := decodeSwap(tx, meta, wallet)
+	assert.False(t, ok)
+
+	// A swap decoded for someone who only appears in it is not a swap by them
+	tx, meta, _ = loadTransactionFixture(t, "pumpfun_buy")
+	_, ok = decodeSwap(tx, meta, solana.NewWallet().PublicKey().String())
+	assert.False(t, ok)
+}
+
+func symbolFor(mint string) string {
+	return map[string]string{
+		solana.SolMint.String(): "SOL", usdcMint: "USDC", bonkMint: "BONK", wifMint: "WIF", rayMint: "RAY", jupMint: "JUP",
+	}[mint]
+}
@@ -0,0 +1,179 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+)
+
+// Token-2022 accounts share the SPL token layout and append an account type byte
+// followed by TLV encoded extensions. Mints are padded to the token account size
+// so the account type always sits at the same offset.
+const (
+	token2022AccountTypeOffset = 165
+	token2022AccountTypeMint   = 1
+	token2022AccountTypeAcct   = 2
+	maxAccountsPerRequest      = 100 // getMultipleAccounts limit
+)
+
+// Token-2022 extension types, see spl-token-2022 ExtensionType
+const (
+	extTransferFeeConfig      uint16 = 1
+	extTransferFeeAmount      uint16 = 2
+	extMintCloseAuthority     uint16 = 3
+	extDefaultAccountState    uint16 = 6
+	extImmutableOwner         uint16 = 7
+	extMemoTransfer           uint16 = 8
+	extNonTransferable        uint16 = 9
+	extInterestBearingConfig  uint16 = 10
+	extCpiGuard               uint16 = 11
+	extPermanentDelegate      uint16 = 12
+	extNonTransferableAccount uint16 = 13
+	extTransferHook           uint16 = 14
+	extMetadataPointer        uint16 = 18
+	extTokenMetadata          uint16 = 19
+)
+
+var extensionNames = map[uint16]string{
+	extTransferFeeConfig:      "transfer_fee_config",
+	extTransferFeeAmount:      "transfer_fee_amount",
+	extMintCloseAuthority:     "mint_close_authority",
+	extDefaultAccountState:    "default_account_state",
+	extImmutableOwner:         "immutable_owner",
+	extMemoTransfer:           "memo_transfer",
+	extNonTransferable:        "non_transferable",
+	extInterestBearingConfig:  "interest_bearing",
+	extCpiGuard:               "cpi_guard",
+	extPermanentDelegate:      "permanent_delegate",
+	extNonTransferableAccount: "non_transferable_account",
+	extTransferHook:           "transfer_hook",
+	extMetadataPointer:        "metadata_pointer",
+	extTokenMetadata:          "token_metadata",
+}
+
+// TokenExtensions holds the Token-2022 extensions that matter when following insiders
+type TokenExtensions struct {
+	TransferFeeBasisPoints uint16   `json:"transfer_fee_basis_points,omitempty"`
+	TransferFeeMax         uint64   `json:"transfer_fee_max,omitempty"`
+	PermanentDelegate      string   `json:"permanent_delegate,omitempty"`
+	NonTransferable        bool     `json:"non_transferable,omitempty"`
+	TransferHook           bool     `json:"transfer_hook,omitempty"`
+	Types                  []string `json:"types,omitempty"` // Every extension present on the mint
+}
+
+// Flags returns human readable warnings for the extensions that change how a token behaves
+func (e *TokenExtensions) Flags() []string {
+	if e == nil {
+		return nil
+	}
+
+	var flags []string
+	if e.TransferFeeBasisPoints > 0 {
+		flags = append(flags, fmt.Sprintf("%.2f%% transfer fee", float64(e.TransferFeeBasisPoints)/100))
+	}
+	if e.PermanentDelegate != "" {
+		flags = append(flags, "permanent delegate "+e.PermanentDelegate)
+	}
+	if e.NonTransferable {
+		flags = append(flags, "non-transferable")
+	}
+	if e.TransferHook {
+		flags = append(flags, "transfer hook")
+	}
+	return flags
+}
+
+// tokenAccountState is a decoded token account together with its address and the program that owns it
+type tokenAccountState struct {
+	token.Account
+	Address   solana.PublicKey
+	ProgramID solana.PublicKey
+}
+
+// decodeTokenAccount decodes an SPL token or Token-2022 account. Account extensions are not
+// read, a non-transferable account is reported through its mint's Extensions.
+func decodeTokenAccount(address solana.PublicKey, data []byte, programID solana.PublicKey) (tokenAccountState, error) {
+	state := tokenAccountState{Address: address, ProgramID: programID}
+	if err := bin.NewBinDecoder(data).Decode(&state.Account); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+type tlvExtension struct {
+	kind uint16
+	data []byte
+}
+
+// parseExtensions walks the TLV area of a Token-2022 account of the expected type
+func parseExtensions(data []byte, accountType byte) []tlvExtension {
+	if len(data) <= token2022AccountTypeOffset || data[token2022AccountTypeOffset] != accountType {
+		return nil
+	}
+
+	var extensions []tlvExtension
+	offset := token2022AccountTypeOffset + 1
+	for offset+4 <= len(data) {
+		kind := binary.LittleEndian.Uint16(data[offset:])
+		length := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		offset += 4
+		if kind == 0 || offset+length > len(data) {
+			break
+		}
+		extensions = append(extensions, tlvExtension{kind: kind, data: data[offset : offset+length]})
+		offset += length
+	}
+	return extensions
+}
+
+// decodeMintExtensions extracts the insider-relevant extensions from a Token-2022 mint
+func decodeMintExtensions(data []byte) *TokenExtensions {
+	extensions := parseExtensions(data, token2022AccountTypeMint)
+	if len(extensions) == 0 {
+		return nil
+	}
+
+	result := &TokenExtensions{}
+	for _, ext := range extensions {
+		name, ok := extensionNames[ext.kind]
+		if !ok {
+			name = fmt.Sprintf("extension_%d", ext.kind)
+		}
+		result.Types = append(result.Types, name)
+
+		switch ext.kind {
+		case extTransferFeeConfig:
+			// Two authorities and the withheld amount precede the older and newer fee
+			// (epoch, maximum fee, basis points). The newer fee is the one that applies.
+			if len(ext.data) >= 108 {
+				result.TransferFeeMax = binary.LittleEndian.Uint64(ext.data[98:])
+				result.TransferFeeBasisPoints = binary.LittleEndian.Uint16(ext.data[106:])
+			}
+		case extPermanentDelegate:
+			if len(ext.data) >= 32 {
+				delegate := solana.PublicKeyFromBytes(ext.data[:32])
+				if !delegate.IsZero() {
+					result.PermanentDelegate = delegate.String()
+				}
+			}
+		case extNonTransferable:
+			result.NonTransferable = true
+		case extTransferHook:
+			result.TransferHook = true
+		}
+	}
+	return result
+}
+
+// formatExtensionFlags renders the flags as a short suffix for overviews
+func formatExtensionFlags(ext *TokenExtensions) string {
+	flags := ext.Flags()
+	if len(flags) == 0 {
+		return ""
+	}
+	return " ⚠️ " + strings.Join(flags, ", ")
+}
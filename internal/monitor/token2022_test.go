@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeMintExtensions(t *testing.T) {
+	delegate := solana.MustPublicKeyFromBase58("DYw8jCTfwHNRJhhmFcbXvVDTqWMEVFBX6ZKUmG5CNSKK")
+
+	// Base mint padded to the account size, followed by the account type byte
+	data := make([]byte, token2022AccountTypeOffset)
+	data = append(data, token2022AccountTypeMint)
+
+	tlv := func(kind uint16, value []byte) {
+		data = binary.LittleEndian.AppendUint16(data, kind)
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(value)))
+		data = append(data, value...)
+	}
+
+	transferFee := make([]byte, 108)
+	binary.LittleEndian.PutUint64(transferFee[98:], 5000)
+	binary.LittleEndian.PutUint16(transferFee[106:], 250)
+	tlv(extTransferFeeConfig, transferFee)
+	tlv(extPermanentDelegate, delegate.Bytes())
+	tlv(extNonTransferable, nil)
+
+	ext := decodeMintExtensions(data)
+	assert.NotNil(t, ext)
+	assert.Equal(t, uint16(250), ext.TransferFeeBasisPoints)
+	assert.Equal(t, uint64(5000), ext.TransferFeeMax)
+	assert.Equal(t, delegate.String(), ext.PermanentDelegate)
+	assert.True(t, ext.NonTransferable)
+	assert.Equal(t, []string{"transfer_fee_config", "permanent_delegate", "non_transferable"}, ext.Types)
+	assert.Len(t, ext.Flags(), 3)
+
+	// Plain SPL mints have no TLV area
+	assert.Nil(t, decodeMintExtensions(make([]byte, 82)))
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// maxMintAgePages bounds how many pages of a mint's signatures are walked back to its first
+// transaction. Busy mints have more, their age is then only known to be at least the oldest seen.
+const maxMintAgePages = 5
+
+// MintAge is when a mint's first transaction happened, as far back as it could be found
+type MintAge struct {
+	FirstSeen time.Time `json:"first_seen"` // Block time of the oldest transaction found
+	Complete  bool      `json:"complete"`   // FirstSeen is the mint's first transaction, otherwise the mint is older
+}
+
+// Age returns how old the mint is at now, a lower bound unless Complete
+func (a MintAge) Age(now time.Time) time.Duration {
+	return now.Sub(a.FirstSeen)
+}
+
+// ResolveTokenAges sets the TokenAge of token changes. Ages are looked up once per mint and
+// kept for the lifetime of the monitor. A lookup that fails, or finds no block times yet, is
+// retried with the next change.
+// Only called from the monitoring loop.
+func (w *WalletMonitor) ResolveTokenAges(ctx context.Context, changes []Change) {
+	for i := range changes {
+		change := &changes[i]
+		if change.TokenMint == "" || change.TokenMint == solana.SolMint.String() {
+			continue
+		}
+
+		age, ok := w.mintAges[change.TokenMint]
+		if !ok {
+			var err error
+			age, err = w.mintAge(ctx, change.TokenMint)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("⚠️ Could not look up the age of token %s: %v", change.TokenSymbol, err)
+				continue
+			}
+			if age != nil {
+				if w.mintAges == nil {
+					w.mintAges = make(map[string]*MintAge)
+				}
+				w.mintAges[change.TokenMint] = age
+			}
+		}
+		change.TokenAge = age
+	}
+}
+
+// mintAge pages back through a mint's signatures, nil when none has a block time
+func (w *WalletMonitor) mintAge(ctx context.Context, mint string) (*MintAge, error) {
+	key, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return nil, err
+	}
+
+	var age MintAge
+	var before solana.Signature
+	for page := 0; page < maxMintAgePages; page++ {
+		signatures, err := w.signaturePage(ctx, key, before, solana.Signature{})
+		if err != nil {
+			return nil, err
+		}
+		for _, sig := range signatures {
+			if t := blockTime(sig); !t.IsZero() {
+				age.FirstSeen = t
+			}
+		}
+		if len(signatures) < backfillPageSize {
+			age.Complete = true
+			break
+		}
+		before = signatures[len(signatures)-1].Signature
+	}
+
+	if age.FirstSeen.IsZero() {
+		return nil, nil
+	}
+	return &age, nil
+}
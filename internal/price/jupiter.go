@@ -1,6 +1,7 @@
 package price
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 const (
 	jupiterPriceV2URL = "https://api.jup.ag/price/v2?ids=%s"
 	maxTokensPerBatch = 100 // Jupiter API limit
+	requestTimeout    = 15 * time.Second
 )
 
 type JupiterPrice struct {
@@ -43,7 +45,7 @@ func NewJupiterPrice() *JupiterPrice {
 	}
 }
 
-func (j *JupiterPrice) UpdatePrices(mints []string) error {
+func (j *JupiterPrice) UpdatePrices(ctx context.Context, mints []string) error {
 	// Split mints into batches of 100 (Jupiter's limit)
 	for i := 0; i < len(mints); i += maxTokensPerBatch {
 		end := i + maxTokensPerBatch
@@ -52,23 +54,35 @@ func (j *JupiterPrice) UpdatePrices(mints []string) error {
 		}
 
 		batch := mints[i:end]
-		if err := j.updateBatch(batch); err != nil {
+		if err := j.updateBatch(ctx, batch); err != nil {
 			return fmt.Errorf("failed to update batch %d-%d: %w", i, end, err)
 		}
 
 		// Small delay between batches to respect rate limits
 		if end < len(mints) {
-			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+			}
 		}
 	}
 	return nil
 }
 
-func (j *JupiterPrice) updateBatch(mints []string) error {
+func (j *JupiterPrice) updateBatch(ctx context.Context, mints []string) error {
 	mintsStr := strings.Join(mints, ",")
 	url := fmt.Sprintf(jupiterPriceV2URL, mintsStr)
 
-	resp, err := http.Get(url)
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to fetch prices: %w", err)
 	}
@@ -0,0 +1,182 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/alerts"
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+)
+
+// Decision is what the first matching rule says about a change
+type Decision struct {
+	Rule         string            // Name of the rule, or its position when it has none
+	Level        alerts.AlertLevel // Empty when the rule keeps the default level
+	Destinations []string
+	Suppressed   bool // The change is only logged
+}
+
+// Engine evaluates the configured alert rules in order. It remembers when each rule last let
+// a wallet's token through, for suppress_for, so one engine is kept for the monitor's lifetime.
+type Engine struct {
+	rules  []rule
+	groups map[string]map[string]bool // Group -> wallets
+	last   map[string]time.Time       // Rule, wallet and mint -> last alert
+}
+
+// rule is a config.AlertRule with its durations parsed and its lists turned into sets
+type rule struct {
+	config.AlertRule
+	name        string
+	wallets     map[string]bool
+	mints       map[string]bool
+	changeTypes map[string]bool
+	level       alerts.AlertLevel
+	maxTokenAge time.Duration
+	minTokenAge time.Duration
+	suppressFor time.Duration
+}
+
+// NewEngine prepares the rules of a validated config
+func NewEngine(rules []config.AlertRule, groups map[string][]string) *Engine {
+	e := &Engine{
+		groups: make(map[string]map[string]bool),
+		last:   make(map[string]time.Time),
+	}
+	for group, wallets := range groups {
+		e.groups[group] = set(wallets)
+	}
+	for i, r := range rules {
+		prepared := rule{
+			AlertRule:   r,
+			name:        r.Name,
+			wallets:     set(r.Wallets),
+			mints:       set(r.Mints),
+			changeTypes: set(r.ChangeTypes),
+		}
+		if prepared.name == "" {
+			prepared.name = fmt.Sprintf("#%d", i+1)
+		}
+		prepared.level, _ = alerts.ParseLevel(r.Level)
+		prepared.maxTokenAge, _ = time.ParseDuration(r.MaxTokenAge)
+		prepared.minTokenAge, _ = time.ParseDuration(r.MinTokenAge)
+		prepared.suppressFor, _ = time.ParseDuration(r.SuppressFor)
+		e.rules = append(e.rules, prepared)
+	}
+	return e
+}
+
+// Evaluate returns the decision of the first rule matching the change, false when none does
+// or the engine is nil
+func (e *Engine) Evaluate(change monitor.Change, now time.Time) (Decision, bool) {
+	if e == nil {
+		return Decision{}, false
+	}
+
+	for _, r := range e.rules {
+		if !e.matches(r, change, now) {
+			continue
+		}
+
+		decision := Decision{
+			Rule:         r.name,
+			Level:        r.level,
+			Destinations: r.Destinations,
+			Suppressed:   r.Suppress,
+		}
+		if r.suppressFor > 0 && !r.Suppress {
+			key := r.name + ":" + change.WalletAddress + ":" + change.TokenMint
+			if last, ok := e.last[key]; ok && now.Sub(last) < r.suppressFor {
+				decision.Suppressed = true
+			} else {
+				e.last[key] = now
+			}
+		}
+		return decision, true
+	}
+	return Decision{}, false
+}
+
+// matches reports whether every condition the rule sets holds for the change
+func (e *Engine) matches(r rule, change monitor.Change, now time.Time) bool {
+	if len(r.wallets) > 0 && !r.wallets[change.WalletAddress] {
+		return false
+	}
+	if len(r.Groups) > 0 && !e.inGroup(r.Groups, change) {
+		return false
+	}
+	if len(r.mints) > 0 && !r.mints[change.TokenMint] {
+		return false
+	}
+	if len(r.changeTypes) > 0 && !r.changeTypes[change.ChangeType] {
+		return false
+	}
+	if r.MinChangePercent > 0 && abs(changePercent(change)) < r.MinChangePercent {
+		return false
+	}
+	if r.MinUSDValue > 0 && change.USDValue < r.MinUSDValue {
+		return false
+	}
+	if r.MinUSDChange > 0 && abs(change.USDChange) < r.MinUSDChange {
+		return false
+	}
+	if r.FirstBuy != nil && change.FirstBuy != *r.FirstBuy {
+		return false
+	}
+
+	// Tokens of unknown age match neither bound. A busy mint's age is only a lower bound, it
+	// fails max_token_age and passes min_token_age, since the mint is older than what was seen.
+	if r.maxTokenAge > 0 || r.minTokenAge > 0 {
+		age := change.TokenAge
+		if age == nil {
+			return false
+		}
+		if r.maxTokenAge > 0 && (!age.Complete || age.Age(now) > r.maxTokenAge) {
+			return false
+		}
+		if r.minTokenAge > 0 && age.Complete && age.Age(now) < r.minTokenAge {
+			return false
+		}
+	}
+	return true
+}
+
+// changePercent is the change's percentage. New positions have no previous balance to
+// compare against, they grew by 100%.
+func changePercent(change monitor.Change) float64 {
+	switch change.ChangeType {
+	case "new_token", "new_wallet":
+		return 100
+	}
+	return change.ChangePercent
+}
+
+// inGroup reports whether the change's wallet, or the wallet it was linked from, is in any of the groups
+func (e *Engine) inGroup(groups []string, change monitor.Change) bool {
+	for _, group := range groups {
+		members := e.groups[group]
+		if members[change.WalletAddress] {
+			return true
+		}
+		if change.LinkedFrom != nil && members[change.LinkedFrom.Root] {
+			return true
+		}
+	}
+	return false
+}
+
+func set(values []string) map[string]bool {
+	result := make(map[string]bool, len(values))
+	for _, value := range values {
+		result[value] = true
+	}
+	return result
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,152 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/alerts"
+	"github.com/accursedgalaxy/insider-monitor/internal/config"
+	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	insider  = "55kBY9yxqSC42boV8PywT2gqGzgjjZCK4ZtZjqbDbbMy"
+	outsider = "CvQk2xkXtiMj2JqqVx1YZkeSqQ7jyQkNqqjeNE1jPTfc"
+	linked   = "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM"
+	bonk     = "DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263"
+	fresh    = "FreshMint1111111111111111111111111111111111"
+)
+
+func TestEngineEvaluatesRulesInOrder(t *testing.T) {
+	yes := true
+	engine := NewEngine([]config.AlertRule{
+		{Name: "ignore bonk", Mints: []string{bonk}, Suppress: true},
+		{Name: "insider first buys of new tokens", Groups: []string{"insiders"}, FirstBuy: &yes,
+			MaxTokenAge: "24h", Level: "critical", Destinations: []string{"pager", "discord"}},
+		{Name: "big sells", ChangeTypes: []string{"balance_change"}, MinChangePercent: 50, MinUSDChange: 1000,
+			Level: "warning", SuppressFor: "30m"},
+		{Level: "info"},
+	}, map[string][]string{"insiders": {insider}})
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	newToken := monitor.Change{WalletAddress: insider, TokenMint: fresh, ChangeType: "new_token", FirstBuy: true,
+		TokenAge: &monitor.MintAge{FirstSeen: now.Add(-2 * time.Hour), Complete: true}}
+	sell := monitor.Change{WalletAddress: outsider, TokenMint: fresh, ChangeType: "balance_change",
+		ChangePercent: -80, USDChange: -2500}
+
+	tests := []struct {
+		name   string
+		change func() monitor.Change
+		rule   string
+		level  alerts.AlertLevel
+	}{
+		{"suppressed mint", func() monitor.Change {
+			c := newToken
+			c.TokenMint = bonk
+			return c
+		}, "ignore bonk", ""},
+		{"insider first buy", func() monitor.Change { return newToken }, "insider first buys of new tokens", alerts.Critical},
+		{"wallet linked from an insider", func() monitor.Change {
+			c := newToken
+			c.WalletAddress = linked
+			c.LinkedFrom = &monitor.LinkedWallet{Address: linked, Parent: insider, Root: insider}
+			return c
+		}, "insider first buys of new tokens", alerts.Critical},
+		{"outsider first buy", func() monitor.Change {
+			c := newToken
+			c.WalletAddress = outsider
+			return c
+		}, "#4", alerts.Info},
+		{"re-entry", func() monitor.Change {
+			c := newToken
+			c.FirstBuy = false
+			return c
+		}, "#4", alerts.Info},
+		{"old token", func() monitor.Change {
+			c := newToken
+			c.TokenAge = &monitor.MintAge{FirstSeen: now.Add(-48 * time.Hour), Complete: true}
+			return c
+		}, "#4", alerts.Info},
+		{"busy token of unknown creation", func() monitor.Change {
+			c := newToken
+			c.TokenAge = &monitor.MintAge{FirstSeen: now.Add(-time.Hour)}
+			return c
+		}, "#4", alerts.Info},
+		{"unknown age", func() monitor.Change {
+			c := newToken
+			c.TokenAge = nil
+			return c
+		}, "#4", alerts.Info},
+		{"big sell", func() monitor.Change { return sell }, "big sells", alerts.Warning},
+		{"small sell", func() monitor.Change {
+			c := sell
+			c.USDChange = -200
+			return c
+		}, "#4", alerts.Info},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, ok := engine.Evaluate(tt.change(), now)
+			assert.True(t, ok)
+			assert.Equal(t, tt.rule, decision.Rule)
+			assert.Equal(t, tt.level, decision.Level)
+		})
+	}
+
+	decision, _ := engine.Evaluate(newToken, now)
+	assert.Equal(t, []string{"pager", "discord"}, decision.Destinations)
+	assert.False(t, decision.Suppressed)
+
+	decision, _ = engine.Evaluate(monitor.Change{TokenMint: bonk, ChangeType: "balance_change"}, now)
+	assert.True(t, decision.Suppressed)
+
+	// The same sell again within 30 minutes is suppressed, another token is not
+	decision, _ = engine.Evaluate(sell, now.Add(10*time.Minute))
+	assert.True(t, decision.Suppressed)
+	other := sell
+	other.TokenMint = bonk + "x"
+	decision, _ = engine.Evaluate(other, now.Add(10*time.Minute))
+	assert.False(t, decision.Suppressed)
+	decision, _ = engine.Evaluate(sell, now.Add(31*time.Minute))
+	assert.False(t, decision.Suppressed)
+}
+
+func TestEngineWithoutMatchingRule(t *testing.T) {
+	engine := NewEngine([]config.AlertRule{{ChangeTypes: []string{"token_removed"}, MinTokenAge: "1h"}}, nil)
+	now := time.Now()
+
+	_, ok := engine.Evaluate(monitor.Change{ChangeType: "new_token"}, now)
+	assert.False(t, ok)
+
+	// A lower bound is enough for a minimum age
+	decision, ok := engine.Evaluate(monitor.Change{ChangeType: "token_removed",
+		TokenAge: &monitor.MintAge{FirstSeen: now.Add(-2 * time.Hour)}}, now)
+	assert.True(t, ok)
+	assert.Empty(t, decision.Level, "the default level is kept")
+
+	// So is one that is younger than the minimum, the mint is older than its oldest page
+	_, ok = engine.Evaluate(monitor.Change{ChangeType: "token_removed",
+		TokenAge: &monitor.MintAge{FirstSeen: now.Add(-time.Minute)}}, now)
+	assert.True(t, ok)
+	_, ok = engine.Evaluate(monitor.Change{ChangeType: "token_removed",
+		TokenAge: &monitor.MintAge{FirstSeen: now.Add(-time.Minute), Complete: true}}, now)
+	assert.False(t, ok)
+
+	var none *Engine
+	_, ok = none.Evaluate(monitor.Change{ChangeType: "new_token"}, now)
+	assert.False(t, ok)
+}
+
+func TestEngineCountsNewPositionsAsFullChange(t *testing.T) {
+	engine := NewEngine([]config.AlertRule{{Name: "big moves", MinChangePercent: 50, Level: "warning"}}, nil)
+	now := time.Now()
+
+	for _, changeType := range []string{"new_token", "new_wallet"} {
+		decision, ok := engine.Evaluate(monitor.Change{ChangeType: changeType}, now)
+		assert.True(t, ok, changeType)
+		assert.Equal(t, "big moves", decision.Rule)
+	}
+	_, ok := engine.Evaluate(monitor.Change{ChangeType: "balance_change", ChangePercent: 20}, now)
+	assert.False(t, ok)
+}
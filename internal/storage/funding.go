@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+)
+
+const fundingGraphFile = "funding_graph.json"
+
+// SaveFundingGraph replaces the funding graph through a rename, so a crash leaves either
+// the old or the new graph
+func (s *Storage) SaveFundingGraph(graph *monitor.FundingGraph) error {
+	if err := os.MkdirAll(s.dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	file, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal funding graph: %w", err)
+	}
+	path := filepath.Join(s.dataDir, fundingGraphFile)
+	if err := os.WriteFile(path+".tmp", file, 0644); err != nil {
+		return fmt.Errorf("failed to write funding graph: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadFundingGraph returns the saved funding graph, or an empty one on the first run
+func (s *Storage) LoadFundingGraph() (*monitor.FundingGraph, error) {
+	file, err := os.ReadFile(filepath.Join(s.dataDir, fundingGraphFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return monitor.NewFundingGraph(), nil
+		}
+		return nil, fmt.Errorf("failed to read funding graph: %w", err)
+	}
+
+	graph := monitor.NewFundingGraph()
+	if err := json.Unmarshal(file, graph); err != nil {
+		return nil, fmt.Errorf("failed to parse funding graph: %w", err)
+	}
+	return graph, nil
+}
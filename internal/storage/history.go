@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+)
+
+const checkpointsFile = "checkpoints.json"
+
+// HistoryStore keeps the backfilled history of each wallet as JSON lines under
+// dataDir/history/<wallet>.jsonl, with the backfill checkpoints next to them.
+// Events are appended, an event whose key is already stored is skipped.
+type HistoryStore struct {
+	dir string
+
+	mu      sync.Mutex
+	indexes map[string]*historyIndex // wallet -> index of its history file, loaded on first use
+}
+
+// historyIndex is what is looked up in a wallet's history without reading it again. The
+// backfill runs as a separate process, a file that changed since it was indexed is read again.
+type historyIndex struct {
+	keys    map[string]bool // Stored event keys
+	held    map[string]bool // Mints the wallet held
+	size    int64
+	modTime time.Time
+}
+
+func NewHistoryStore(dataDir string) *HistoryStore {
+	return &HistoryStore{
+		dir:     filepath.Join(dataDir, "history"),
+		indexes: make(map[string]*historyIndex),
+	}
+}
+
+func (h *HistoryStore) walletPath(wallet string) string {
+	return filepath.Join(h.dir, wallet+".jsonl")
+}
+
+// Events returns the stored history of a wallet, oldest first
+func (h *HistoryStore) Events(wallet string) ([]monitor.HistoryEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events, err := h.readEvents(wallet)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Slot < events[j].Slot })
+	return events, nil
+}
+
+// HeldMint reports whether the wallet held mint at any point of its stored history, without
+// reading the history again unless it changed
+func (h *HistoryStore) HeldMint(wallet, mint string) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	index, err := h.load(wallet)
+	if err != nil {
+		return false, err
+	}
+	return index.held[mint], nil
+}
+
+// load returns the index of a wallet's history, indexing the file again when its size or
+// modification time changed since
+func (h *HistoryStore) load(wallet string) (*historyIndex, error) {
+	size, modTime, err := h.stat(wallet)
+	if err != nil {
+		return nil, err
+	}
+	if index, ok := h.indexes[wallet]; ok && index.size == size && index.modTime.Equal(modTime) {
+		return index, nil
+	}
+
+	stored, err := h.readEvents(wallet)
+	if err != nil {
+		return nil, err
+	}
+	index := &historyIndex{
+		keys:    make(map[string]bool, len(stored)),
+		held:    make(map[string]bool),
+		size:    size,
+		modTime: modTime,
+	}
+	for _, event := range stored {
+		index.keys[event.Key()] = true
+		if event.Held() {
+			index.held[event.Mint] = true
+		}
+	}
+	h.indexes[wallet] = index
+	return index, nil
+}
+
+// stat returns the size and modification time of a wallet's history, zero when there is none
+func (h *HistoryStore) stat(wallet string) (int64, time.Time, error) {
+	info, err := os.Stat(h.walletPath(wallet))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, fmt.Errorf("failed to read history: %w", err)
+	}
+	return info.Size(), info.ModTime(), nil
+}
+
+func (h *HistoryStore) readEvents(wallet string) ([]monitor.HistoryEvent, error) {
+	file, err := os.Open(h.walletPath(wallet))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	var events []monitor.HistoryEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event monitor.HistoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A line cut short by a crash mid-write, its page is fetched again on resume
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return events, nil
+}
+
+// AddEvents appends the events that are not stored yet and returns how many were new
+func (h *HistoryStore) AddEvents(wallet string, events []monitor.HistoryEvent) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index, err := h.load(wallet)
+	if err != nil {
+		return 0, err
+	}
+	keys := index.keys
+
+	var lines []byte
+	var added []monitor.HistoryEvent
+	for _, event := range events {
+		key := event.Key()
+		if keys[key] {
+			continue
+		}
+		line, err := json.Marshal(event)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal history event: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+		keys[key] = true
+		added = append(added, event)
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	if err := h.appendLines(wallet, lines); err != nil {
+		for _, event := range added {
+			delete(keys, event.Key())
+		}
+		return 0, err
+	}
+	for _, event := range added {
+		if event.Held() {
+			index.held[event.Mint] = true
+		}
+	}
+	// The index covers what was just written, it only goes stale when someone else writes
+	if index.size, index.modTime, err = h.stat(wallet); err != nil {
+		delete(h.indexes, wallet)
+	}
+	return len(added), nil
+}
+
+func (h *HistoryStore) appendLines(wallet string, lines []byte) error {
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	file, err := os.OpenFile(h.walletPath(wallet), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+
+	// Start on a fresh line if a previous write was cut short
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			lines = append([]byte{'\n'}, lines...)
+		}
+	}
+	if _, err := file.Write(lines); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return file.Close()
+}
+
+// Checkpoint returns the backfill checkpoint of a wallet, nil if it was never backfilled
+func (h *HistoryStore) Checkpoint(wallet string) (*monitor.BackfillCheckpoint, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	checkpoints, err := h.readCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	return checkpoints[wallet], nil
+}
+
+// SaveCheckpoint replaces the checkpoint file through a rename, so a crash leaves either
+// the old or the new checkpoints
+func (h *HistoryStore) SaveCheckpoint(wallet string, checkpoint *monitor.BackfillCheckpoint) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	checkpoints, err := h.readCheckpoints()
+	if err != nil {
+		return err
+	}
+	checkpoints[wallet] = checkpoint
+
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	file, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %w", err)
+	}
+	path := filepath.Join(h.dir, checkpointsFile)
+	if err := os.WriteFile(path+".tmp", file, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (h *HistoryStore) readCheckpoints() (map[string]*monitor.BackfillCheckpoint, error) {
+	checkpoints := make(map[string]*monitor.BackfillCheckpoint)
+	file, err := os.ReadFile(filepath.Join(h.dir, checkpointsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoints, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	if err := json.Unmarshal(file, &checkpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/accursedgalaxy/insider-monitor/internal/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	historyWallet = "CvQk2xkXtiMj2JqqVx1YZkeSqQ7jyQkNqqjeNE1jPTfc"
+	historyMint   = "DezXAZ8z7PnrnRJjz3wXBoRgixCa6xjnB7YaB1pPB263"
+)
+
+func TestHistoryStoreSeesBackfillsOfOtherProcesses(t *testing.T) {
+	dir := t.TempDir()
+	monitorStore := NewHistoryStore(dir)
+	held, err := monitorStore.HeldMint(historyWallet, historyMint)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// The backfill command writes through a store of its own
+	backfill := NewHistoryStore(dir)
+	_, err = backfill.AddEvents(historyWallet, []monitor.HistoryEvent{
+		{Signature: "5sig1", Slot: 10, WalletAddress: historyWallet, Mint: historyMint, PostBalance: 1000},
+	})
+	require.NoError(t, err)
+
+	held, err = monitorStore.HeldMint(historyWallet, historyMint)
+	require.NoError(t, err)
+	assert.True(t, held, "the index is rebuilt once the file changed")
+}
+
+func TestHistoryStoreAddsEventsOnce(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	first := monitor.HistoryEvent{Signature: "5sig1", Slot: 20, WalletAddress: historyWallet, Mint: historyMint, PostBalance: 1000}
+	second := monitor.HistoryEvent{Signature: "5sig2", Slot: 10, WalletAddress: historyWallet, Mint: historyMint, PreBalance: 1000}
+
+	added, err := store.AddEvents(historyWallet, []monitor.HistoryEvent{first})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	// A resumed backfill stores the same page again, only the new event is written
+	added, err = store.AddEvents(historyWallet, []monitor.HistoryEvent{first, second, second})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	// Also across a restart
+	added, err = NewHistoryStore(filepath.Dir(store.dir)).AddEvents(historyWallet, []monitor.HistoryEvent{first})
+	require.NoError(t, err)
+	assert.Zero(t, added)
+
+	events, err := store.Events(historyWallet)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "5sig2", events[0].Signature, "oldest first")
+}
+
+func TestHistoryStoreRecoversFromCutShortLine(t *testing.T) {
+	store := NewHistoryStore(t.TempDir())
+	_, err := store.AddEvents(historyWallet, []monitor.HistoryEvent{
+		{Signature: "5sig1", Slot: 10, WalletAddress: historyWallet, Mint: historyMint, PostBalance: 1000},
+	})
+	require.NoError(t, err)
+
+	// A crash mid-write leaves half a line without a newline
+	file, err := os.OpenFile(store.walletPath(historyWallet), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"signature":"5sig2","slot":2`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// The cut line is skipped, and the next event starts on a line of its own
+	added, err := NewHistoryStore(filepath.Dir(store.dir)).AddEvents(historyWallet, []monitor.HistoryEvent{
+		{Signature: "5sig2", Slot: 20, WalletAddress: historyWallet, Mint: historyMint, PostBalance: 2000},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	events, err := store.Events(historyWallet)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(2000), events[1].PostBalance)
+}
+
+func TestHistoryStoreReloadsCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint, err := NewHistoryStore(dir).Checkpoint(historyWallet)
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint, "never backfilled")
+
+	saved := &monitor.BackfillCheckpoint{Newest: "5new", NewestSlot: 200, Oldest: "5old", OldestSlot: 100, ReachedEnd: true,
+		UpdatedAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	require.NoError(t, NewHistoryStore(dir).SaveCheckpoint(historyWallet, saved))
+	require.NoError(t, NewHistoryStore(dir).SaveCheckpoint("other", &monitor.BackfillCheckpoint{Newest: "5x"}))
+
+	checkpoint, err = NewHistoryStore(dir).Checkpoint(historyWallet)
+	require.NoError(t, err)
+	assert.Equal(t, saved, checkpoint, "saving another wallet keeps this one")
+	_, err = os.Stat(filepath.Join(dir, "history", checkpointsFile+".tmp"))
+	assert.True(t, os.IsNotExist(err), "the temporary file is renamed into place")
+}